@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/ringsaturn/tzf"
+	"github.com/spf13/cobra"
+)
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Updates the catalog with the metadata of the tracks, only the new and changed tracks are analyzed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return catalogExecute(cmd.Context())
+	},
+}
+
+var (
+	catalogFile       string
+	catalogDuplicates bool
+)
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	addQualityFlags(catalogCmd)
+	catalogCmd.Flags().StringVar(&catalogFile, "catalog", "", "catalog file, by default ~/.cache/gotrackmaster/catalog.db")
+	catalogCmd.Flags().BoolVar(&catalogDuplicates, "duplicates", false, "Show the tracks with the same content, the same points saved by different applications")
+}
+
+// defaultCatalogFile sets the catalog file when --catalog is not used.
+func defaultCatalogFile() error {
+	if catalogFile == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return err
+		}
+		catalogFile = filepath.Join(dir, "gotrackmaster", "catalog.db")
+	}
+	return nil
+}
+
+func openCatalog() (*lib.Catalog, error) {
+	if err := defaultCatalogFile(); err != nil {
+		return nil, err
+	}
+	c, err := lib.OpenCatalog(catalogFile)
+	if err != nil {
+		return nil, err
+	}
+	c.QualityConfig = qualityConfig
+	return c, nil
+}
+
+// cachedCatalog opens the catalog to reuse the metadata of the tracks that didn't change, the catalog is nil
+// when it was never updated.
+func cachedCatalog() (*lib.Catalog, error) {
+	if err := defaultCatalogFile(); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(catalogFile); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return openCatalog()
+}
+
+func catalogExecute(ctx context.Context) error {
+	if err := validQualityConfig(); err != nil {
+		return err
+	}
+	finder, err := tzf.NewDefaultFinder()
+	if err != nil {
+		return err
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	c, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	u, err := c.Update(ctx, trackFiles, jobs, finder)
+	if err != nil {
+		return err
+	}
+	report(trackRecord{
+		Filename: catalogFile,
+		Updated:  u.Added+u.Updated+u.Removed > 0,
+		Data:     u,
+		message: fmt.Sprintf("[%v] - %d added, %d updated, %d unchanged, %d removed, %d with error(s)",
+			catalogFile, u.Added, u.Updated, u.Unchanged, u.Removed, u.Errors),
+	})
+	if !catalogDuplicates {
+		return nil
+	}
+
+	groups, err := c.Duplicates()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, e := range group[1:] {
+			report(trackRecord{
+				Filename: e.Path,
+				Data:     map[string]interface{}{"duplicate": group[0].Path, "fingerprint": e.Fingerprint},
+				message:  lib.ColorRed(fmt.Sprintf("Duplicate found: %v [same content as %v]", e.Path, group[0].Path)),
+			})
+		}
+	}
+	lib.Pass(fmt.Sprintf("Found %d groups of tracks with the same content", len(groups)))
+	return nil
+}
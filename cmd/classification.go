@@ -1,18 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var classificationCmd = &cobra.Command{
 	Use:   "classification",
 	Short: "Classify a track according to the type of activity",
-	Run: func(cmd *cobra.Command, args []string) {
-		classificationExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return classificationExecute(cmd.Context())
 	},
 }
 
@@ -20,11 +22,18 @@ func init() {
 	rootCmd.AddCommand(classificationCmd)
 }
 
-func classificationExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		kind := trackmaster.ClassificationTrack(filename)
-		fmt.Printf("[%v] - %s\n", filename, lib.ColorGreen(kind))
+func classificationExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) string {
+		return trackmaster.ClassificationTrack(g)
+	}, func(g gpx.GPX, filename string, kind string) {
+		report(trackRecord{
+			Filename:       filename,
+			Classification: kind,
+			message:        fmt.Sprintf("[%v] - %s", filename, lib.ColorGreen(kind)),
+		})
+	})
 }
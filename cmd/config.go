@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// configAll is the section of a profile applied to every command that has the flag.
+const configAll = "all"
+
+// configFile contains the profiles of the configuration file, each profile has the values of the
+// flags by command name:
+//
+//	profile: cycling
+//	profiles:
+//	  cycling:
+//	    all:
+//	      outformat: gpx
+//	    removestops:
+//	      minseconds: 60
+//	      maxdistance: 8
+type configFile struct {
+	Profile  string                                       `yaml:"profile" toml:"profile"`
+	Profiles map[string]map[string]map[string]interface{} `yaml:"profiles" toml:"profiles"`
+}
+
+// defaultConfigFiles returns the configuration files searched when --config is not used, the directory is
+// $XDG_CONFIG_HOME or ~/.config in all the systems.
+func defaultConfigFiles() []string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return []string{
+		filepath.Join(dir, "gotrackmaster", "config.yaml"),
+		filepath.Join(dir, "gotrackmaster", "config.yml"),
+		filepath.Join(dir, "gotrackmaster", "config.toml"),
+	}
+}
+
+func readConfig(filename string) (configFile, error) {
+	var c configFile
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return c, err
+	}
+	if strings.EqualFold(filepath.Ext(filename), ".toml") {
+		err = toml.Unmarshal(data, &c)
+	} else {
+		err = yaml.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("%s: %w", filename, err)
+	}
+	return c, nil
+}
+
+// loadConfig reads the configuration file and returns the values of the selected profile,
+// nothing is returned when there is no configuration file. The sections must be commands of root.
+func loadConfig(root *cobra.Command) (map[string]map[string]interface{}, error) {
+	files := defaultConfigFiles()
+	if configPath != "" {
+		files = []string{configPath}
+	}
+
+	for _, filename := range files {
+		c, err := readConfig(filename)
+		if errors.Is(err, os.ErrNotExist) && configPath == "" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := c.Profile
+		if profile != "" {
+			name = profile
+		}
+		if name == "" {
+			return nil, nil
+		}
+		values, ok := c.Profiles[name]
+		if !ok {
+			var names []string
+			for n := range c.Profiles {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("%s: unknown profile %q, valid profiles are %s", filename, name, strings.Join(names, ", "))
+		}
+		for section := range values {
+			if section == configAll {
+				continue
+			}
+			if cmd, _, err := root.Find([]string{section}); err != nil || cmd == root {
+				return nil, fmt.Errorf("%s: profile %s has the unknown command %q", filename, name, section)
+			}
+		}
+		return values, nil
+	}
+
+	if profile != "" {
+		return nil, fmt.Errorf("profile %q selected but there is no configuration file", profile)
+	}
+	return nil, nil
+}
+
+// applyConfig sets the flags of the command that are not given in the command line with the values
+// of the selected profile.
+func applyConfig(cmd *cobra.Command) error {
+	// several commands share the same variables with different defaults, so the defaults of the
+	// command that is executed are set again
+	var err error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed || strings.HasSuffix(f.Value.Type(), "Slice") || strings.HasSuffix(f.Value.Type(), "Array") {
+			return
+		}
+		if e := f.Value.Set(f.DefValue); e != nil && err == nil {
+			err = e
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	values, err := loadConfig(cmd.Root())
+	if err != nil || values == nil {
+		return err
+	}
+
+	set := func(section string, strict bool) error {
+		for name, value := range values[section] {
+			f := cmd.Flags().Lookup(name)
+			if f == nil {
+				if strict {
+					return fmt.Errorf("profile: command %s has no flag %q", section, name)
+				}
+				continue
+			}
+			if f.Changed {
+				continue
+			}
+			if err := f.Value.Set(fmt.Sprint(value)); err != nil {
+				return fmt.Errorf("profile: flag %s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	if err := set(configAll, false); err != nil {
+		return err
+	}
+	// the values of the command have more priority than the common values
+	return set(cmd.Name(), true)
+}
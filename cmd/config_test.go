@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+const configSample = `profile: cycling
+profiles:
+  cycling:
+    all:
+      outformat: gpx
+      maxdistance: 8
+      unknown: 1
+    removestops:
+      maxdistance: 10
+  unknownflag:
+    removestops:
+      unknown: 1
+`
+
+// configCommand returns a command with the flags used by the tests and the arguments of the command line,
+// the root has also the command other.
+func configCommand(t *testing.T, args ...string) *cobra.Command {
+	root := &cobra.Command{Use: "gotrackmaster"}
+	cmd := &cobra.Command{Use: "removestops"}
+	other := &cobra.Command{Use: "other"}
+	other.Flags().Float64("maxdistance", 5, "")
+	root.AddCommand(cmd, other)
+	cmd.Flags().Float64("maxdistance", 5, "")
+	cmd.Flags().Int("minseconds", 60, "")
+	cmd.Flags().String("outformat", "", "")
+	assert.NoError(t, cmd.ParseFlags(args))
+	return cmd
+}
+
+func setConfig(t *testing.T, content, name string) {
+	configPath = filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0o644))
+	profile = name
+	t.Cleanup(func() {
+		configPath, profile = "", ""
+	})
+}
+
+// TestApplyConfigPrecedence tests that the command line has more priority than the section of the command,
+// the section of the command more than the all section and the all section more than the default values.
+func TestApplyConfigPrecedence(t *testing.T) {
+	setConfig(t, configSample, "")
+
+	cmd := configCommand(t)
+	assert.NoError(t, applyConfig(cmd))
+	assert.Equal(t, "10", cmd.Flag("maxdistance").Value.String())
+	assert.Equal(t, "gpx", cmd.Flag("outformat").Value.String())
+	assert.Equal(t, "60", cmd.Flag("minseconds").Value.String())
+
+	cmd = configCommand(t, "--maxdistance", "3", "--outformat", "fit")
+	assert.NoError(t, applyConfig(cmd))
+	assert.Equal(t, "3", cmd.Flag("maxdistance").Value.String())
+	assert.Equal(t, "fit", cmd.Flag("outformat").Value.String())
+
+	// the all section is used by the other commands
+	other, _, err := cmd.Root().Find([]string{"other"})
+	assert.NoError(t, err)
+	assert.NoError(t, applyConfig(other))
+	assert.Equal(t, "8", other.Flag("maxdistance").Value.String())
+}
+
+// TestApplyConfigUnknown tests the unknown profiles and flags.
+func TestApplyConfigUnknown(t *testing.T) {
+	// the flags of the section of the command must exist
+	setConfig(t, configSample, "unknownflag")
+	assert.ErrorContains(t, applyConfig(configCommand(t)), `command removestops has no flag "unknown"`)
+
+	// the sections must be commands
+	setConfig(t, "profile: p\nprofiles:\n  p:\n    removestop:\n      minseconds: 60\n", "")
+	assert.ErrorContains(t, applyConfig(configCommand(t)), `unknown command "removestop"`)
+
+	setConfig(t, configSample, "running")
+	assert.ErrorContains(t, applyConfig(configCommand(t)), `unknown profile "running"`)
+
+	// a value with the wrong type
+	setConfig(t, "profile: p\nprofiles:\n  p:\n    removestops:\n      minseconds: fast\n", "")
+	assert.ErrorContains(t, applyConfig(configCommand(t)), "flag minseconds")
+
+	// without configuration file only the selected profile is an error
+	configPath = ""
+	profile = "cycling"
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	assert.ErrorContains(t, applyConfig(configCommand(t)), "there is no configuration file")
+	profile = ""
+	assert.NoError(t, applyConfig(configCommand(t)))
+}
+
+// TestProfileSteps tests that the steps of a pipeline use the values of the profile for the commands with the
+// same name and the parameters of the steps have more priority.
+func TestProfileSteps(t *testing.T) {
+	setConfig(t, configSample, "")
+
+	steps, err := profileSteps([]trackmaster.Step{
+		{Name: "removestops"},
+		{Name: "removenoise", Params: map[string]string{"maxdistance": "2"}},
+		{Name: "timestamp"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"maxdistance": "10"}, steps[0].Params)
+	assert.Equal(t, map[string]string{"maxdistance": "2"}, steps[1].Params)
+	assert.Empty(t, steps[2].Params)
+
+	setConfig(t, "profile: p\nprofiles:\n  p:\n    removestops:\n      minseconds: fast\n", "")
+	_, err = profileSteps([]trackmaster.Step{{Name: "removestops"}})
+	assert.ErrorContains(t, err, "minseconds must be a number")
+}
+
+// TestDefaultConfigFiles tests that the configuration is searched in $XDG_CONFIG_HOME or ~/.config.
+func TestDefaultConfigFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	assert.Equal(t, filepath.Join(home, ".config", "gotrackmaster", "config.yaml"), defaultConfigFiles()[0])
+
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	assert.Equal(t, filepath.Join(dir, "gotrackmaster", "config.yaml"), defaultConfigFiles()[0])
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Converts tracks to other formats (gpx, fit, tcx, geojson, kml, kmz, csv)",
+	Long: `Converts tracks to other formats, the format is taken from --format or from the extension of the destination.
+Without destination the converted track is written next to the original track, the destination directory
+mirrors the tree of the tracks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return convertExecute(cmd.Context())
+	},
+}
+
+var convertFormat string
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+	convertCmd.Flags().StringVar(&convertFormat, "format", "", "output format (gpx, fit, tcx, geojson, kml, kmz, csv)")
+	convertCmd.Flags().StringVar(&destination, "destination", "", "destination file or directory of the converted tracks")
+}
+
+func convertExecute(ctx context.Context) error {
+	var format lib.Format
+	var err error
+	if convertFormat != "" {
+		format, err = lib.FormatByName(convertFormat)
+	} else {
+		format, err = lib.FormatByFilename(destination)
+	}
+	if err != nil {
+		return errors.New("output format is missing or unknown")
+	}
+	if format.Write == nil {
+		return errors.New("output format can't be written")
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	// the destination is a file only when it has the extension of the format and there is one track
+	destinationFile := false
+	if destination != "" {
+		if f, err := lib.FormatByFilename(destination); err == nil && f.Name == format.Name && len(trackFiles) == 1 {
+			destinationFile = true
+		}
+	}
+
+	if !dryRun && !destinationFile && destination != "" {
+		if err := os.MkdirAll(destination, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	// the tracks are not converted when two of them have the same target or the target is other track
+	targets := make(map[string]string)
+	sources := make(map[string]string)
+	for _, f := range trackFiles {
+		sources[strings.ToLower(f.Filename)] = f.Filename
+	}
+	for _, f := range trackFiles {
+		target, err := convertTarget(f.Filename, format, destinationFile)
+		if err != nil {
+			return err
+		}
+		if other, found := sources[strings.ToLower(target)]; found && other != f.Filename {
+			return fmt.Errorf("%v and %v are converted to %v", other, f.Filename, target)
+		}
+		sources[strings.ToLower(target)] = f.Filename
+		targets[f.Filename] = target
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
+		target := targets[filename]
+		if target == filename {
+			return trackRecord{Filename: filename, message: fmt.Sprintf("[%v] - no conversion need", filename)}
+		}
+
+		if !dryRun {
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return errorRecord(filename, "Track could not be converted", err)
+			}
+			if backup {
+				if err := lib.BackupFile(target); err != nil {
+					return errorRecord(filename, "Track could not be converted", err)
+				}
+			}
+			if err := lib.WriteTrackFile(g, target); err != nil {
+				return errorRecord(filename, "Track could not be converted", err)
+			}
+		}
+		return trackRecord{Filename: filename, Target: target, Updated: true, message: fmt.Sprintf("[%v] -> %v", filename, target)}
+	}, func(g gpx.GPX, filename string, r trackRecord) {
+		report(r)
+	})
+}
+
+// convertTarget returns the file where a track is converted, the destination directory mirrors the
+// tree of --track like --output-dir.
+func convertTarget(filename string, format lib.Format, destinationFile bool) (string, error) {
+	target, err := outputFilename(filename)
+	if err != nil {
+		return "", err
+	}
+	target = lib.ChangeExtension(target, format)
+	if destinationFile {
+		return destination, nil
+	}
+	if destination != "" {
+		rel, err := filepath.Rel(trackDir, filename)
+		if err != nil {
+			rel = filepath.Base(filename)
+		}
+		target = filepath.Join(destination, filepath.Dir(rel), filepath.Base(target))
+	}
+	return target, nil
+}
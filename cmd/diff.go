@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <before> <after>",
+	Short: "Shows the points removed, inserted and moved between two versions of a track",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return diffExecute(args[0], args[1])
+	},
+}
+
+var diffGeoJSON string
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&diffGeoJSON, "geojson", "", "write the changes as GeoJSON to this file")
+}
+
+// diffMessage returns the summary of the changes and the changed points when points is true.
+func diffMessage(d trackmaster.DiffResult, points bool) string {
+	s := d.Stats
+	lines := []string{
+		fmt.Sprintf("  Points: %d -> %d (%d removed, %d inserted, %d moved, max moved %.2f m)", s.PointsBefore, s.PointsAfter, s.Removed, s.Inserted, s.Moved, s.MaxMoved),
+		fmt.Sprintf("  Distance: %.2f km -> %.2f km", s.DistanceBefore/1000, s.DistanceAfter/1000),
+		fmt.Sprintf("  Gain: %.0f m -> %.0f m", s.GainBefore, s.GainAfter),
+	}
+	for _, p := range d.Points {
+		if !points {
+			break
+		}
+		switch p.Kind {
+		case trackmaster.DiffRemoved:
+			lines = append(lines, fmt.Sprintf("  %s %d/%d/%d (%f, %f)", lib.ColorRed("-"), p.Before.TrkTypeNo, p.Before.TrkSegTypeNo, p.Before.WptTypeNo, p.Before.WptType.Lat, p.Before.WptType.Lon))
+		case trackmaster.DiffInserted:
+			lines = append(lines, fmt.Sprintf("  %s %d/%d/%d (%f, %f)", lib.ColorGreen("+"), p.After.TrkTypeNo, p.After.TrkSegTypeNo, p.After.WptTypeNo, p.After.WptType.Lat, p.After.WptType.Lon))
+		default:
+			lines = append(lines, fmt.Sprintf("  %s %d/%d/%d -> %d/%d/%d %.2f m, elevation %+.2f m, time %+.0f s", lib.ColorYellow("~"),
+				p.Before.TrkTypeNo, p.Before.TrkSegTypeNo, p.Before.WptTypeNo, p.After.TrkTypeNo, p.After.TrkSegTypeNo, p.After.WptTypeNo, p.Distance, p.Elevation, p.Time))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func diffExecute(before, after string) error {
+	a, err := lib.ReadTrackFile(before)
+	if err != nil {
+		return fmt.Errorf("%s: %w", before, err)
+	}
+	b, err := lib.ReadTrackFile(after)
+	if err != nil {
+		return fmt.Errorf("%s: %w", after, err)
+	}
+
+	d := trackmaster.Diff(*a, *b)
+	if diffGeoJSON != "" {
+		f, err := os.Create(diffGeoJSON)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := lib.WriteDiffGeoJSON(f, *a, *b, d); err != nil {
+			return err
+		}
+	}
+
+	report(trackRecord{
+		Filename: before,
+		Target:   after,
+		Count:    len(d.Points),
+		Diff:     &d,
+		message:  fmt.Sprintf("[%v] -> [%v]\n%s", before, after, diffMessage(d, true)),
+	})
+	return nil
+}
@@ -1,34 +1,40 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/ringsaturn/tzf"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var duplicateCmd = &cobra.Command{
 	Use:   "duplicate",
-	Short: "Search for duplicate tracks by time (start/end) and/or position (start/end)",
-	Run: func(cmd *cobra.Command, args []string) {
-		duplicateExecute()
+	Short: "Search for duplicate tracks by time (start/end), position (start/end) and/or shape",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return duplicateExecute(cmd.Context())
 	},
 }
 
 type duplicateStructure struct {
-	startTime time.Time
-	endTime   time.Time
-	startLat  float64
-	startLon  float64
-	endLat    float64
-	endLon    float64
-	quality   float64
-	creator   string
-	filename  string
+	startTime   time.Time
+	endTime     time.Time
+	startLat    float64
+	startLon    float64
+	endLat      float64
+	endLon      float64
+	quality     float64
+	creator     string
+	filename    string
+	shape       trackmaster.Shape
+	fingerprint string
 }
 
 var (
@@ -40,19 +46,32 @@ var (
 	distanceComparator bool
 	dup                int
 	del                int
+	merged             int
 	deleteDup          bool
+	mergeDup           bool
+	shapeComparator    bool
+	exactComparator    bool
+	shapeTolerance     float64
+	shapeSimilarity    float64
 	duplicateGPX       []duplicateStructure
 )
 
 func init() {
 	rootCmd.AddCommand(duplicateCmd)
+	addQualityFlags(duplicateCmd)
 	duplicateCmd.Flags().IntVar(&startDiff, "startdiff", 0, "Time in seconds from the beginning of the track to determine if they are duplicates (set 0 to not use this rule)")
 	duplicateCmd.Flags().IntVar(&endDiff, "enddiff", 0, "Time in seconds from the end of the track to determine if they are duplicates (set 0 to not use this rule)")
 	duplicateCmd.Flags().IntVar(&startDistance, "startDistance", 0, "Distance in meters from the beginning position of the track to determine if they are duplicates (set 0 to not use this rule)")
 	duplicateCmd.Flags().IntVar(&endDistance, "endDistance", 0, "Distance in meters from the end position of the track to determine if they are duplicates (set 0 to not use this rule)")
 	duplicateCmd.Flags().BoolVar(&timeComparator, "timeComparator", false, "Takes time start and end to determine if they are duplicates")
 	duplicateCmd.Flags().BoolVar(&distanceComparator, "distanceComparator", false, "Requires distance start and end to determine if they are duplicates")
-	duplicateCmd.Flags().BoolVar(&deleteDup, "delete", false, "Delete duplicate only when equal creator and quality of track")
+	duplicateCmd.Flags().BoolVar(&exactComparator, "exact", false, "Compares the fingerprint of the points to find the same content saved by different applications")
+	duplicateCmd.Flags().BoolVar(&shapeComparator, "shape", false, "Compares the geometry of the tracks with the Fréchet and Hausdorff distances to determine if they are duplicates")
+	duplicateCmd.Flags().Float64Var(&shapeTolerance, "tolerance", 50, "Distance in meters between the tracks that is considered the same path with --shape")
+	duplicateCmd.Flags().Float64Var(&shapeSimilarity, "similarity", 0.8, "Minimum similarity score from 0 to 1 of the duplicates with --shape")
+	duplicateCmd.Flags().BoolVar(&deleteDup, "delete", false, "Delete duplicate only when equal creator and quality of track or the same content with --exact")
+	duplicateCmd.Flags().StringVar(&catalogFile, "catalog", "", "catalog file to reuse the metadata of the tracks that didn't change, by default ~/.cache/gotrackmaster/catalog.db")
+	duplicateCmd.Flags().BoolVar(&mergeDup, "merge", false, "Merge the duplicates found by time, content or shape that were recorded at the same time into a GPX with the best positions, elevation and sensors of both tracks")
 }
 
 func checkTime(t, d time.Time, sec int) bool {
@@ -63,90 +82,256 @@ func checkPosition(lat1, lon1, lat2, lon2 float64, distance int) bool {
 	return trackmaster.HaversineDistance(lat1, lon1, lat2, lon2) < float64(distance)
 }
 
-func showDuplicate(d, actual duplicateStructure, status string) bool {
-	lib.Error(fmt.Sprintf("Duplicate found: %v [%v]", showNameTrack(d.filename, d.creator, d.quality), status))
+// showDuplicate reports a duplicate and deletes or merges it, only the duplicates found by time, content or
+// shape are merged because the tracks found by position can be recorded on different days. The tracks are
+// only merged when they were recorded at the same time, the same route can be found by shape on other day.
+func showDuplicate(d, actual duplicateStructure, status string, mergeable bool) bool {
+	quality := actual.quality
+	r := trackRecord{
+		Filename: actual.filename,
+		Quality:  &quality,
+		Data:     map[string]interface{}{"duplicate": d.filename, "reason": status, "deleted": false},
+		message:  lib.ColorRed(fmt.Sprintf("Duplicate found: %v [%v]", showNameTrack(d.filename, d.creator, d.quality), status)),
+	}
 	dup++
-	if deleteDup && d.creator == actual.creator && d.quality == actual.quality {
+	_, _, overlap := trackmaster.TimeOverlap(d.startTime, d.endTime, actual.startTime, actual.endTime)
+	if mergeDup && mergeable && overlap {
+		target, stats, err := mergeDuplicate(d.filename, actual.filename)
+		if err != nil {
+			report(r)
+			reportError(actual.filename, "Tracks could not be merged", err)
+			return false
+		}
+		merged++
+		// the next duplicates are merged with the merged track
+		if !dryRun && outputDir == "" && suffix == "" {
+			for i := range duplicateGPX {
+				if duplicateGPX[i].filename == d.filename {
+					duplicateGPX[i].filename = target
+				}
+			}
+		}
+		r.Updated = true
+		r.Target = target
+		r.Data = map[string]interface{}{"duplicate": d.filename, "reason": status, "deleted": false, "merged": stats}
+		r.message += fmt.Sprintf("\n  Merged into %v: positions %d/%d spans", target, stats.PositionSpans[0], stats.PositionSpans[1])
+		report(r)
+		return true
+	}
+	same := d.fingerprint != "" && d.fingerprint == actual.fingerprint
+	if deleteDup && (same || (d.creator == actual.creator && d.quality == actual.quality)) {
 		del++
+		r.Updated = true
+		r.Data = map[string]interface{}{"duplicate": d.filename, "reason": status, "deleted": true}
+		report(r)
 		lib.Info(fmt.Sprintf("Deleting %v", d.filename))
 		if !dryRun {
 			os.Remove(d.filename)
 			return true
 		}
+		return false
 	}
+	report(r)
 	return false
 }
 
+// mergeDuplicate merges two tracks into a GPX that replaces the first one and returns where it is written.
+// The tracks are removed when the GPX is written in their directory without --output-dir or --suffix.
+func mergeDuplicate(first, second string) (string, trackmaster.MergeStats, error) {
+	a, err := lib.ReadTrackFile(first)
+	if err != nil {
+		return "", trackmaster.MergeStats{}, err
+	}
+	b, err := lib.ReadTrackFile(second)
+	if err != nil {
+		return "", trackmaster.MergeStats{}, err
+	}
+	g, stats, err := trackmaster.Merge(*a, *b, trackmaster.MergeSpan)
+	if err != nil {
+		return "", stats, err
+	}
+
+	// both sources are recorded in the metadata
+	g.Metadata = &gpx.MetadataType{
+		Name: trackmaster.GetName(*a),
+		Desc: fmt.Sprintf("Merged from %s and %s", filepath.Base(first), filepath.Base(second)),
+		Link: []*gpx.LinkType{
+			{HREF: filepath.Base(first), Text: trackmaster.GetCreator(*a), Type: "source"},
+			{HREF: filepath.Base(second), Text: trackmaster.GetCreator(*b), Type: "source"},
+		},
+	}
+
+	target, err := outputFilename(first)
+	if err != nil {
+		return "", stats, err
+	}
+	format, err := lib.FormatByName("gpx")
+	if err != nil {
+		return "", stats, err
+	}
+	target = lib.ChangeExtension(target, format)
+	if dryRun {
+		return target, stats, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return target, stats, err
+	}
+	for _, filename := range []string{target, first, second} {
+		if backup {
+			if err := lib.BackupFile(filename); err != nil {
+				return target, stats, err
+			}
+		}
+	}
+	if err := lib.WriteTrackFile(g, target); err != nil {
+		return target, stats, err
+	}
+	if outputDir != "" || suffix != "" {
+		return target, stats, nil
+	}
+	for _, filename := range []string{first, second} {
+		if filename != target {
+			if err := os.Remove(filename); err != nil {
+				return target, stats, err
+			}
+		}
+	}
+	return target, stats, nil
+}
+
 func showNameTrack(filename, creator string, quality float64) string {
 	return fmt.Sprintf("%v (%s/%0.0f)", filename, creator, quality)
 }
 
-func duplicateExecute() {
+func duplicateExecute(ctx context.Context) error {
+	if err := validQualityConfig(); err != nil {
+		return err
+	}
 	if startDiff < 0 {
-		lib.Error("Start diff must be positive")
-		os.Exit(1)
+		return errors.New("start diff must be positive")
 	}
 	if endDiff < 0 {
-		lib.Error("End diff must be positive")
-		os.Exit(1)
+		return errors.New("end diff must be positive")
 	}
 	if startDistance < 0 {
-		lib.Error("Start distance must be positive")
-		os.Exit(1)
+		return errors.New("start distance must be positive")
 	}
 	if endDistance < 0 {
-		lib.Error("End distance must be positive")
-		os.Exit(1)
+		return errors.New("end distance must be positive")
 	}
-	if startDiff == 0 && endDiff == 0 && startDistance == 0 && endDistance == 0 {
-		lib.Error("You must specify at least one rule")
-		os.Exit(1)
+	if shapeTolerance <= 0 {
+		return errors.New("tolerance must be positive")
+	}
+	if shapeSimilarity <= 0 || shapeSimilarity > 1 {
+		return errors.New("similarity must be between 0 and 1")
+	}
+	if mergeDup && deleteDup {
+		return errors.New("merge and delete can't be used at the same time")
+	}
+	if startDiff == 0 && endDiff == 0 && startDistance == 0 && endDistance == 0 && !shapeComparator && !exactComparator {
+		return errors.New("you must specify at least one rule")
 	}
 
 	finder, err := tzf.NewDefaultFinder()
 	if err != nil {
-		lib.Error(err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
 
-		quality := trackmaster.QualityTrack(g)
-		creator := trackmaster.GetCreator(g)
+	// the metadata of the tracks that didn't change since the catalog was updated is not calculated again
+	catalog, err := cachedCatalog()
+	if err != nil {
+		return err
+	}
+	if catalog != nil {
+		defer catalog.Close()
+	}
 
-		fmt.Printf("Getting info from: %v\n", showNameTrack(filename, creator, quality))
+	if err := forEachTrack(ctx, func(g gpx.GPX, filename string) *duplicateStructure {
+		var e lib.CatalogEntry
+		cached := false
+		if catalog != nil {
+			e, cached = catalog.Cached(filename)
+		}
+		if !cached {
+			ps := trackmaster.GetPositionStart(g)
+			pe := trackmaster.GetPositionEnd(g)
+			e = lib.CatalogEntry{
+				Start:    trackmaster.GetTimeStart(g, finder),
+				End:      trackmaster.GetTimeEnd(g, finder),
+				StartLat: ps.Lat,
+				StartLon: ps.Lon,
+				EndLat:   pe.Lat,
+				EndLon:   pe.Lon,
+				Creator:  trackmaster.GetCreator(g),
+				Quality:  trackmaster.Quality(g, qualityConfig).Quality,
+			}
+			if exactComparator {
+				e.Fingerprint = trackmaster.Fingerprint(g)
+			}
+		}
+		quality := e.Quality
+		creator := e.Creator
 
-		ts := trackmaster.GetTimeStart(g, finder)
-		te := trackmaster.GetTimeEnd(g, finder)
+		ts := e.Start
+		te := e.End
 
 		// only add if start and end time are valid
 		if (ts.IsZero() || te.IsZero()) && startDiff != 0 && endDiff != 0 && startDistance == 0 && endDistance == 0 {
-			continue
+			return nil
 		}
 
-		ps := trackmaster.GetPositionStart(g)
-		pe := trackmaster.GetPositionEnd(g)
 		// without position start and end we can't calculate distance
-		if (ps.Lat == 0 && ps.Lon == 0) || (pe.Lat == 0 && pe.Lon == 0) {
-			continue
+		if (e.StartLat == 0 && e.StartLon == 0) || (e.EndLat == 0 && e.EndLon == 0) {
+			return nil
+		}
+
+		var shape trackmaster.Shape
+		if shapeComparator {
+			shape = trackmaster.TrackShape(g, trackmaster.ShapeInterval, trackmaster.ShapeMaxPoints)
 		}
 
-		actual := duplicateStructure{
-			startTime: ts,
-			endTime:   te,
-			startLat:  ps.Lat,
-			startLon:  ps.Lon,
-			endLat:    pe.Lat,
-			endLon:    pe.Lon,
-			quality:   quality,
-			creator:   creator,
-			filename:  filename,
+		var fingerprint string
+		if exactComparator {
+			fingerprint = e.Fingerprint
+		}
+
+		return &duplicateStructure{
+			fingerprint: fingerprint,
+			shape:       shape,
+			startTime:   ts,
+			endTime:     te,
+			startLat:    e.StartLat,
+			startLon:    e.StartLon,
+			endLat:      e.EndLat,
+			endLon:      e.EndLon,
+			quality:     quality,
+			creator:     creator,
+			filename:    filename,
+		}
+	}, func(g gpx.GPX, filename string, info *duplicateStructure) {
+		// tracks without valid times or positions
+		if info == nil {
+			return
+		}
+		actual := *info
+		ts, te := actual.startTime, actual.endTime
+		ps := gpx.WptType{Lat: actual.startLat, Lon: actual.startLon}
+		pe := gpx.WptType{Lat: actual.endLat, Lon: actual.endLon}
+		fmt.Fprintf(os.Stderr, "Getting info from: %v\n", showNameTrack(filename, actual.creator, actual.quality))
+
+		if actual.fingerprint != "" {
+			for _, d := range duplicateGPX {
+				if d.fingerprint == actual.fingerprint {
+					if showDuplicate(d, actual, "same content", true) {
+						return
+					}
+				}
+			}
 		}
 
 		// check if start time is same other track with margin of startDiff
@@ -154,12 +339,12 @@ func duplicateExecute() {
 			for _, d := range duplicateGPX {
 				if checkTime(ts, d.startTime, startDiff) {
 					if timeComparator && endDiff != 0 && checkTime(te, d.endTime, endDiff) {
-						if showDuplicate(d, actual, "start and end time") {
-							goto next
+						if showDuplicate(d, actual, "start and end time", true) {
+							return
 						}
 					} else {
-						if showDuplicate(d, actual, "start time") {
-							goto next
+						if showDuplicate(d, actual, "start time", true) {
+							return
 						}
 					}
 				}
@@ -167,8 +352,8 @@ func duplicateExecute() {
 		} else if endDiff != 0 {
 			for _, d := range duplicateGPX {
 				if checkTime(te, d.endTime, endDiff) {
-					if showDuplicate(d, actual, "end time") {
-						goto next
+					if showDuplicate(d, actual, "end time", true) {
+						return
 					}
 				}
 			}
@@ -178,12 +363,12 @@ func duplicateExecute() {
 			for _, d := range duplicateGPX {
 				if checkPosition(ps.Lat, ps.Lon, d.startLat, d.startLon, startDistance) {
 					if distanceComparator && endDistance != 0 && checkPosition(pe.Lat, pe.Lon, d.endLat, d.endLon, endDistance) {
-						if showDuplicate(d, actual, "start and end position") {
-							goto next
+						if showDuplicate(d, actual, "start and end position", false) {
+							return
 						}
 					} else {
-						if showDuplicate(d, actual, "start position") {
-							goto next
+						if showDuplicate(d, actual, "start position", false) {
+							return
 						}
 					}
 				}
@@ -191,16 +376,37 @@ func duplicateExecute() {
 		} else if endDistance != 0 {
 			for _, d := range duplicateGPX {
 				if checkPosition(pe.Lat, pe.Lon, d.endLat, d.endLon, endDistance) {
-					if showDuplicate(d, actual, "end position") {
-						goto next
+					if showDuplicate(d, actual, "end position", false) {
+						return
+					}
+				}
+			}
+		}
+
+		if shapeComparator {
+			for _, d := range duplicateGPX {
+				// the bounds discard quickly the tracks that are not near
+				if !trackmaster.BoundsOverlap(d.shape.Bounds, actual.shape.Bounds, shapeTolerance) {
+					continue
+				}
+				s := trackmaster.Similarity(d.shape, actual.shape, shapeTolerance)
+				if s.Score >= shapeSimilarity {
+					status := fmt.Sprintf("shape similarity %0.2f, overlap %0.0f%%, Fréchet %0.0f m, Hausdorff %0.0f m", s.Score, s.Overlap*100, s.Frechet, s.Hausdorff)
+					if showDuplicate(d, actual, status, true) {
+						return
 					}
 				}
 			}
 		}
 
 		duplicateGPX = append(duplicateGPX, actual)
-	next:
+	}); err != nil {
+		return err
 	}
 	lib.Pass(fmt.Sprintf("Found %d duplicate tracks", dup))
 	lib.Pass(fmt.Sprintf("Deleted %d duplicate tracks", del))
+	if mergeDup {
+		lib.Pass(fmt.Sprintf("Merged %d duplicate tracks", merged))
+	}
+	return nil
 }
@@ -1,55 +1,53 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"strconv"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var elevationCmd = &cobra.Command{
 	Use:   "elevation",
 	Short: "Update elevation using SRTM data",
-	Run: func(cmd *cobra.Command, args []string) {
-		elevationExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return elevationExecute(cmd.Context())
 	},
 }
 var accuracy int16
 
 func init() {
 	rootCmd.AddCommand(elevationCmd)
-	elevationCmd.Flags().Int16Var(&accuracy, "accuracy", 60, "set the minimum accuracy to update the elevation")
+	elevationCmd.Flags().Int16Var(&accuracy, "accuracy", trackmaster.DefaultElevationAccuracy, "set the minimum accuracy to update the elevation")
 }
 
-func elevationExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
+func elevationExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
 
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
 		num, err := trackmaster.ElevationSRTMAccuracy(g)
 		if err != nil {
-			fmt.Println(lib.ColorYellow("Warning: Elevation SRTM could not be processed, error: ", lib.ColorRed(err)))
-			continue
+			return errorRecord(filename, "Elevation SRTM could not be processed", err)
 		}
+		r := trackRecord{Filename: filename, Data: map[string]int{"accuracy": num}}
 		if int16(num) > accuracy {
-			fmt.Printf("[%v] - Accuracy %s\n", filename, lib.ColorGreen(num))
-		} else {
-			if !dryRun {
-				err := trackmaster.ElevationSRTM(g)
-				if err != nil {
-					log.Fatal(lib.ColorRed(err))
-				}
-
-				writeGPX(g, filename)
+			r.message = fmt.Sprintf("[%v] - Accuracy %s", filename, lib.ColorGreen(num))
+			return r
+		}
+		if !dryRun {
+			if err := trackmaster.ElevationSRTM(g); err != nil {
+				return errorRecord(filename, "Elevation SRTM could not be processed", err)
 			}
-			fmt.Printf("[%v] - Accuracy %s\n", filename, lib.ColorRed(strconv.Itoa(num)+" (updated)"))
+			r.write = true
 		}
-	}
+		r.Updated = true
+		r.message = fmt.Sprintf("[%v] - Accuracy %s", filename, lib.ColorRed(strconv.Itoa(num)+" (updated)"))
+		return r
+	}, reportTrack)
 }
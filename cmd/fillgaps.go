@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var fillGapsCmd = &cobra.Command{
+	Use:   "fillgaps",
+	Short: "Fill the GPS signal gaps with synthetic points using the elevation of the DEM",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fillGapsExecute(cmd.Context())
+	},
+}
+
+var (
+	gapSeconds  float64
+	gapDistance float64
+	gapPoints   int
+	gapDEM      bool
+)
+
+func init() {
+	rootCmd.AddCommand(fillGapsCmd)
+	gaps := trackmaster.DefaultFillGapsConfig()
+	fillGapsCmd.Flags().Float64Var(&gapSeconds, "maxseconds", gaps.MaxSeconds, "set the maximum time between points before it is considered a gap, 0 to disable")
+	fillGapsCmd.Flags().Float64Var(&gapDistance, "maxdistance", gaps.MaxDistance, "set the maximum distance between points before it is considered a gap, 0 to disable")
+	fillGapsCmd.Flags().IntVar(&gapPoints, "maxpoints", gaps.MaxPoints, "set the maximum number of points added to a gap, the bigger gaps are reported and not filled, 0 for no limit")
+	fillGapsCmd.Flags().BoolVar(&gapDEM, "dem", gaps.DEM, "use the SRTM elevation for the added points instead of interpolating it")
+}
+
+func fillGapsExecute(ctx context.Context) error {
+	if gapPoints < 0 {
+		return errors.New("max points must be positive")
+	}
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	var elevation trackmaster.ElevationFunc
+	if gapDEM {
+		var err error
+		elevation, err = trackmaster.ElevationDEM()
+		if err != nil {
+			lib.Warning("Elevation SRTM could not be processed, error: " + err.Error())
+		}
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
+		result, skipped, err := trackmaster.FillGaps(g, gapSeconds, gapDistance, gapPoints, elevation, !dryRun)
+		if err != nil {
+			return errorRecord(filename, "Elevation SRTM could not be processed", err)
+		}
+		var data interface{}
+		var message string
+		if len(skipped) > 0 {
+			data = map[string]interface{}{"skipped": skipped}
+			message = lib.ColorYellow(fmt.Sprintf(", %d gap(s) not filled, they need more than %d points", len(skipped), gapPoints))
+		}
+		if len(result) == 0 && len(skipped) == 0 {
+			return trackRecord{Filename: filename, message: fmt.Sprintf("[%v] - no gaps found", filename)}
+		}
+		if len(result) == 0 {
+			return trackRecord{Filename: filename, Data: data, message: fmt.Sprintf("[%v] - no gaps filled", filename) + message}
+		}
+
+		points := 0
+		for _, gap := range result {
+			points += gap.Count
+		}
+		return trackRecord{
+			Filename: filename,
+			Updated:  true,
+			Count:    points,
+			Points:   result,
+			Data:     data,
+			message:  fmt.Sprintf("[%v] - Filling %d gap(s) with %s point(s)", filename, len(result), lib.ColorRed(strconv.Itoa(points)+" (updated)")) + message,
+			write:    true,
+		}
+	}, reportTrack)
+}
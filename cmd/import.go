@@ -1,212 +1,602 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 
-	"github.com/codingsince1985/geo-golang"
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/ringsaturn/tzf"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var importCmd = &cobra.Command{
 	Use:   "import",
 	Short: "Imports tracks and sorts them into a new directory structure",
-	Run: func(cmd *cobra.Command, args []string) {
-		importExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return importExecute(cmd.Context())
 	},
 }
 
+// importInfo contains the information of a track that is calculated in the workers.
+type importInfo struct {
+	data   lib.NameData
+	bounds gpx.BoundsType
+	// entry is the entry of the catalog when the track didn't change
+	entry *lib.CatalogEntry
+}
+
 type ImportStructure struct {
 	source    string
 	directory string
 	archive   string
+	kind      string
+	quality   float64
 }
 
 var (
 	destination     string
 	directoryFormat string
 	archiveFormat   string
+	geocoderName    string
+	geoNamesDir     string
+	geocoderCache   string
+	importMode      string
+	onConflict      string
+	skipDuplicates  bool
+
+	directoryTemplate *lib.NameTemplate
+	archiveTemplate   *lib.NameTemplate
 )
 
 func init() {
 	rootCmd.AddCommand(importCmd)
+	addQualityFlags(importCmd)
 	importCmd.Flags().StringVar(&destination, "destination", "", "destination directory to classify the tracks")
-	importCmd.Flags().StringVar(&directoryFormat, "directoryformat", "", "directory format for the tracks")
-	importCmd.Flags().StringVar(&archiveFormat, "archiveformat", "", "archive format for the tracks")
+	importCmd.Flags().StringVar(&directoryFormat, "directoryformat", "", "directory format for the tracks, a Go template like {{.Year}}/{{.Country}}")
+	importCmd.Flags().StringVar(&archiveFormat, "archiveformat", "", "archive format for the tracks, a Go template like {{.Year}}{{.Month}}{{.Day}}_{{slug .Name}}")
+	importCmd.Flags().StringVar(&importMode, "mode", lib.TransferCopy, "how the tracks are imported: copy, move, hardlink or symlink")
+	importCmd.Flags().StringVar(&onConflict, "on-conflict", conflictSkip, "what to do when the target exists: skip, rename, overwrite or keep-best (the track with the best quality)")
+	importCmd.Flags().BoolVar(&skipDuplicates, "skip-duplicates", false, "skip the tracks with the same content as other imported track or a track of the catalog")
+	importCmd.Flags().StringVar(&catalogFile, "catalog", "", "catalog file used with --skip-duplicates and to reuse the metadata of the tracks that didn't change, by default ~/.cache/gotrackmaster/catalog.db")
+	importCmd.Flags().StringVar(&geocoderName, "geocoder", lib.GeocoderOnline, "provider of the addresses: osm (OpenStreetMap Nominatim), geonames (offline) or none")
+	importCmd.Flags().StringVar(&geoNamesDir, "geonames", "", "directory with the GeoNames files cities500.txt and admin1CodesASCII.txt")
+	importCmd.Flags().StringVar(&geocoderCache, "geocodercache", "", "cache file of the osm addresses, by default ~/.cache/gotrackmaster/geocoder.db")
 }
 
-func customFormat(format string, t time.Time, address geo.Address, degree1, degree5, original, kind, creator string, quality float64) string {
-	result := format
-	result = strings.ReplaceAll(result, "{year}", fmt.Sprintf("%d", t.Year()))
-	result = strings.ReplaceAll(result, "{month}", fmt.Sprintf("%02d", t.Month()))
-	result = strings.ReplaceAll(result, "{day}", fmt.Sprintf("%02d", t.Day()))
-	result = strings.ReplaceAll(result, "{hour}", fmt.Sprintf("%02d", t.Hour()))
-	result = strings.ReplaceAll(result, "{minute}", fmt.Sprintf("%02d", t.Minute()))
-	result = strings.ReplaceAll(result, "{country}", address.Country)
-	result = strings.ReplaceAll(result, "{countrycode}", address.CountryCode)
-	result = strings.ReplaceAll(result, "{city}", address.City)
-	result = strings.ReplaceAll(result, "{state}", address.State)
-	result = strings.ReplaceAll(result, "{degree1}", degree1)
-	result = strings.ReplaceAll(result, "{degree0.5}", degree5)
-	result = strings.ReplaceAll(result, "{original}", original)
-	result = strings.ReplaceAll(result, "{kind}", kind)
-	result = strings.ReplaceAll(result, "{creator}", creator)
-	result = strings.ReplaceAll(result, "{quality}", fmt.Sprintf("%0.0f", quality))
-	return result
+// sampleNameData is used to check the formats before the tracks are imported.
+var sampleNameData = lib.NameData{
+	Time:        time.Date(2023, time.March, 5, 9, 27, 0, 0, time.UTC),
+	Country:     "Germany",
+	CountryCode: "DE",
+	City:        "Berlin",
+	State:       "Berlin",
+	EndCity:     "Potsdam",
+	Degree1:     "0",
+	Degree05:    "0",
+	Original:    "original",
+	Kind:        "trail running",
+	Creator:     "Strava",
+	Name:        "Morning run",
+	Quality:     100,
+	Distance:    10.5,
+	Duration:    time.Hour,
+	Gain:        250,
+	Hash:        "0123456789abcdef",
+	Fingerprint: "fedcba9876543210",
 }
 
-func isValidFormat(format string, t time.Time) bool {
-	result := customFormat(format, t, geo.Address{Country: "Germany", CountryCode: "DE", City: "Berlin", State: "Berlin"}, "0", "0", "original", "trail running", "Strava", 100.0)
-
-	badCharMatch, _ := regexp.MatchString(`:|\\|\*|\?|"|<|>|\||\^`, format)
+// parseFormat parses a format and checks it with the fields of a track.
+func parseFormat(name, format string) (*lib.NameTemplate, error) {
+	t, err := lib.ParseNameTemplate(format)
+	if err == nil {
+		_, err = t.Execute(sampleNameData)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s format is wrong: %w", name, err)
+	}
+	return t, nil
+}
 
-	return result != format && !badCharMatch
+// usesField returns true when the directory or the archive format use any of the fields.
+func usesField(fields ...string) bool {
+	return archiveTemplate.Uses(fields...) || (directoryTemplate != nil && directoryTemplate.Uses(fields...))
 }
 
 func isGeoAddress() bool {
-	d, _ := regexp.MatchString(`\{country\}|\{countrycode\}|\{city\}|\{state\}`, directoryFormat)
-	a, _ := regexp.MatchString(`\{country\}|\{countrycode\}|\{city\}|\{state\}`, archiveFormat)
-
-	return a || d
+	return usesField("Country", "CountryCode", "City", "State")
 }
 
 func isDegree1() bool {
-	d, _ := regexp.MatchString(`\{degree1\}`, directoryFormat)
-	a, _ := regexp.MatchString(`\{degree1\}`, archiveFormat)
-
-	return a || d
+	return usesField("Degree1")
 }
 
 func isDegree5() bool {
-	d, _ := regexp.MatchString(`\{degree0.5\}`, directoryFormat)
-	a, _ := regexp.MatchString(`\{degree0.5\}`, archiveFormat)
-
-	return a || d
+	return usesField("Degree05")
 }
 
 func isQuality() bool {
-	d, _ := regexp.MatchString(`\{quality\}`, directoryFormat)
-	a, _ := regexp.MatchString(`\{quality\}`, archiveFormat)
+	return usesField("Quality")
+}
+
+const (
+	conflictSkip      = "skip"
+	conflictRename    = "rename"
+	conflictOverwrite = "overwrite"
+	conflictKeepBest  = "keep-best"
+)
 
-	return a || d
+func validConflict() bool {
+	return onConflict == conflictSkip || onConflict == conflictRename || onConflict == conflictOverwrite || onConflict == conflictKeepBest
 }
 
-func appendTrack(filename string, t time.Time, address geo.Address, gpx []ImportStructure, degree1, degree5, creator string, quality float64) []ImportStructure {
-	file := filepath.Base(filename)
-	extension := filepath.Ext(file)
-	name := file[:len(file)-len(extension)]
-	kind := trackmaster.ClassificationTrack(filename)
+// renameTarget returns the first name with a number added that is not used.
+func renameTarget(archive string, used func(string) bool) string {
+	name := archive
+	for n := 2; used(name); n++ {
+		name = fmt.Sprintf("%s_%d", archive, n)
+	}
+	return name
+}
 
-	e := ImportStructure{
+// appendTrack adds a track to the tracks to import, the tracks with the same name are resolved with the
+// --on-conflict policy in the order of the tracks, so the names are always the same for the same tracks.
+func appendTrack(importGPX []ImportStructure, filename string, data lib.NameData) ([]ImportStructure, error) {
+	file := filepath.Base(filename)
+	extension := strings.ToLower(filepath.Ext(file))
+	data.Original = file[:len(file)-len(extension)]
+
+	var directory string
+	var err error
+	if directoryTemplate != nil {
+		if directory, err = directoryTemplate.Execute(data); err != nil {
+			return importGPX, err
+		}
+	}
+	archive, err := archiveTemplate.Execute(data)
+	if err != nil {
+		return importGPX, err
+	}
+	track := ImportStructure{
 		source:    filename,
-		directory: customFormat(directoryFormat, t, address, degree1, degree5, name, kind, creator, quality),
-		archive:   customFormat(archiveFormat, t, address, degree1, degree5, name, kind, creator, quality),
+		directory: directory,
+		archive:   archive,
+		kind:      data.Kind,
+		quality:   data.Quality,
 	}
-	for _, element := range gpx {
-		if element.directory == e.directory && element.archive == e.archive {
-			lib.Error("Duplicate track: " + filename + " == " + element.source)
-			continue
+
+	// the names are compared ignoring the case for the file systems that are not case sensitive
+	find := func(archive string) int {
+		for i, element := range importGPX {
+			if strings.EqualFold(element.directory, directory) && strings.EqualFold(element.archive, archive) &&
+				strings.EqualFold(filepath.Ext(element.source), extension) {
+				return i
+			}
+		}
+		return -1
+	}
+	i := find(archive)
+	if i < 0 {
+		return append(importGPX, track), nil
+	}
+
+	duplicate := importGPX[i].source
+	switch {
+	case onConflict == conflictRename:
+		track.archive = renameTarget(archive, func(name string) bool { return find(name) >= 0 })
+		lib.Warning(fmt.Sprintf("Duplicate name %s, %s is imported as %s", archive, filename, track.archive))
+		return append(importGPX, track), nil
+	case onConflict == conflictOverwrite || (onConflict == conflictKeepBest && track.quality > importGPX[i].quality):
+		lib.Warning(fmt.Sprintf("Duplicate name %s, %s replaces %s", archive, filename, duplicate))
+		importGPX[i] = track
+	default:
+		lib.Warning(fmt.Sprintf("Duplicate name %s, %s is skipped, it is used by %s", archive, filename, duplicate))
+	}
+	return importGPX, nil
+}
+
+// alreadyImported is the reason of the tracks that are not imported because the target is the same file.
+const alreadyImported = "already imported"
+
+// resolveConflict returns the target where the track is imported when the target exists, an empty target
+// with the reason when the track is not imported. planned contains the targets of all the tracks.
+func resolveConflict(track ImportStructure, target string, planned map[string]bool) (string, string, error) {
+	if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+		return target, "", nil
+	}
+	// the track was imported by a previous import that didn't finish
+	if same, err := lib.SameFile(track.source, target); err == nil && same {
+		return "", alreadyImported, nil
+	}
+
+	switch onConflict {
+	case conflictOverwrite:
+		return target, "", nil
+	case conflictRename:
+		extension := filepath.Ext(target)
+		name := renameTarget(strings.TrimSuffix(target, extension), func(name string) bool {
+			_, err := os.Lstat(name + extension)
+			return err == nil || planned[strings.ToLower(name+extension)]
+		})
+		return name + extension, "", nil
+	case conflictKeepBest:
+		g, err := lib.ReadTrackFile(target)
+		if err != nil {
+			// the existing file is not a valid track
+			return target, "", nil
+		}
+		if quality := trackmaster.Quality(*g, qualityConfig).Quality; quality >= track.quality {
+			return "", fmt.Sprintf("the target has a better quality %0.0f", quality), nil
+		}
+		return target, "", nil
+	}
+	return "", "the target exists", nil
+}
+
+// newGeocoder returns the geocoder selected with --geocoder and the function to close it, the
+// geocoder is nil with none.
+func newGeocoder() (trackmaster.Geocoder, func(), error) {
+	switch geocoderName {
+	case lib.GeocoderNone:
+		return nil, func() {}, nil
+	case lib.GeocoderGeoNames:
+		if geoNamesDir == "" {
+			return nil, nil, errors.New("the geonames geocoder needs the --geonames directory")
+		}
+		g, err := lib.NewGeoNamesGeocoder(geoNamesDir)
+		return g, func() {}, err
+	case lib.GeocoderOnline:
+		if geocoderCache == "" {
+			dir, err := os.UserCacheDir()
+			if err != nil {
+				return nil, nil, err
+			}
+			geocoderCache = filepath.Join(dir, "gotrackmaster", "geocoder.db")
+		}
+		// the usage policy of Nominatim allows one request per second
+		g, err := lib.NewCachedGeocoder(trackmaster.OnlineGeocoder(), geocoderCache, time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		return g, func() { g.Close() }, nil
+	}
+	return nil, nil, errors.New("geocoder must be osm, geonames or none")
+}
+
+// catalogFingerprints returns the path of the tracks of the catalog by their fingerprint.
+func catalogFingerprints(c *lib.Catalog) (map[string]string, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, e := range entries {
+		if _, found := result[e.Fingerprint]; e.Fingerprint != "" && !found {
+			result[e.Fingerprint] = e.Path
 		}
 	}
+	return result, nil
+}
 
-	return append(gpx, e)
+// catalogImportInfo returns the information of a track from its entry of the catalog, nil when the track
+// doesn't have a valid time.
+func catalogImportInfo(g gpx.GPX, e lib.CatalogEntry) *importInfo {
+	if e.Start.IsZero() {
+		return nil
+	}
+	return &importInfo{
+		data: lib.NameData{
+			Time:        e.Start,
+			Creator:     e.Creator,
+			Kind:        e.Classification,
+			Name:        trackmaster.GetName(g),
+			Distance:    e.Distance / 1000,
+			Duration:    time.Duration(e.Elapsed) * time.Second,
+			Gain:        e.Gain,
+			Quality:     e.Quality,
+			Hash:        e.Hash,
+			Fingerprint: e.Fingerprint,
+		},
+		bounds: trackmaster.GetBounds(g),
+		entry:  &e,
+	}
 }
 
-func importExecute() {
+func importExecute(ctx context.Context) error {
+	if err := validQualityConfig(); err != nil {
+		return err
+	}
 	if destination == "" {
-		lib.Error("Destination directory is missing")
-		os.Exit(1)
+		return errors.New("destination directory is missing")
 	}
-	if directoryFormat != "" && !isValidFormat(directoryFormat, time.Now()) {
-		lib.Error("Directory format is wrong")
-		os.Exit(1)
+	if archiveFormat == "" {
+		return errors.New("archive format is missing")
 	}
-	if !isValidFormat(archiveFormat, time.Now()) {
-		lib.Error("Archive format is wrong")
-		os.Exit(1)
+	if !lib.ValidTransferMode(importMode) {
+		return errors.New("mode must be copy, move, hardlink or symlink")
+	}
+	if !validConflict() {
+		return errors.New("on-conflict must be skip, rename, overwrite or keep-best")
+	}
+	var err error
+	directoryTemplate = nil
+	if directoryFormat != "" {
+		if directoryTemplate, err = parseFormat("directory", directoryFormat); err != nil {
+			return err
+		}
+	}
+	if archiveTemplate, err = parseFormat("archive", archiveFormat); err != nil {
+		return err
 	}
 
 	finder, err := tzf.NewDefaultFinder()
 	if err != nil {
-		lib.Error(err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	readTracks()
+	var geocoder trackmaster.Geocoder
+	if isGeoAddress() || usesField("EndCity") {
+		var closeGeocoder func()
+		if geocoder, closeGeocoder, err = newGeocoder(); err != nil {
+			return err
+		}
+		defer closeGeocoder()
+	}
 
-	var importGPX []ImportStructure
-	var address geo.Address
-	var quality float64
+	journal, err := lib.OpenImportJournal(destination)
+	if err != nil {
+		return err
+	}
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+	// the tracks imported by a previous import are not processed again
+	var pendingFiles []lib.TrackFile
+	for _, f := range trackFiles {
+		if !journal.Done(f.Filename) {
+			pendingFiles = append(pendingFiles, f)
+		}
+	}
+	if done := len(trackFiles) - len(pendingFiles); done > 0 {
+		lib.Pass(fmt.Sprintf("Skipping %d tracks already imported", done))
+	}
+	trackFiles = pendingFiles
 
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
+	// the metadata of the tracks that didn't change since the catalog was updated is not calculated again
+	catalog, err := cachedCatalog()
+	if err != nil {
+		return err
+	}
+	if catalog != nil {
+		defer catalog.Close()
+	}
+
+	// the content of the tracks of the catalog and of the imported tracks is not imported again
+	imports := make(map[string]string)
+	if skipDuplicates && catalog != nil {
+		if imports, err = catalogFingerprints(catalog); err != nil {
+			return err
 		}
+	}
 
-		fmt.Printf("Getting info from: %v\n", filename)
+	var importGPX []ImportStructure
 
+	if err := forEachTrack(ctx, func(g gpx.GPX, filename string) *importInfo {
+		if catalog != nil {
+			if e, cached := catalog.Cached(filename); cached {
+				return catalogImportInfo(g, e)
+			}
+		}
 		t := trackmaster.GetTimeStart(g, finder)
 		if t.IsZero() {
-			continue
+			return nil
+		}
+		summary := trackmaster.Summary(g, trackmaster.DefaultSummaryConfig()).Total
+		info := &importInfo{
+			data: lib.NameData{
+				Time:     t,
+				Creator:  trackmaster.GetCreator(g),
+				Kind:     trackmaster.ClassificationTrack(g),
+				Name:     trackmaster.GetName(g),
+				Distance: summary.Distance2D / 1000,
+				Duration: time.Duration(summary.Elapsed) * time.Second,
+				Gain:     summary.Gain,
+			},
+			bounds: trackmaster.GetBounds(g),
+		}
+		if isQuality() || onConflict == conflictKeepBest {
+			info.data.Quality = trackmaster.Quality(g, qualityConfig).Quality
+		}
+		if usesField("Hash") {
+			info.data.Hash, _ = lib.FileHash(filename)
+		}
+		if usesField("Fingerprint") || skipDuplicates {
+			info.data.Fingerprint = trackmaster.Fingerprint(g)
+		}
+		return info
+	}, func(g gpx.GPX, filename string, info *importInfo) {
+		fmt.Fprintf(os.Stderr, "Getting info from: %v\n", filename)
+		if info == nil {
+			return
 		}
-		creator := trackmaster.GetCreator(g)
 
-		if isQuality() {
-			quality = trackmaster.QualityTrack(g)
+		data := info.data
+		if skipDuplicates && data.Fingerprint != "" {
+			// the track itself can be in the catalog
+			path, _ := filepath.Abs(filename)
+			if other, found := imports[data.Fingerprint]; found && other != path {
+				report(trackRecord{
+					Filename: filename,
+					Target:   other,
+					message:  fmt.Sprintf("[%v] skipped, same content as %v", filename, other),
+				})
+				return
+			}
+			imports[data.Fingerprint] = path
+		}
+
+		// the address is searched in order to not flood the geocoding service, the addresses found are
+		// stored in the catalog with the geocoder used
+		e := info.entry
+		if e != nil && e.Geocoder != geocoderName {
+			e.Geocoder, e.StartAddress, e.EndAddress = geocoderName, nil, nil
 		}
+		stored := false
 		if isGeoAddress() {
-			address, _ = trackmaster.GetLocationStart(g)
-		}
-		if isDegree1() || isDegree5() {
-			bounds := trackmaster.GetBounds(g)
-			if trackmaster.IsBoundsValid(bounds) {
-				degree1 := trackmaster.CalculateTiles(bounds, 1)
-				degree5 := trackmaster.CalculateTiles(bounds, 0.5)
-				if isDegree1() {
-					for _, element1 := range degree1 {
-						if isDegree5() {
-							for _, element5 := range degree5 {
-								importGPX = appendTrack(filename, t, address, importGPX, element1, element5, creator, quality)
-							}
-						} else {
-							importGPX = appendTrack(filename, t, address, importGPX, element1, "", creator, quality)
-						}
-					}
-				} else {
-					for _, element5 := range degree5 {
-						importGPX = appendTrack(filename, t, address, importGPX, "", element5, creator, quality)
+			address := trackmaster.MissingAddress
+			if e != nil && e.StartAddress != nil {
+				address = *e.StartAddress
+			} else if geocoder != nil {
+				var err error
+				if address, err = trackmaster.GetLocationStart(g, geocoder); err == nil && e != nil {
+					e.StartAddress, stored = &address, true
+				}
+			}
+			data.Country, data.CountryCode, data.City, data.State = address.Country, address.CountryCode, address.City, address.State
+		}
+		if usesField("EndCity") {
+			data.EndCity = trackmaster.MissingAddress.City
+			if e != nil && e.EndAddress != nil {
+				data.EndCity = e.EndAddress.City
+			} else if geocoder != nil {
+				if address, err := trackmaster.GetLocationEnd(g, geocoder); err == nil {
+					data.EndCity = address.City
+					if e != nil {
+						e.EndAddress, stored = &address, true
 					}
 				}
-			} else {
-				importGPX = appendTrack(filename, t, address, importGPX, "", "", creator, quality)
 			}
-		} else {
-			importGPX = appendTrack(filename, t, address, importGPX, "", "", creator, quality)
 		}
+		if stored {
+			if err := catalog.Put(*e); err != nil {
+				lib.Warning(fmt.Sprintf("The addresses of %s could not be stored in the catalog: %v", filename, err))
+			}
+		}
+
+		var degree1, degree5 []string
+		if trackmaster.IsBoundsValid(info.bounds) {
+			if isDegree1() {
+				degree1 = trackmaster.CalculateTiles(info.bounds, 1)
+			}
+			if isDegree5() {
+				degree5 = trackmaster.CalculateTiles(info.bounds, 0.5)
+			}
+		}
+		// a track is imported once in each tile that it crosses
+		if len(degree1) == 0 {
+			degree1 = []string{""}
+		}
+		if len(degree5) == 0 {
+			degree5 = []string{""}
+		}
+		for _, element1 := range degree1 {
+			for _, element5 := range degree5 {
+				data.Degree1, data.Degree05 = element1, element5
+				var err error
+				if importGPX, err = appendTrack(importGPX, filename, data); err != nil {
+					reportError(filename, "Track could not be named", err)
+					return
+				}
+			}
+		}
+	}); err != nil {
+		return err
 	}
 
 	lib.Pass("Moving tracks...")
 
+	target := func(track ImportStructure) string {
+		return filepath.Join(destination, track.directory, track.archive+strings.ToLower(filepath.Ext(track.source)))
+	}
+	// a track can be imported to several targets, it is only moved to the last one
+	pending := make(map[string]int)
+	planned := make(map[string]bool)
+	for _, element := range importGPX {
+		pending[element.source]++
+		planned[strings.ToLower(target(element))] = true
+	}
+	imported := make(map[string][]string)
+	// the sources with a target that is not imported are not added to the journal, so they are imported again
+	failed := make(map[string]bool)
+	journalAdd := func(source string) error {
+		if dryRun || importMode == lib.TransferMove || pending[source] > 0 || failed[source] {
+			return nil
+		}
+		return journal.Add(source, imported[source])
+	}
+
 	for _, element := range importGPX {
-		target := destination + "/" + element.directory + "/" + element.archive + ".gpx"
-		fmt.Printf("[%v] -> %v\n", element.source, target)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pending[element.source]--
+
+		name, reason, err := resolveConflict(element, target(element), planned)
+		if err != nil {
+			failed[element.source] = true
+			reportError(element.source, "Track could not be imported", err)
+			continue
+		}
+		if name == "" {
+			report(trackRecord{
+				Filename: element.source,
+				Target:   target(element),
+				message:  fmt.Sprintf("[%v] -> %v skipped, %s", element.source, target(element), reason),
+			})
+			if reason != alreadyImported {
+				failed[element.source] = true
+				continue
+			}
+			imported[element.source] = append(imported[element.source], target(element))
+			if err := journalAdd(element.source); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r := trackRecord{
+			Filename:       element.source,
+			Target:         name,
+			Updated:        true,
+			Classification: element.kind,
+			message:        fmt.Sprintf("[%v] -> %v", element.source, name),
+		}
+		if isQuality() {
+			quality := element.quality
+			r.Quality = &quality
+		}
 
 		if !dryRun {
-			err = os.MkdirAll(destination+"/"+element.directory, os.ModePerm)
+			mode := importMode
+			if mode == lib.TransferMove && pending[element.source] > 0 {
+				mode = lib.TransferCopy
+			}
+			err = os.MkdirAll(filepath.Dir(name), os.ModePerm)
+			if err == nil && backup {
+				err = lib.BackupFile(name)
+			}
+			if err == nil {
+				err = lib.TransferFile(element.source, name, mode)
+			}
 			if err != nil {
-				lib.Error(err.Error())
-				os.Exit(1)
+				failed[element.source] = true
+				reportError(element.source, "Track could not be imported", err)
+				continue
 			}
+		}
+		report(r)
 
-			lib.CopyFile(element.source, target)
+		imported[element.source] = append(imported[element.source], name)
+		if err := journalAdd(element.source); err != nil {
+			return err
 		}
 	}
+	return nil
 }
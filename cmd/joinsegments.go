@@ -1,34 +1,32 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var joinSegmentsCmd = &cobra.Command{
 	Use:   "joinsegments",
 	Short: "Joins a segment to an adjacent segment",
-	Run: func(cmd *cobra.Command, args []string) {
-		joinSegmentsExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return joinSegmentsExecute(cmd.Context())
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(joinSegmentsCmd)
-	joinSegmentsCmd.Flags().IntVar(&minPoints, "minpoints", 14, "Defines the minimum points of a segment to join it to the adjacent segment")
+	joinSegmentsCmd.Flags().IntVar(&minPoints, "minpoints", trackmaster.DefaultSegmentPoints, "Defines the minimum points of a segment to join it to the adjacent segment")
 }
 
-func joinSegmentsExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.MoveSegment(g, minPoints, true)
-		writeTrack(g, filename, result)
+func joinSegmentsExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.MoveSegment(g, minPoints, true)
+	}, writeTrack)
 }
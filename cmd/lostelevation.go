@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var lostElevationCmd = &cobra.Command{
 	Use:   "lostelevation",
 	Short: "Fixes elevation when elevation changes abruptly",
-	Run: func(cmd *cobra.Command, args []string) {
-		lostElevationExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return lostElevationExecute(cmd.Context())
 	},
 }
 
@@ -18,16 +20,12 @@ func init() {
 	rootCmd.AddCommand(lostElevationCmd)
 }
 
-func lostElevationExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.LostElevation(g, true)
-		writeTrack(g, filename, result)
+func lostElevationExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.LostElevation(g, true)
+	}, writeTrack)
 }
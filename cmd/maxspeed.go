@@ -1,35 +1,33 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var maxSpeedCmd = &cobra.Command{
 	Use:   "maxspeed",
 	Short: "Remove points using max speed",
-	Run: func(cmd *cobra.Command, args []string) {
-		maxSpeedExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return maxSpeedExecute(cmd.Context())
 	},
 }
 var maxSpeed float64
 
 func init() {
 	rootCmd.AddCommand(maxSpeedCmd)
-	maxSpeedCmd.Flags().Float64Var(&maxSpeed, "maxspeed", 200.0, "set the maximum speed to remove from track")
+	maxSpeedCmd.Flags().Float64Var(&maxSpeed, "maxspeed", trackmaster.DefaultMaxSpeed, "set the maximum speed to remove from track")
 }
 
-func maxSpeedExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.MaxSpeed(g, maxSpeed, true)
-		writeTrack(g, filename, result)
+func maxSpeedExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.MaxSpeed(g, maxSpeed, true)
+	}, writeTrack)
 }
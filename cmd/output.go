@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+// trackRecord is the result of a command for a track, in text mode only the message is shown.
+// Updated is only true when the file has been changed, so it is always false with --dry-run.
+type trackRecord struct {
+	Filename       string                       `json:"filename"`
+	Command        string                       `json:"command"`
+	Updated        bool                         `json:"updated"`
+	Target         string                       `json:"target,omitempty"`
+	Count          int                          `json:"count,omitempty"`
+	Points         []trackmaster.GPXElementInfo `json:"points,omitempty"`
+	Quality        *float64                     `json:"quality,omitempty"`
+	Classification string                       `json:"classification,omitempty"`
+	Data           interface{}                  `json:"data,omitempty"`
+	Diff           *trackmaster.DiffResult      `json:"diff,omitempty"`
+	Error          string                       `json:"error,omitempty"`
+	message        string
+	// write is true when the track must be written before it is reported
+	write bool
+}
+
+var (
+	commandName string
+	records     []trackRecord
+	// trackDiff contains the changes of the track reported with --diff, it is set by forEachTrack
+	trackDiff *trackmaster.DiffResult
+)
+
+func validOutput() bool {
+	return output == outputText || output == outputJSON || output == outputNDJSON
+}
+
+// report shows the result of a track, in JSON mode the records are shown at the end by flushReport.
+func report(r trackRecord) {
+	r.Command = commandName
+	if dryRun {
+		r.Updated = false
+	}
+	switch output {
+	case outputJSON:
+		records = append(records, r)
+	case outputNDJSON:
+		if err := json.NewEncoder(os.Stdout).Encode(r); err != nil {
+			lib.Error(err.Error())
+		}
+	default:
+		if r.Error != "" {
+			fmt.Fprintln(os.Stderr, lib.ColorYellow("Warning: ", lib.ColorRed(r.message)))
+			return
+		}
+		fmt.Println(r.message)
+	}
+}
+
+// errorRecord returns the record of an error processing a track.
+func errorRecord(filename, message string, err error) trackRecord {
+	return trackRecord{
+		Filename: filename,
+		Error:    err.Error(),
+		message:  fmt.Sprintf("%s, error: %v", message, err),
+	}
+}
+
+// reportError shows an error processing a track.
+func reportError(filename, message string, err error) {
+	report(errorRecord(filename, message, err))
+}
+
+// reportTrack writes the track when it is needed and shows the result, it is used by forEachTrack
+// for the commands that build the record in the workers.
+func reportTrack(g gpx.GPX, filename string, r trackRecord) {
+	if r.write {
+		target, err := writeGPX(g, filename)
+		if err != nil {
+			report(errorRecord(filename, "Track could not be written", err))
+			return
+		}
+		if target != filename {
+			r.Target = target
+			r.message += " -> " + target
+		}
+		if trackDiff != nil {
+			r.Diff = trackDiff
+			r.message += "\n" + diffMessage(*trackDiff, verbose)
+		}
+	} else if outputDir != "" && r.Error == "" {
+		// the tracks without changes are written too, so --output-dir contains all the tracks
+		target, err := writeGPX(g, filename)
+		if err != nil {
+			report(errorRecord(filename, "Track could not be written", err))
+			return
+		}
+		r.Target = target
+		r.message += " -> " + target
+	}
+	report(r)
+}
+
+func flushReport() {
+	if output != outputJSON {
+		return
+	}
+	if records == nil {
+		records = []trackRecord{}
+	}
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(records); err != nil {
+		lib.Error(err.Error())
+	}
+	records = nil
+}
@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/ringsaturn/tzf"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var overlapCmd = &cobra.Command{
+	Use:   "overlap",
+	Short: "Search for tracks whose times overlap and optionally trim or splice the overlapping sections",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return overlapExecute(cmd.Context())
+	},
+}
+
+const (
+	overlapTrim   = "trim"
+	overlapSplice = "splice"
+)
+
+var (
+	overlapTolerance float64
+	overlapMinimum   float64
+	overlapFix       string
+)
+
+func init() {
+	rootCmd.AddCommand(overlapCmd)
+	addQualityFlags(overlapCmd)
+	overlapCmd.Flags().Float64Var(&overlapTolerance, "tolerance", 50, "Median distance in meters between the tracks during the overlap to consider them the same activity")
+	overlapCmd.Flags().Float64Var(&overlapMinimum, "minoverlap", 1, "Minimum overlap in seconds that is reported")
+	overlapCmd.Flags().StringVar(&overlapFix, "fix", "", "Fix the overlaps of the same activity: trim removes the overlap from the track with less quality, splice adds that track to the other one and removes it")
+}
+
+// overlapTrack is the time range of a track.
+type overlapTrack struct {
+	filename string
+	start    time.Time
+	end      time.Time
+}
+
+// overlapSource is a track of an overlap read again to compare it.
+type overlapSource struct {
+	filename string
+	g        *gpx.GPX
+	quality  float64
+}
+
+func overlapExecute(ctx context.Context) error {
+	if err := validQualityConfig(); err != nil {
+		return err
+	}
+	if overlapFix != "" && overlapFix != overlapTrim && overlapFix != overlapSplice {
+		return errors.New("fix must be trim or splice")
+	}
+	if overlapTolerance <= 0 {
+		return errors.New("tolerance must be positive")
+	}
+
+	finder, err := tzf.NewDefaultFinder()
+	if err != nil {
+		return err
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	var tracks []overlapTrack
+	if err := forEachTrack(ctx, func(g gpx.GPX, filename string) *overlapTrack {
+		start := trackmaster.GetTimeStart(g, finder)
+		end := trackmaster.GetTimeEnd(g, finder)
+		if start.IsZero() || end.IsZero() {
+			return nil
+		}
+		return &overlapTrack{filename: filename, start: start, end: end}
+	}, func(g gpx.GPX, filename string, t *overlapTrack) {
+		// tracks without valid times
+		if t != nil {
+			tracks = append(tracks, *t)
+		}
+	}); err != nil {
+		return err
+	}
+
+	// the tracks are sorted by start, so only the next tracks that start before the end are compared
+	sort.SliceStable(tracks, func(i, j int) bool {
+		return tracks[i].start.Before(tracks[j].start)
+	})
+	removed := make(map[string]bool)
+	overlaps := 0
+	for i := range tracks {
+		for j := i + 1; j < len(tracks) && tracks[j].start.Before(tracks[i].end); j++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if removed[tracks[i].filename] || removed[tracks[j].filename] {
+				continue
+			}
+			found, err := checkOverlap(tracks[i].filename, tracks[j].filename, removed)
+			if err != nil {
+				reportError(tracks[j].filename, "Overlap could not be checked", err)
+				continue
+			}
+			if found {
+				overlaps++
+			}
+		}
+	}
+	lib.Pass(fmt.Sprintf("Found %d pairs of overlapping tracks", overlaps))
+	return nil
+}
+
+func readOverlapSource(filename string) (overlapSource, error) {
+	g, err := lib.ReadTrackFile(filename)
+	if err != nil {
+		return overlapSource{}, err
+	}
+	return overlapSource{filename: filename, g: g, quality: trackmaster.Quality(*g, qualityConfig).Quality}, nil
+}
+
+// checkOverlap reports the overlap of two tracks and fixes it when they are the same activity, the
+// tracks are read again because a previous fix can have changed them.
+func checkOverlap(first, second string, removed map[string]bool) (bool, error) {
+	a, err := readOverlapSource(first)
+	if err != nil {
+		return false, err
+	}
+	b, err := readOverlapSource(second)
+	if err != nil {
+		return false, err
+	}
+	o := trackmaster.Overlap(*a.g, *b.g, overlapTolerance)
+	if o.Seconds < overlapMinimum {
+		return false, nil
+	}
+
+	status := "different positions"
+	if o.Samples == 0 {
+		status = "positions not comparable"
+	} else if o.Coincident {
+		status = "same positions"
+	}
+	report(trackRecord{
+		Filename: first,
+		Target:   second,
+		Data:     map[string]interface{}{"overlap": o},
+		message: lib.ColorYellow(fmt.Sprintf("[%v] overlaps [%v] %v (%0.0f%%/%0.0f%%), %s, median distance %0.0f m",
+			first, second, time.Duration(o.Seconds)*time.Second, o.Fraction[0]*100, o.Fraction[1]*100, status, o.Distance)),
+	})
+	if overlapFix == "" || !o.Coincident {
+		return true, nil
+	}
+
+	// the track with less quality is fixed, the later one when both have the same quality
+	best, worst := a, b
+	if b.quality > a.quality {
+		best, worst = b, a
+	}
+	if overlapFix == overlapTrim {
+		result := trackmaster.RemoveTimeRange(*worst.g, o.Start, o.End, true)
+		if !trackmaster.TimeEmpty(*worst.g) {
+			writeTrack(*worst.g, worst.filename, result)
+			return true, nil
+		}
+		// the track is inside the overlap, so the other track contains all of it
+		r := trackRecord{
+			Filename: worst.filename,
+			Target:   best.filename,
+			Updated:  true,
+			message:  fmt.Sprintf("[%v] - Removed, it is contained in %v", worst.filename, best.filename),
+		}
+		if outputDir != "" || suffix != "" {
+			r.Updated = false
+			r.message = fmt.Sprintf("[%v] - Skipped, it is contained in %v and would be empty", worst.filename, best.filename)
+		} else if err := removeOverlapTrack(worst.filename, removed); err != nil {
+			return true, err
+		}
+		report(r)
+		return true, nil
+	}
+
+	g := trackmaster.Splice(*best.g, *worst.g)
+	target, err := writeGPX(g, best.filename)
+	if err != nil {
+		return true, err
+	}
+	r := trackRecord{
+		Filename: worst.filename,
+		Target:   target,
+		Updated:  true,
+		message:  fmt.Sprintf("[%v] - Spliced into %v", worst.filename, target),
+	}
+	// the spliced track is removed when the other track is replaced
+	if outputDir == "" && suffix == "" {
+		if err := removeOverlapTrack(worst.filename, removed); err != nil {
+			return true, err
+		}
+	}
+	report(r)
+	return true, nil
+}
+
+// removeOverlapTrack removes a track that is contained in other track, a copy is kept with --backup.
+func removeOverlapTrack(filename string, removed map[string]bool) error {
+	if dryRun {
+		return nil
+	}
+	if backup {
+		if err := lib.BackupFile(filename); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filename); err != nil {
+		return err
+	}
+	removed[filename] = true
+	return nil
+}
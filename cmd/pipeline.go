@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+	"gopkg.in/yaml.v3"
+)
+
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Apply several filters to the tracks in one pass",
+	Long: `Apply several filters to the tracks in one pass, the track is written once at the end.
+
+The steps are given with --step name:param=value,param=value or in a YAML file:
+
+  steps:
+    - timestamp
+    - maxspeed:maxspeed=200
+    - name: removestops
+      params:
+        minseconds: 90
+        maxdistance: 5`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return pipelineExecute(cmd.Context())
+	},
+}
+
+var (
+	pipelineSteps []string
+	pipelineFile  string
+)
+
+func init() {
+	rootCmd.AddCommand(pipelineCmd)
+	pipelineCmd.Flags().StringArrayVar(&pipelineSteps, "step", nil, "add a step to the pipeline, can be repeated")
+	pipelineCmd.Flags().StringVar(&pipelineFile, "pipeline", "", "YAML file with the steps of the pipeline")
+}
+
+// pipelineStep is a step of the YAML file, a string in the same format as --step or a name with parameters.
+type pipelineStep struct {
+	trackmaster.Step
+}
+
+func (s *pipelineStep) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		step, err := trackmaster.ParseStep(value.Value)
+		s.Step = step
+		return err
+	}
+	var step struct {
+		Name   string            `yaml:"name"`
+		Params map[string]string `yaml:"params"`
+	}
+	if err := value.Decode(&step); err != nil {
+		return err
+	}
+	s.Step = trackmaster.Step{Name: step.Name, Params: step.Params}
+	return trackmaster.ValidateStep(s.Step)
+}
+
+func readPipeline() ([]trackmaster.Step, error) {
+	var steps []trackmaster.Step
+	if pipelineFile != "" {
+		data, err := os.ReadFile(pipelineFile)
+		if err != nil {
+			return nil, err
+		}
+		var file struct {
+			Steps []pipelineStep `yaml:"steps"`
+		}
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("%s: %w", pipelineFile, err)
+		}
+		for _, step := range file.Steps {
+			steps = append(steps, step.Step)
+		}
+	}
+	for _, s := range pipelineSteps {
+		step, err := trackmaster.ParseStep(s)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// profileSteps sets the parameters that are not given in the steps with the values of the profile for the
+// command with the same name as the step, like when the command is executed.
+func profileSteps(steps []trackmaster.Step) ([]trackmaster.Step, error) {
+	values, err := loadConfig(rootCmd)
+	if err != nil || values == nil {
+		return steps, err
+	}
+	var result []trackmaster.Step
+	for _, step := range steps {
+		defaults := trackmaster.StepParams(step.Name)
+		params := make(map[string]string)
+		// the values of the command have more priority than the common values
+		for _, section := range []string{configAll, step.Name} {
+			for name, value := range values[section] {
+				if _, ok := defaults[name]; ok {
+					params[name] = fmt.Sprint(value)
+				}
+			}
+		}
+		for name, value := range step.Params {
+			params[name] = value
+		}
+		step = trackmaster.Step{Name: step.Name, Params: params}
+		if err := trackmaster.ValidateStep(step); err != nil {
+			return nil, fmt.Errorf("profile: %w", err)
+		}
+		result = append(result, step)
+	}
+	return result, nil
+}
+
+func pipelineExecute(ctx context.Context) error {
+	steps, err := readPipeline()
+	if err != nil {
+		return err
+	}
+	if steps, err = profileSteps(steps); err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		return errors.New("the pipeline has no steps, use --step or --pipeline")
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
+		results, err := trackmaster.RunPipeline(g, steps)
+		r := trackRecord{Filename: filename, Data: results}
+		var lines []string
+		for i, result := range results {
+			if result.Count > 0 {
+				r.Updated = true
+			}
+			r.Count += result.Count
+			lines = append(lines, fmt.Sprintf("[%v] - %d. %s: %s point(s)", filename, i+1, result.Step.Name, strconv.Itoa(result.Count)))
+		}
+		if err != nil {
+			// the track is not written, so nothing is updated
+			r.Updated = false
+			r.Error = err.Error()
+			r.message = strings.Join(append(lines, fmt.Sprintf("[%v] - pipeline could not be completed, error: %v", filename, err)), "\n")
+			return r
+		}
+
+		if !r.Updated {
+			r.message = strings.Join(append(lines, fmt.Sprintf("[%v] - no updated need", filename)), "\n")
+			return r
+		}
+		r.write = true
+		r.message = strings.Join(append(lines, fmt.Sprintf("[%v] - Pipeline %s", filename, lib.ColorRed(strconv.Itoa(len(results))+" step(s) (updated)"))), "\n")
+		return r
+	}, reportTrack)
+}
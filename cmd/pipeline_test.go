@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPipelineDefaults tests that the steps of a pipeline have the same parameters and defaults as the commands.
+func TestPipelineDefaults(t *testing.T) {
+	for _, name := range trackmaster.PipelineSteps() {
+		cmd, _, err := rootCmd.Find([]string{name})
+		assert.NoError(t, err)
+		assert.Equal(t, name, cmd.Name())
+		for param, value := range trackmaster.StepParams(name) {
+			f := cmd.Flags().Lookup(param)
+			if assert.NotNil(t, f, "%s --%s", name, param) {
+				assert.Equal(t, f.DefValue, value, "%s --%s", name, param)
+			}
+		}
+	}
+}
@@ -1,34 +1,114 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var qualityCmd = &cobra.Command{
 	Use:   "quality",
 	Short: "Show the quality of track",
-	Run: func(cmd *cobra.Command, args []string) {
-		qualityExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return qualityExecute(cmd.Context())
 	},
 }
 
+// qualityPoints is the maximum number of points of each criterion shown in the text output
+const qualityPoints = 10
+
+var (
+	qualityConfig  = trackmaster.DefaultQualityConfig()
+	qualityDetails bool
+)
+
 func init() {
 	rootCmd.AddCommand(qualityCmd)
+	qualityCmd.Flags().BoolVar(&qualityDetails, "details", false, "Show each criterion with its measurement, penalty and points")
+	addQualityFlags(qualityCmd)
+}
+
+// addQualityFlags adds the flags of the weights and the penalties of the quality, they are used by all the
+// commands that compare the quality of the tracks, so they can be set once in the all section of a profile.
+func addQualityFlags(cmd *cobra.Command) {
+	cmd.Flags().Float64Var(&qualityConfig.TimeWeight, "timeweight", qualityConfig.TimeWeight, "weight of the quality of the time")
+	cmd.Flags().Float64Var(&qualityConfig.ElevationWeight, "elevationweight", qualityConfig.ElevationWeight, "weight of the quality of the elevation")
+	cmd.Flags().Float64Var(&qualityConfig.DistanceWeight, "distanceweight", qualityConfig.DistanceWeight, "weight of the quality of the positions")
+	cmd.Flags().Float64Var(&qualityConfig.SparsePenalty, "sparsepenalty", qualityConfig.SparsePenalty, "penalty when the mean distance between points is greater than 8 m")
+	cmd.Flags().Float64Var(&qualityConfig.VerySparsePenalty, "verysparsepenalty", qualityConfig.VerySparsePenalty, "additional penalty when the mean distance between points is greater than 30 m")
+	cmd.Flags().Float64Var(&qualityConfig.IntersectionPenalty, "intersectionpenalty", qualityConfig.IntersectionPenalty, "penalty of each point of an intersection")
+	cmd.Flags().Float64Var(&qualityConfig.FirstNoisePenalty, "firstnoisepenalty", qualityConfig.FirstNoisePenalty, "penalty of each point of noise at the beginning")
+	cmd.Flags().Float64Var(&qualityConfig.ClosePointPenalty, "closepointpenalty", qualityConfig.ClosePointPenalty, "penalty of each point very close to the previous one")
+	cmd.Flags().Float64Var(&qualityConfig.NoisePenalty, "noisepenalty", qualityConfig.NoisePenalty, "penalty of each point of intense noise")
+	cmd.Flags().IntVar(&qualityConfig.ReferencePoints, "referencepoints", qualityConfig.ReferencePoints, "the penalties of the points are scaled to a track with this number of points, 0 to disable")
 }
 
-func qualityExecute() {
-	readTracks()
+// validQualityConfig checks the weights and the reference points of the quality.
+func validQualityConfig() error {
+	if qualityConfig.TimeWeight < 0 || qualityConfig.ElevationWeight < 0 || qualityConfig.DistanceWeight < 0 {
+		return errors.New("weights must be positive")
+	}
+	if qualityConfig.TimeWeight+qualityConfig.ElevationWeight+qualityConfig.DistanceWeight == 0 {
+		return errors.New("at least one weight must be greater than 0")
+	}
+	if qualityConfig.ReferencePoints < 0 {
+		return errors.New("reference points must be positive")
+	}
+	return nil
+}
 
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
+// qualityCriterion returns a line with the measurement, the penalty and the first points of a criterion.
+func qualityCriterion(c trackmaster.QualityCriterion) string {
+	s := fmt.Sprintf("  %s %s: %0.2f, penalty %0.2f", c.Group, c.Name, c.Measurement, c.Penalty)
+	if len(c.Points) == 0 {
+		return s
+	}
+	var points []string
+	for i, p := range c.Points {
+		if i == qualityPoints {
+			points = append(points, fmt.Sprintf("... %d more", len(c.Points)-qualityPoints))
+			break
 		}
-		quality := trackmaster.QualityTrack(g)
-		fmt.Printf("[%v] - %s\n", filename, lib.ColorGreen(quality))
+		points = append(points, fmt.Sprintf("%d/%d/%d", p.TrkTypeNo, p.TrkSegTypeNo, p.WptTypeNo))
+	}
+	return s + ", points (track/segment/point) " + strings.Join(points, ", ")
+}
+
+func qualityExecute(ctx context.Context) error {
+	if err := validQualityConfig(); err != nil {
+		return err
 	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackmaster.QualityReport {
+		return trackmaster.Quality(g, qualityConfig)
+	}, func(g gpx.GPX, filename string, r trackmaster.QualityReport) {
+		quality := r.Quality
+		message := fmt.Sprintf("[%v] - %s", filename, lib.ColorGreen(quality))
+		var data interface{}
+		if qualityDetails {
+			data = r
+			message += fmt.Sprintf(" (time %0.0f, elevation %0.0f, distance %0.2f)", r.Time, r.Elevation, r.Distance)
+			for _, c := range r.Criteria {
+				if c.Measurement != 0 || c.Penalty != 0 {
+					message += "\n" + qualityCriterion(c)
+				}
+			}
+		}
+		report(trackRecord{
+			Filename: filename,
+			Quality:  &quality,
+			Data:     data,
+			message:  message,
+		})
+	})
 }
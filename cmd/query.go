@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query",
+	Short: "Searches the tracks of the catalog",
+	Long: `Searches the tracks of the catalog updated with the catalog command, the tracks are shown sorted by start time.
+Example: gotrackmaster query --activity "Cycling Mountain" --from 2022-01-01 --bbox 0.1,40.5,0.5,41`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return queryExecute()
+	},
+}
+
+var (
+	queryActivity    string
+	queryCreator     string
+	queryFingerprint string
+	queryFrom        string
+	queryTo          string
+	queryBBox        string
+	queryMinDistance float64
+	queryMaxDistance float64
+	queryMinGain     float64
+	queryMaxGain     float64
+	queryMinQuality  float64
+)
+
+func init() {
+	rootCmd.AddCommand(queryCmd)
+	queryCmd.Flags().StringVar(&catalogFile, "catalog", "", "catalog file, by default ~/.cache/gotrackmaster/catalog.db")
+	queryCmd.Flags().StringVar(&queryActivity, "activity", "", "classification of the tracks, e.g. Cycling or \"Cycling Mountain\"")
+	queryCmd.Flags().StringVar(&queryCreator, "creator", "", "device or application that recorded the tracks")
+	queryCmd.Flags().StringVar(&queryFingerprint, "fingerprint", "", "fingerprint of the content of the tracks, shown with --output json")
+	queryCmd.Flags().StringVar(&queryFrom, "from", "", "tracks started on or after the date (YYYY-MM-DD)")
+	queryCmd.Flags().StringVar(&queryTo, "to", "", "tracks started before the date (YYYY-MM-DD)")
+	queryCmd.Flags().StringVar(&queryBBox, "bbox", "", "tracks that cross the box minLon,minLat,maxLon,maxLat")
+	queryCmd.Flags().Float64Var(&queryMinDistance, "mindistance", 0, "minimum distance in kilometers")
+	queryCmd.Flags().Float64Var(&queryMaxDistance, "maxdistance", 0, "maximum distance in kilometers")
+	queryCmd.Flags().Float64Var(&queryMinGain, "mingain", 0, "minimum elevation gain in meters")
+	queryCmd.Flags().Float64Var(&queryMaxGain, "maxgain", 0, "maximum elevation gain in meters")
+	queryCmd.Flags().Float64Var(&queryMinQuality, "minquality", 0, "minimum quality of the tracks")
+}
+
+// parseBBox parses a box in the format minLon,minLat,maxLon,maxLat.
+func parseBBox(s string) (*gpx.BoundsType, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+	var values [4]float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		values[i] = v
+	}
+	return &gpx.BoundsType{MinLon: values[0], MinLat: values[1], MaxLon: values[2], MaxLat: values[3]}, nil
+}
+
+// parseDate parses a date of the query, the dates are compared with the date of the tracks in their time zone.
+func parseDate(name, s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return t, fmt.Errorf("%s must be a date YYYY-MM-DD", name)
+	}
+	return t, nil
+}
+
+func queryExecute() error {
+	q := lib.CatalogQuery{
+		Classification: queryActivity,
+		Creator:        queryCreator,
+		Fingerprint:    queryFingerprint,
+		MinDistance:    queryMinDistance * 1000,
+		MaxDistance:    queryMaxDistance * 1000,
+		MinGain:        queryMinGain,
+		MaxGain:        queryMaxGain,
+		MinQuality:     queryMinQuality,
+	}
+	var err error
+	if q.From, err = parseDate("from", queryFrom); err != nil {
+		return err
+	}
+	if q.To, err = parseDate("to", queryTo); err != nil {
+		return err
+	}
+	if queryBBox != "" {
+		if q.BBox, err = parseBBox(queryBBox); err != nil {
+			return err
+		}
+	}
+
+	c, err := openCatalog()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	entries, err := c.Query(q)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		quality := e.Quality
+		report(trackRecord{
+			Filename:       e.Path,
+			Classification: e.Classification,
+			Quality:        &quality,
+			Data:           e,
+			message: fmt.Sprintf("%v  %s  %.2f km  %.0f m  %s  %s/%0.0f", e.Path, e.Start.Format("2006-01-02 15:04"),
+				e.Distance/1000, e.Gain, e.Classification, e.Creator, e.Quality),
+		})
+	}
+	return nil
+}
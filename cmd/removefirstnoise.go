@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var removeFirstNoiseCmd = &cobra.Command{
 	Use:   "removefirstnoise",
 	Short: "Removes noise from the first generated points of the track due to poor signal quality",
-	Run: func(cmd *cobra.Command, args []string) {
-		removeFirstNoiseExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeFirstNoiseExecute(cmd.Context())
 	},
 }
 
@@ -18,17 +20,12 @@ func init() {
 	rootCmd.AddCommand(removeFirstNoiseCmd)
 }
 
-func removeFirstNoiseExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.RemoveFirstNoise(g, true)
-
-		writeTrack(g, filename, result)
+func removeFirstNoiseExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.RemoveFirstNoise(g, true)
+	}, writeTrack)
 }
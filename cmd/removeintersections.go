@@ -1,34 +1,32 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var removeIntersectionsCmd = &cobra.Command{
 	Use:   "removeintersections",
 	Short: "Remove intersections on the track",
-	Run: func(cmd *cobra.Command, args []string) {
-		removeIntersectionsExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeIntersectionsExecute(cmd.Context())
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(removeIntersectionsCmd)
-	removeIntersectionsCmd.Flags().IntVar(&maxPoints, "maxpoints", 6, "set the maximum amount of points")
+	removeIntersectionsCmd.Flags().IntVar(&maxPoints, "maxpoints", trackmaster.DefaultIntersectionPoints, "set the maximum amount of points")
 }
 
-func removeIntersectionsExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.RemoveIntersections(g, maxPoints, true)
-		writeTrack(g, filename, result)
+func removeIntersectionsExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.RemoveIntersections(g, maxPoints, true)
+	}, writeTrack)
 }
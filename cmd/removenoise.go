@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var removeNoiseCmd = &cobra.Command{
 	Use:   "removenoise",
 	Short: "Remove intense noise on the track",
-	Run: func(cmd *cobra.Command, args []string) {
-		removeNoiseExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeNoiseExecute(cmd.Context())
 	},
 }
 
@@ -18,21 +20,18 @@ var maxPoints int
 
 func init() {
 	rootCmd.AddCommand(removeNoiseCmd)
-	removeNoiseCmd.Flags().Float64Var(&maxDistance, "maxdistance", 6.0, "set the maximum distance allowed within a stop")
-	removeNoiseCmd.Flags().Float64Var(&maxElevation, "maxelevation", 1.1, "set the maximum lift allowed within a stop")
-	removeNoiseCmd.Flags().IntVar(&maxPoints, "maxpoints", 4, "set the maximum amount of points")
+	noise := trackmaster.DefaultNoiseConfig()
+	removeNoiseCmd.Flags().Float64Var(&maxDistance, "maxdistance", noise.MaxDistance, "set the maximum distance allowed within a stop")
+	removeNoiseCmd.Flags().Float64Var(&maxElevation, "maxelevation", noise.MaxElevation, "set the maximum lift allowed within a stop")
+	removeNoiseCmd.Flags().IntVar(&maxPoints, "maxpoints", noise.MaxPoints, "set the maximum amount of points")
 }
 
-func removeNoiseExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.RemoveNoise(g, maxDistance, maxElevation, maxPoints, true)
-		writeTrack(g, filename, result)
+func removeNoiseExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.RemoveNoise(g, maxDistance, maxElevation, maxPoints, true)
+	}, writeTrack)
 }
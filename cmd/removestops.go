@@ -1,16 +1,18 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var removeStopsCmd = &cobra.Command{
 	Use:   "removestops",
 	Short: "Remove stops on a track",
-	Run: func(cmd *cobra.Command, args []string) {
-		removeStopsExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeStopsExecute(cmd.Context())
 	},
 }
 
@@ -23,22 +25,19 @@ var (
 
 func init() {
 	rootCmd.AddCommand(removeStopsCmd)
-	removeStopsCmd.Flags().Float64Var(&maxDistance, "maxdistance", 5.0, "set the maximum distance allowed within a stop")
-	removeStopsCmd.Flags().Float64Var(&minSeconds, "minseconds", 90.0, "set the minimum time that is considered a stop")
-	removeStopsCmd.Flags().Float64Var(&maxElevation, "maxelevation", 0.5, "set the maximum lift allowed within a stop")
-	removeStopsCmd.Flags().IntVar(&minPoints, "minpoints", 3, "set the minimum amount of points")
+	stops := trackmaster.DefaultStopsConfig()
+	removeStopsCmd.Flags().Float64Var(&maxDistance, "maxdistance", stops.MaxDistance, "set the maximum distance allowed within a stop")
+	removeStopsCmd.Flags().Float64Var(&minSeconds, "minseconds", stops.MinSeconds, "set the minimum time that is considered a stop")
+	removeStopsCmd.Flags().Float64Var(&maxElevation, "maxelevation", stops.MaxElevation, "set the maximum lift allowed within a stop")
+	removeStopsCmd.Flags().IntVar(&minPoints, "minpoints", stops.MinPoints, "set the minimum amount of points")
 }
 
-func removeStopsExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.RemoveStops(g, minSeconds, maxDistance, maxElevation, minPoints, true)
-		writeTrack(g, filename, result)
+func removeStopsExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.RemoveStops(g, minSeconds, maxDistance, maxElevation, minPoints, true)
+	}, writeTrack)
 }
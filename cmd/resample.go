@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var resampleCmd = &cobra.Command{
+	Use:   "resample",
+	Short: "Resample the tracks to a point every fixed time or distance",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return resampleExecute(cmd.Context())
+	},
+}
+
+var (
+	resampleMode     string
+	resampleInterval float64
+	decimate         bool
+)
+
+func init() {
+	rootCmd.AddCommand(resampleCmd)
+	resampleCmd.Flags().StringVar(&resampleMode, "mode", trackmaster.ResampleTime, "resample by time or distance")
+	resampleCmd.Flags().Float64Var(&resampleInterval, "interval", trackmaster.DefaultResampleInterval, "set the seconds or meters between points")
+	resampleCmd.Flags().BoolVar(&decimate, "decimate", false, "remove the points closer than the interval without interpolating")
+}
+
+func resampleExecute(ctx context.Context) error {
+	if resampleMode != trackmaster.ResampleTime && resampleMode != trackmaster.ResampleDistance {
+		return errors.New("mode must be time or distance")
+	}
+	if resampleInterval <= 0 {
+		return errors.New("interval must be greater than zero")
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
+		if decimate {
+			return fixRecord(filename, trackmaster.Decimate(g, resampleMode, resampleInterval, true))
+		}
+
+		before := trackmaster.PointCount(g)
+		if !trackmaster.Resample(g, resampleMode, resampleInterval) {
+			return trackRecord{Filename: filename, message: fmt.Sprintf("[%v] - no updated need", filename)}
+		}
+		after := trackmaster.PointCount(g)
+		return trackRecord{
+			Filename: filename,
+			Updated:  true,
+			Count:    after,
+			Data:     map[string]int{"before": before, "after": after},
+			message:  fmt.Sprintf("[%v] - Resample %d to %d points %s", filename, before, after, lib.ColorRed(" (updated)")),
+			write:    true,
+		}
+	}, reportTrack)
+}
@@ -1,10 +1,15 @@
 package cmd
 
 import (
-	"encoding/xml"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
@@ -14,10 +19,22 @@ import (
 )
 
 var (
-	dryRun  bool
-	force   bool
-	verbose bool
-	track   string
+	dryRun     bool
+	force      bool
+	verbose    bool
+	track      string
+	outFormat  string
+	configPath string
+	profile    string
+	output     string
+	jobs       int
+	outputDir  string
+	suffix     string
+	backup     bool
+	showDiff   bool
+	trackFiles []lib.TrackFile
+	// trackDir is the directory of --track, the tree mirrored in --output-dir
+	trackDir string
 )
 
 var rootCmd = &cobra.Command{
@@ -29,6 +46,19 @@ track simplification, and more. Ideal for outdoor enthusiasts, athletes,
 and GIS professionals seeking insights from their GPX data.`,
 	Version: "1.0.0",
 	Args:    cobra.MinimumNArgs(1),
+	// the errors are shown by Execute
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+		if !validOutput() {
+			return fmt.Errorf("output must be text, json or ndjson")
+		}
+		commandName = cmd.Name()
+		return nil
+	},
 }
 
 func init() {
@@ -36,70 +66,113 @@ func init() {
 	rootCmd.PersistentFlags().BoolVar(&force, "force", false, "Force update even overwriting previous GPS data")
 	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Show more information")
 	rootCmd.PersistentFlags().StringVar(&track, "track", "", "GPX track or a directory of GPX tracks")
+	rootCmd.PersistentFlags().StringVar(&outFormat, "outformat", "", "Format of the written tracks (gpx, fit, tcx, geojson, kml, kmz, csv), by default the format of the original track")
+	rootCmd.PersistentFlags().StringVar(&outputDir, "output-dir", "", "Directory where the tracks are written mirroring the input tree, by default the original tracks are overwritten")
+	rootCmd.PersistentFlags().StringVar(&suffix, "suffix", "", "Suffix added to the name of the written tracks, e.g. _clean or _clean.gpx")
+	rootCmd.PersistentFlags().BoolVar(&backup, "backup", false, "Keep a copy with the .orig extension of the tracks that are overwritten")
+	rootCmd.PersistentFlags().BoolVar(&showDiff, "diff", false, "Show the points removed, inserted and moved in each track, all the points with --verbose")
+	rootCmd.PersistentFlags().IntVar(&jobs, "jobs", runtime.NumCPU(), "Number of tracks processed at the same time")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Configuration file with the profiles, by default ~/.config/gotrackmaster/config.yaml")
+	rootCmd.PersistentFlags().StringVar(&output, "output", outputText, "Output of the results (text, json, ndjson), the logs are written to stderr")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "Profile of the configuration file used for the default values of the flags")
 }
 
 func Execute() {
-	cobra.CheckErr(rootCmd.Execute())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := rootCmd.ExecuteContext(ctx)
+	// the results are written even when the command fails
+	flushReport()
+	cobra.CheckErr(err)
 }
 
-func writeGPX(g gpx.GPX, filename string) {
-	if dryRun {
-		return
+// outputFilename returns the file where a track is written, the original track unless --output-dir,
+// --suffix or --outformat are used.
+func outputFilename(filename string) (string, error) {
+	target := filename
+	if outputDir != "" {
+		rel, err := filepath.Rel(trackDir, filename)
+		if err != nil {
+			rel = filepath.Base(filename)
+		}
+		target = filepath.Join(outputDir, rel)
 	}
 
-	f, err := os.Create(filename)
-	if err != nil {
-		lib.Error(err.Error())
-		return
+	if suffix != "" {
+		ext := filepath.Ext(target)
+		if filepath.Ext(suffix) != "" {
+			target = strings.TrimSuffix(target, ext) + suffix
+		} else {
+			target = strings.TrimSuffix(target, ext) + suffix + ext
+		}
 	}
-	defer f.Close()
 
-	// write xml header
-	_, err = f.WriteString(xml.Header)
-	if err != nil {
-		lib.Error(err.Error())
-		return
+	if outFormat != "" {
+		format, err := lib.FormatByName(outFormat)
+		if err != nil {
+			return "", err
+		}
+		target = lib.ChangeExtension(target, format)
 	}
+	return target, nil
+}
 
-	if err := g.WriteIndent(f, "", "  "); err != nil {
-		lib.Error(err.Error())
+// writeGPX writes the track and returns the file where it is written.
+func writeGPX(g gpx.GPX, filename string) (string, error) {
+	target, err := outputFilename(filename)
+	if err != nil || dryRun {
+		return target, err
 	}
-}
 
-func readTracks() {
-	if verbose {
-		trackmaster.Log.SetLevel(logrus.DebugLevel)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return target, err
 	}
-	lib.ReadTracks(track)
-	if len(lib.Tracks) == 0 {
-		lib.Error("No tracks found")
-		os.Exit(1)
+	if backup {
+		if err := lib.BackupFile(target); err != nil {
+			return target, err
+		}
 	}
-	lib.Pass("Processing tracks...")
+	return target, lib.WriteTrackFile(g, target)
 }
 
-func readTrack(filename string) (gpx.GPX, error) {
-	f, err := os.Open(filename)
-	if err != nil {
-		fmt.Println(lib.ColorYellow("Warning: GPX file could not be processed, error: ", lib.ColorRed(err)))
-		return gpx.GPX{}, err
+// readTracks locates the tracks of --track that are processed by forEachTrack.
+func readTracks(ctx context.Context) error {
+	if verbose {
+		trackmaster.Log.SetLevel(logrus.DebugLevel)
 	}
-	defer f.Close()
+	lib.Pass("Reading tracks...")
 
-	g, err := gpx.Read(f)
+	var err error
+	trackFiles, err = lib.NewLoader().Load(ctx, track)
 	if err != nil {
-		fmt.Println(lib.ColorYellow("Warning: GPX file could not be processed, error: ", lib.ColorRed(err)))
-		return gpx.GPX{}, err
+		return err
+	}
+	if len(trackFiles) == 0 {
+		return errors.New("no tracks found")
+	}
+	trackDir = track
+	if fileInfo, err := os.Stat(track); err == nil && !fileInfo.IsDir() {
+		trackDir = filepath.Dir(track)
 	}
 
-	return *g, nil
+	fmt.Fprintf(os.Stderr, lib.ColorGreen("Located %d track(s)\n"), len(trackFiles))
+	lib.Pass("Processing tracks...")
+	return nil
 }
 
 func writeTrack(g gpx.GPX, filename string, result []trackmaster.GPXElementInfo) {
+	reportTrack(g, filename, fixRecord(filename, result))
+}
+
+// fixRecord returns the record of a filter that returns the points changed.
+func fixRecord(filename string, result []trackmaster.GPXElementInfo) trackRecord {
+	r := trackRecord{Filename: filename, Points: result, Count: len(result)}
 	if len(result) == 0 {
-		fmt.Printf("[%v] - no updated need\n", filename)
-	} else {
-		writeGPX(g, filename)
-		fmt.Printf("[%v] - Fixing %s point(s)\n", filename, lib.ColorRed(strconv.Itoa(len(result))+" (updated)"))
+		r.message = fmt.Sprintf("[%v] - no updated need", filename)
+		return r
 	}
+	r.Updated = true
+	r.write = true
+	r.message = fmt.Sprintf("[%v] - Fixing %s point(s)", filename, lib.ColorRed(strconv.Itoa(len(result))+" (updated)"))
+	return r
 }
@@ -1,38 +1,59 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"math"
 
-	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var simplifyPointsCmd = &cobra.Command{
 	Use:   "simplifypoints",
-	Short: "Simplify the track by removing very close points",
-	Run: func(cmd *cobra.Command, args []string) {
-		simplifyPointsExecute()
+	Short: "Simplify the track by removing very close points or with line simplification",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return simplifyPointsExecute(cmd.Context())
 	},
 }
-var distance float64
+
+var (
+	distance       float64
+	algorithm      string
+	tolerance      float64
+	simplifyPoints int
+	simplifyArea   float64
+	simplify3D     bool
+)
 
 func init() {
 	rootCmd.AddCommand(simplifyPointsCmd)
-	simplifyPointsCmd.Flags().Float64Var(&distance, "distance", 0.5, "set minimum distance of the points to join them")
+	simplify := trackmaster.DefaultSimplifyConfig()
+	simplifyPointsCmd.Flags().Float64Var(&distance, "distance", simplify.Distance, "set minimum distance of the points to join them")
+	simplifyPointsCmd.Flags().StringVar(&algorithm, "algorithm", simplify.Algorithm, "simplification algorithm (distance, douglas-peucker, visvalingam)")
+	simplifyPointsCmd.Flags().Float64Var(&tolerance, "tolerance", simplify.Tolerance, "set the maximum distance in meters of the removed points to the simplified line (douglas-peucker)")
+	simplifyPointsCmd.Flags().IntVar(&simplifyPoints, "points", simplify.Points, "set the number of points to keep by segment, the simplification stops with the first rule that is reached, use --area 0 to only use this rule (visvalingam)")
+	simplifyPointsCmd.Flags().Float64Var(&simplifyArea, "area", simplify.Area, "set the minimum area in square meters of the kept points (visvalingam)")
+	simplifyPointsCmd.Flags().BoolVar(&simplify3D, "3d", simplify.ThreeD, "use the elevation in the simplification")
 }
 
-func simplifyPointsExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.RemoveStops(g, 0.0, distance, math.MaxFloat64, 0, true)
+func simplifyPointsExecute(ctx context.Context) error {
+	if algorithm != "distance" && algorithm != "douglas-peucker" && algorithm != "visvalingam" {
+		return errors.New("algorithm must be distance, douglas-peucker or visvalingam")
+	}
 
-		writeTrack(g, filename, result)
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		switch algorithm {
+		case "douglas-peucker":
+			return trackmaster.SimplifyDouglasPeucker(g, tolerance, simplify3D, true)
+		case "visvalingam":
+			return trackmaster.SimplifyVisvalingam(g, simplifyPoints, simplifyArea, simplify3D, true)
+		}
+		return trackmaster.RemoveStops(g, 0.0, distance, math.MaxFloat64, 0, true)
+	}, writeTrack)
 }
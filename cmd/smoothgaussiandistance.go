@@ -1,18 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var smoothGaussianDistanceCmd = &cobra.Command{
 	Use:   "smoothgaussiandistance",
 	Short: "Uses the Gaussian smoothing algorithm on track coordinates",
-	Run: func(cmd *cobra.Command, args []string) {
-		smoothGaussianDistanceExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return smoothGaussianDistanceExecute(cmd.Context())
 	},
 }
 
@@ -23,21 +25,26 @@ var (
 
 func init() {
 	rootCmd.AddCommand(smoothGaussianDistanceCmd)
-	smoothGaussianDistanceCmd.Flags().IntVar(&windowSize, "windowsize", 1, "defines the window size used in the algorithm")
-	smoothGaussianDistanceCmd.Flags().Float64Var(&sigma, "sigma", 1.1, "defines the sigma used in the algorithm")
+	gaussian := trackmaster.DefaultGaussianConfig()
+	smoothGaussianDistanceCmd.Flags().IntVar(&windowSize, "windowsize", gaussian.WindowSize, "defines the window size used in the algorithm")
+	smoothGaussianDistanceCmd.Flags().Float64Var(&sigma, "sigma", gaussian.Sigma, "defines the sigma used in the algorithm")
 }
 
-func smoothGaussianDistanceExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
+func smoothGaussianDistanceExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
 
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) int {
 		trackmaster.SmoothGaussian(g, windowSize, sigma)
-		writeGPX(g, filename)
-		fmt.Printf("[%v] - Smooth Gaussian distance %s\n", filename, lib.ColorRed(" (updated)"))
-	}
+		return trackmaster.PointCount(g)
+	}, func(g gpx.GPX, filename string, count int) {
+		reportTrack(g, filename, trackRecord{
+			Filename: filename,
+			Updated:  true,
+			Count:    count,
+			message:  fmt.Sprintf("[%v] - Smooth Gaussian distance %s", filename, lib.ColorRed(" (updated)")),
+			write:    true,
+		})
+	})
 }
@@ -1,34 +1,32 @@
 package cmd
 
 import (
-	"github.com/inode64/gotrackmaster/lib"
+	"context"
+
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var smoothGaussianElevationCmd = &cobra.Command{
 	Use:   "smoothgaussianelevation",
 	Short: "Uses the Gaussian smoothing algorithm to adjust elevation",
-	Run: func(cmd *cobra.Command, args []string) {
-		smoothGaussianElevationExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return smoothGaussianElevationExecute(cmd.Context())
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(smoothGaussianElevationCmd)
-	smoothGaussianElevationCmd.Flags().Float64Var(&maxElevation, "maxelevation", 1.5, "defines the maximum vertical speed to perform a smoothing")
+	smoothGaussianElevationCmd.Flags().Float64Var(&maxElevation, "maxelevation", trackmaster.DefaultMaxSpeedVertical, "defines the maximum vertical speed to perform a smoothing")
 }
 
-func smoothGaussianElevationExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
-
-		result := trackmaster.MaxSpeedVertical(g, maxElevation, true)
-		writeTrack(g, filename, result)
+func smoothGaussianElevationExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
 	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) []trackmaster.GPXElementInfo {
+		return trackmaster.MaxSpeedVertical(g, maxElevation, true)
+	}, writeTrack)
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var smoothKalmanCmd = &cobra.Command{
+	Use:   "smoothkalman",
+	Short: "Uses a Kalman filter and a backward smoother on track coordinates and elevation",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return smoothKalmanExecute(cmd.Context())
+	},
+}
+
+var kalmanConfig = trackmaster.DefaultKalmanConfig()
+
+func init() {
+	rootCmd.AddCommand(smoothKalmanCmd)
+	smoothKalmanCmd.Flags().Float64Var(&kalmanConfig.Accuracy, "accuracy", kalmanConfig.Accuracy, "defines the horizontal error in meters of the points without hdop")
+	smoothKalmanCmd.Flags().Float64Var(&kalmanConfig.ElevationAccuracy, "elevationaccuracy", kalmanConfig.ElevationAccuracy, "defines the vertical error in meters of the points without vdop")
+	smoothKalmanCmd.Flags().Float64Var(&kalmanConfig.DOPFactor, "dopfactor", kalmanConfig.DOPFactor, "defines the factor to convert hdop and vdop to meters")
+	smoothKalmanCmd.Flags().Float64Var(&kalmanConfig.Acceleration, "acceleration", kalmanConfig.Acceleration, "defines the expected horizontal acceleration in m/s²")
+	smoothKalmanCmd.Flags().Float64Var(&kalmanConfig.ElevationAcceleration, "elevationacceleration", kalmanConfig.ElevationAcceleration, "defines the expected vertical acceleration in m/s²")
+}
+
+func smoothKalmanExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) int {
+		trackmaster.SmoothKalman(g, kalmanConfig)
+		return trackmaster.PointCount(g)
+	}, func(g gpx.GPX, filename string, count int) {
+		reportTrack(g, filename, trackRecord{
+			Filename: filename,
+			Updated:  true,
+			Count:    count,
+			message:  fmt.Sprintf("[%v] - Smooth Kalman %s", filename, lib.ColorRed(" (updated)")),
+			write:    true,
+		})
+	})
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show distance, time, elevation and speed statistics of the tracks",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return statsExecute(cmd.Context())
+	},
+}
+
+var (
+	statsFormat   string
+	statsSegments bool
+	summaryConfig = trackmaster.DefaultSummaryConfig()
+)
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().StringVar(&statsFormat, "format", "table", "output format (table, json, csv)")
+	statsCmd.Flags().BoolVar(&statsSegments, "segments", false, "show the statistics of each track and segment")
+	statsCmd.Flags().Float64Var(&summaryConfig.Hysteresis, "hysteresis", summaryConfig.Hysteresis, "set the minimum elevation change counted as gain or loss")
+	statsCmd.Flags().Float64Var(&summaryConfig.StopSeconds, "minseconds", summaryConfig.StopSeconds, "set the minimum time that is considered a stop")
+	statsCmd.Flags().Float64Var(&summaryConfig.StopDistance, "maxdistance", summaryConfig.StopDistance, "set the maximum distance allowed within a stop")
+}
+
+type statsRecord struct {
+	Filename string                    `json:"filename"`
+	Summary  trackmaster.SummaryResult `json:"summary"`
+}
+
+func statsExecute(ctx context.Context) error {
+	if statsFormat != "table" && statsFormat != "json" && statsFormat != "csv" {
+		return errors.New("output format must be table, json or csv")
+	}
+
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
+
+	var records []statsRecord
+	if err := forEachTrack(ctx, func(g gpx.GPX, filename string) trackmaster.SummaryResult {
+		return trackmaster.Summary(g, summaryConfig)
+	}, func(g gpx.GPX, filename string, summary trackmaster.SummaryResult) {
+		records = append(records, statsRecord{Filename: filename, Summary: summary})
+	}); err != nil {
+		return err
+	}
+
+	if output != outputText {
+		for _, record := range records {
+			report(trackRecord{Filename: record.Filename, Data: record.Summary})
+		}
+		return nil
+	}
+
+	switch statsFormat {
+	case "json":
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err := e.Encode(records); err != nil {
+			lib.Error(err.Error())
+		}
+	case "csv":
+		statsCSV(records)
+	default:
+		statsTable(records)
+	}
+	return nil
+}
+
+func statsRows(s trackmaster.SummaryResult) []trackmaster.SummaryInfo {
+	rows := []trackmaster.SummaryInfo{s.Total}
+	if !statsSegments {
+		return rows
+	}
+	for _, trk := range s.Tracks {
+		rows = append(rows, trk)
+		for _, seg := range s.Segments {
+			if seg.TrkTypeNo == trk.TrkTypeNo {
+				rows = append(rows, seg)
+			}
+		}
+	}
+	return rows
+}
+
+func statsName(s trackmaster.SummaryInfo) string {
+	if s.TrkTypeNo == -1 {
+		return "Total"
+	}
+	if s.TrkSegTypeNo == -1 {
+		return fmt.Sprintf("Track %d", s.TrkTypeNo)
+	}
+	return fmt.Sprintf("  Segment %d", s.TrkSegTypeNo)
+}
+
+func statsTable(records []statsRecord) {
+	for _, record := range records {
+		fmt.Printf("[%v]\n", record.Filename)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "\tPoints\tDistance 2D\tDistance 3D\tElapsed\tMoving\tGain\tLoss\tMax speed\tAvg speed\tMoving speed\t")
+		for _, s := range statsRows(record.Summary) {
+			fmt.Fprintf(w, "%s\t%d\t%.2f km\t%.2f km\t%s\t%s\t%.0f m\t%.0f m\t%.1f km/h\t%.1f km/h\t%.1f km/h\t\n",
+				statsName(s), s.Points, s.Distance2D/1000, s.Distance3D/1000,
+				time.Duration(s.Elapsed)*time.Second, time.Duration(s.Moving)*time.Second,
+				s.Gain, s.Loss, s.MaxSpeed*3.6, s.AvgSpeed*3.6, s.MovingSpeed*3.6)
+		}
+		w.Flush()
+	}
+}
+
+func statsCSV(records []statsRecord) {
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"filename", "track", "segment", "points", "distance2d", "distance3d", "start", "end", "elapsed", "moving", "gain", "loss", "minelevation", "maxelevation", "maxspeed", "avgspeed", "movingspeed"})
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 2, 64)
+	}
+	timestamp := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, record := range records {
+		for _, s := range statsRows(record.Summary) {
+			_ = w.Write([]string{
+				record.Filename, strconv.Itoa(s.TrkTypeNo), strconv.Itoa(s.TrkSegTypeNo), strconv.Itoa(s.Points),
+				float(s.Distance2D), float(s.Distance3D), timestamp(s.Start), timestamp(s.End),
+				float(s.Elapsed), float(s.Moving), float(s.Gain), float(s.Loss),
+				float(s.MinElevation), float(s.MaxElevation), float(s.MaxSpeed), float(s.AvgSpeed), float(s.MovingSpeed),
+			})
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		lib.Error(err.Error())
+	}
+}
@@ -1,20 +1,23 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 
 	"github.com/inode64/gotrackmaster/lib"
 	"github.com/inode64/gotrackmaster/trackmaster"
 	"github.com/spf13/cobra"
+	"github.com/twpayne/go-gpx"
 )
 
 var timeCmd = &cobra.Command{
 	Use:   "timestamp",
 	Short: "Update timestamp in all GPX file",
 	Long:  "Corrects all the timestamps that are missing or those that are outside the timeline in the track",
-	Run: func(cmd *cobra.Command, args []string) {
-		timExecute()
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return timExecute(cmd.Context())
 	},
 }
 
@@ -22,39 +25,38 @@ func init() {
 	rootCmd.AddCommand(timeCmd)
 }
 
-func timExecute() {
-	readTracks()
-
-	for _, filename := range lib.Tracks {
-		g, err := readTrack(filename)
-		if err != nil {
-			continue
-		}
+func timExecute(ctx context.Context) error {
+	if err := readTracks(ctx); err != nil {
+		return err
+	}
 
+	return forEachTrack(ctx, func(g gpx.GPX, filename string) trackRecord {
 		if trackmaster.TimeEmpty(g) {
-			fmt.Println(lib.ColorRed("Error: GPX file hasn't any time"))
-			continue
+			return errorRecord(filename, "GPX file could not be processed", errors.New("GPX file hasn't any time"))
 		}
 
 		quality := trackmaster.TimeQuality(g)
-		if quality == 100 {
-			fmt.Printf("[%v] - Tack with all correct timestamp \n", filename)
-			continue
-		}
 		if quality == -1 {
-			fmt.Println(lib.ColorRed("Error: GPX file empty"))
-			continue
+			return errorRecord(filename, "GPX file could not be processed", errors.New("GPX file empty"))
+		}
+		q := float64(quality)
+		if quality == 100 {
+			return trackRecord{Filename: filename, Quality: &q, message: fmt.Sprintf("[%v] - Tack with all correct timestamp ", filename)}
 		}
 
 		num := trackmaster.FixTimesTrack(g, true)
 		quality = trackmaster.TimeQuality(g)
 		if quality != 100 {
-			fmt.Printf("[%v] - Timestamp that could not be corrected\n", filename)
-		} else {
-			fmt.Printf("[%v] - Timestamp that have been fixed %s\n", filename, lib.ColorRed(strconv.Itoa(num)+" (updated)"))
-			if !dryRun {
-				writeGPX(g, filename)
-			}
+			return errorRecord(filename, fmt.Sprintf("[%v] - Timestamp that could not be corrected", filename), errors.New("timestamp could not be corrected"))
 		}
-	}
+		q = float64(quality)
+		return trackRecord{
+			Filename: filename,
+			Updated:  true,
+			Count:    num,
+			Quality:  &q,
+			message:  fmt.Sprintf("[%v] - Timestamp that have been fixed %s", filename, lib.ColorRed(strconv.Itoa(num)+" (updated)")),
+			write:    true,
+		}
+	}, reportTrack)
 }
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+// trackResult is the result of processing a track with the changes made when --diff is used.
+type trackResult[T any] struct {
+	result T
+	diff   *trackmaster.DiffResult
+}
+
+// forEachTrack processes the tracks found by readTracks with a pool of --jobs workers. The process
+// function runs concurrently and must not write to the output, the done function is called in the
+// order of the tracks, so the output is always the same.
+func forEachTrack[T any](ctx context.Context, process func(g gpx.GPX, filename string) T, done func(g gpx.GPX, filename string, result T)) error {
+	count, err := lib.ProcessTracks(ctx, trackFiles, jobs, func(g gpx.GPX, f lib.TrackFile) trackResult[T] {
+		if !showDiff {
+			return trackResult[T]{result: process(g, f.Filename)}
+		}
+		before := trackmaster.Clone(g)
+		result := process(g, f.Filename)
+		d := trackmaster.Diff(before, g)
+		return trackResult[T]{result: result, diff: &d}
+	}, func(g gpx.GPX, f lib.TrackFile, r trackResult[T], err error) {
+		if err != nil {
+			reportError(f.Filename, "GPX file could not be processed", err)
+			return
+		}
+		trackDiff = r.diff
+		done(g, f.Filename, r.result)
+		trackDiff = nil
+	})
+
+	if count.Errors == 0 {
+		fmt.Fprintf(os.Stderr, lib.ColorGreen("Processed %d track(s)\n"), count.Valid)
+	} else {
+		fmt.Fprintf(os.Stderr, lib.ColorYellow("Processed %d track(s), %d with error(s)\n"), count.Valid, count.Errors)
+	}
+	return err
+}
@@ -3,6 +3,7 @@ module github.com/inode64/gotrackmaster
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/codingsince1985/geo-golang v1.8.3
 	github.com/fatih/color v1.15.0
 	github.com/gabriel-vasile/mimetype v1.4.2
@@ -11,8 +12,13 @@ require (
 	github.com/ringsaturn/tzf v0.13.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.7.0
+	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.8.1
 	github.com/twpayne/go-gpx v1.3.1-0.20230712125754-5c1567af6ce8
+	go.etcd.io/bbolt v1.3.7
+	golang.org/x/net v0.12.0
+	golang.org/x/text v0.11.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -25,7 +31,6 @@ require (
 	github.com/paulmach/orb v0.9.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/ringsaturn/tzf-rel v0.0.2023-b // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/tidwall/geoindex v1.7.0 // indirect
 	github.com/tidwall/geojson v1.4.3 // indirect
 	github.com/tidwall/rtree v1.10.0 // indirect
@@ -33,9 +38,6 @@ require (
 	github.com/twpayne/go-polyline v1.1.1 // indirect
 	go.mongodb.org/mongo-driver v1.12.0 // indirect
 	golang.org/x/exp v0.0.0-20230711153332-06a737ee72cb // indirect
-	golang.org/x/net v0.12.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
-	golang.org/x/text v0.11.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,427 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codingsince1985/geo-golang"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/ringsaturn/tzf"
+	"github.com/twpayne/go-gpx"
+	bolt "go.etcd.io/bbolt"
+)
+
+var catalogBucket = []byte("tracks")
+
+// CatalogEntry is the metadata of a track stored in the catalog, distances are in meters and times in seconds.
+type CatalogEntry struct {
+	Path           string    `json:"path"`
+	Hash           string    `json:"hash"`
+	Fingerprint    string    `json:"fingerprint"`
+	Size           int64     `json:"size"`
+	ModTime        time.Time `json:"modTime"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	StartLat       float64   `json:"startLat"`
+	StartLon       float64   `json:"startLon"`
+	EndLat         float64   `json:"endLat"`
+	EndLon         float64   `json:"endLon"`
+	MinLat         float64   `json:"minLat"`
+	MinLon         float64   `json:"minLon"`
+	MaxLat         float64   `json:"maxLat"`
+	MaxLon         float64   `json:"maxLon"`
+	Points         int       `json:"points"`
+	Distance       float64   `json:"distance"`
+	Elapsed        float64   `json:"elapsed"`
+	Gain           float64   `json:"gain"`
+	Classification string    `json:"classification"`
+	Creator        string    `json:"creator"`
+	Quality        float64   `json:"quality"`
+	// QualityKey identifies the configuration used to calculate the quality
+	QualityKey string `json:"qualityKey"`
+	// the addresses are stored by import, Geocoder is the provider that found them
+	Geocoder     string       `json:"geocoder,omitempty"`
+	StartAddress *geo.Address `json:"startAddress,omitempty"`
+	EndAddress   *geo.Address `json:"endAddress,omitempty"`
+}
+
+// CatalogUpdate is the number of tracks added, updated, unchanged and removed by an update of the catalog.
+type CatalogUpdate struct {
+	Added     int `json:"added"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Removed   int `json:"removed"`
+	Errors    int `json:"errors"`
+}
+
+// catalogQualityVersion changes when the calculation of the quality or the metadata stored changes, so the
+// entries are analyzed again.
+const catalogQualityVersion = 3
+
+// Catalog stores the metadata of the tracks in a bbolt file, so the tracks are only analyzed when they change.
+type Catalog struct {
+	db *bolt.DB
+	// QualityConfig is used to calculate the quality of the tracks, the tracks are analyzed again when it changes
+	QualityConfig trackmaster.QualityConfig
+}
+
+// qualityKey returns the key of the configuration of the quality stored in the entries.
+func qualityKey(config trackmaster.QualityConfig) string {
+	return fmt.Sprintf("%d %+v", catalogQualityVersion, config)
+}
+
+// OpenCatalog opens or creates the catalog file.
+func OpenCatalog(filename string) (*Catalog, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filename, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(catalogBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Catalog{db: db, QualityConfig: trackmaster.DefaultQualityConfig()}, nil
+}
+
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// Get returns the entry of a track, false when the track is not in the catalog.
+func (c *Catalog) Get(path string) (CatalogEntry, bool, error) {
+	var e CatalogEntry
+	var found bool
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(catalogBucket).Get([]byte(path))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &e)
+	})
+	return e, found, err
+}
+
+// stale returns true when the entry was analyzed by a previous version or with other configuration of the
+// quality, the entries of the previous versions don't have the fingerprint.
+func (c *Catalog) stale(e CatalogEntry) bool {
+	return e.Points > 0 && (e.Fingerprint == "" || e.QualityKey != qualityKey(c.QualityConfig))
+}
+
+// Cached returns the entry of a track when the file didn't change since it was analyzed, false when the
+// metadata must be calculated again.
+func (c *Catalog) Cached(filename string) (CatalogEntry, bool) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return CatalogEntry{}, false
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return CatalogEntry{}, false
+	}
+	e, found, err := c.Get(path)
+	if err != nil || !found || c.stale(e) {
+		return CatalogEntry{}, false
+	}
+	return e, e.Size == fileInfo.Size() && e.ModTime.Equal(fileInfo.ModTime())
+}
+
+// Put adds or replaces the entry of a track.
+func (c *Catalog) Put(e CatalogEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogBucket).Put([]byte(e.Path), data)
+	})
+}
+
+// Delete removes the entry of a track.
+func (c *Catalog) Delete(path string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogBucket).Delete([]byte(path))
+	})
+}
+
+// Entries returns all the entries sorted by path.
+func (c *Catalog) Entries() ([]CatalogEntry, error) {
+	var result []CatalogEntry
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(catalogBucket).ForEach(func(k, v []byte) error {
+			var e CatalogEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			result = append(result, e)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Query returns the entries that match the query sorted by start time.
+func (c *Catalog) Query(q CatalogQuery) ([]CatalogEntry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var result []CatalogEntry
+	for _, e := range entries {
+		if q.Match(e) {
+			result = append(result, e)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
+}
+
+// Update adds the tracks that are not in the catalog and analyzes again the tracks whose content changed,
+// the hash is only calculated when the size or the modification time changed. The entries of the deleted
+// files are removed.
+func (c *Catalog) Update(ctx context.Context, files []TrackFile, jobs int, finder tzf.F) (CatalogUpdate, error) {
+	var result CatalogUpdate
+	var pending []TrackFile
+	for _, f := range files {
+		path, err := filepath.Abs(f.Filename)
+		if err != nil {
+			return result, err
+		}
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			return result, err
+		}
+		e, found, err := c.Get(path)
+		if err != nil {
+			return result, err
+		}
+		if found && c.stale(e) {
+			pending = append(pending, TrackFile{Filename: path, Format: f.Format})
+			continue
+		}
+		if found && e.Size == fileInfo.Size() && e.ModTime.Equal(fileInfo.ModTime()) {
+			result.Unchanged++
+			continue
+		}
+		if found {
+			hash, err := FileHash(path)
+			if err != nil {
+				return result, err
+			}
+			if hash == e.Hash {
+				e.Size, e.ModTime = fileInfo.Size(), fileInfo.ModTime()
+				if err := c.Put(e); err != nil {
+					return result, err
+				}
+				result.Unchanged++
+				continue
+			}
+		}
+		pending = append(pending, TrackFile{Filename: path, Format: f.Format})
+	}
+
+	var putErr error
+	_, err := ProcessTracks(ctx, pending, jobs, func(g gpx.GPX, f TrackFile) CatalogEntry {
+		e := TrackMetadata(g, finder, c.QualityConfig)
+		fileInfo, err := os.Stat(f.Filename)
+		if err != nil {
+			return e
+		}
+		e.Path, e.Size, e.ModTime = f.Filename, fileInfo.Size(), fileInfo.ModTime()
+		e.Hash, _ = FileHash(f.Filename)
+		return e
+	}, func(g gpx.GPX, f TrackFile, e CatalogEntry, err error) {
+		// the hash is empty when the file could not be read again
+		if err != nil || e.Hash == "" {
+			result.Errors++
+			return
+		}
+		if putErr != nil {
+			return
+		}
+		_, found, _ := c.Get(e.Path)
+		if putErr = c.Put(e); putErr != nil {
+			return
+		}
+		if found {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+	})
+	if err != nil {
+		return result, err
+	}
+	if putErr != nil {
+		return result, putErr
+	}
+
+	removed, err := c.prune()
+	result.Removed = removed
+	return result, err
+}
+
+// Duplicates returns the groups of entries with the same fingerprint, the same content saved in different
+// files, sorted by path.
+func (c *Catalog) Duplicates() ([][]CatalogEntry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]CatalogEntry)
+	var fingerprints []string
+	for _, e := range entries {
+		if e.Fingerprint == "" {
+			continue
+		}
+		if _, found := groups[e.Fingerprint]; !found {
+			fingerprints = append(fingerprints, e.Fingerprint)
+		}
+		groups[e.Fingerprint] = append(groups[e.Fingerprint], e)
+	}
+	var result [][]CatalogEntry
+	for _, fingerprint := range fingerprints {
+		if len(groups[fingerprint]) > 1 {
+			result = append(result, groups[fingerprint])
+		}
+	}
+	return result, nil
+}
+
+// prune removes the entries of the files that don't exist.
+func (c *Catalog) prune() (int, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		if _, err := os.Stat(e.Path); errors.Is(err, fs.ErrNotExist) {
+			if err := c.Delete(e.Path); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// TrackMetadata returns the metadata of a track, the times use the time zone of the position.
+func TrackMetadata(g gpx.GPX, finder tzf.F, config trackmaster.QualityConfig) CatalogEntry {
+	summary := trackmaster.Summary(g, trackmaster.DefaultSummaryConfig()).Total
+	bounds := trackmaster.GetBounds(g)
+	start := trackmaster.GetPositionStart(g)
+	end := trackmaster.GetPositionEnd(g)
+	e := CatalogEntry{
+		StartLat:       start.Lat,
+		StartLon:       start.Lon,
+		EndLat:         end.Lat,
+		EndLon:         end.Lon,
+		Points:         summary.Points,
+		Distance:       summary.Distance2D,
+		Elapsed:        summary.Elapsed,
+		Gain:           summary.Gain,
+		Classification: trackmaster.ClassificationTrack(g),
+		Creator:        trackmaster.GetCreator(g),
+		Quality:        trackmaster.Quality(g, config).Quality,
+		QualityKey:     qualityKey(config),
+		Fingerprint:    trackmaster.Fingerprint(g),
+	}
+	if trackmaster.IsBoundsValid(bounds) {
+		e.MinLat, e.MinLon, e.MaxLat, e.MaxLon = bounds.MinLat, bounds.MinLon, bounds.MaxLat, bounds.MaxLon
+	}
+	if finder != nil {
+		e.Start = trackmaster.GetTimeStart(g, finder)
+		e.End = trackmaster.GetTimeEnd(g, finder)
+	}
+	return e
+}
+
+// FileHash returns the SHA-256 of the content of a file.
+func FileHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// CatalogQuery filters the entries of the catalog, the fields with the zero value are not checked.
+type CatalogQuery struct {
+	// Classification and Creator match when they are contained in the value ignoring the case
+	Classification string
+	Creator        string
+	// Fingerprint matches the tracks with the same content
+	Fingerprint string
+	// From and To are dates in UTC that are compared with the date of the start in the time zone of the track
+	From time.Time
+	To   time.Time
+	// BBox matches the tracks whose bounds intersect it
+	BBox        *gpx.BoundsType
+	MinDistance float64
+	MaxDistance float64
+	MinGain     float64
+	MaxGain     float64
+	MinQuality  float64
+}
+
+// Match returns true when the entry matches all the filters of the query.
+func (q CatalogQuery) Match(e CatalogEntry) bool {
+	contains := func(value, filter string) bool {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(filter))
+	}
+	date := time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.UTC)
+	switch {
+	case q.Classification != "" && !contains(e.Classification, q.Classification):
+		return false
+	case q.Creator != "" && !contains(e.Creator, q.Creator):
+		return false
+	case q.Fingerprint != "" && e.Fingerprint != q.Fingerprint:
+		return false
+	case (!q.From.IsZero() || !q.To.IsZero()) && e.Start.IsZero():
+		return false
+	case !q.From.IsZero() && date.Before(q.From):
+		return false
+	case !q.To.IsZero() && !date.Before(q.To):
+		return false
+	case q.MinDistance > 0 && e.Distance < q.MinDistance:
+		return false
+	case q.MaxDistance > 0 && e.Distance > q.MaxDistance:
+		return false
+	case q.MinGain > 0 && e.Gain < q.MinGain:
+		return false
+	case q.MaxGain > 0 && e.Gain > q.MaxGain:
+		return false
+	case q.MinQuality > 0 && e.Quality < q.MinQuality:
+		return false
+	case q.BBox != nil && (e.MaxLat < q.BBox.MinLat || e.MinLat > q.BBox.MaxLat || e.MaxLon < q.BBox.MinLon || e.MinLon > q.BBox.MaxLon):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package lib_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestCatalogUpdate tests that only the new and changed tracks are analyzed and the deleted tracks are removed.
+func TestCatalogUpdate(t *testing.T) {
+	dir := writeTracks(t, map[string]int{"a.gpx": 10, "b.gpx": 20})
+	c, err := lib.OpenCatalog(filepath.Join(t.TempDir(), "catalog.db"))
+	assert.Nil(t, err)
+	defer c.Close()
+
+	update := func() lib.CatalogUpdate {
+		files, err := lib.NewLoader().Load(context.Background(), dir)
+		assert.Nil(t, err)
+		u, err := c.Update(context.Background(), files, 2, nil)
+		assert.Nil(t, err)
+		return u
+	}
+	assert.Equal(t, lib.CatalogUpdate{Added: 2}, update())
+	assert.Equal(t, lib.CatalogUpdate{Unchanged: 2}, update())
+	// the quality is calculated again with other configuration
+	c.QualityConfig.ReferencePoints = 0
+	assert.Equal(t, lib.CatalogUpdate{Updated: 2}, update())
+	assert.Equal(t, lib.CatalogUpdate{Unchanged: 2}, update())
+
+	other := writeTracks(t, map[string]int{"b.gpx": 30})
+	data, err := os.ReadFile(filepath.Join(other, "b.gpx"))
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "b.gpx"), data, 0o644))
+	assert.Nil(t, os.Remove(filepath.Join(dir, "a.gpx")))
+	assert.Equal(t, lib.CatalogUpdate{Updated: 1, Removed: 1}, update())
+
+	entries, err := c.Entries()
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, 30, entries[0].Points)
+	assert.Len(t, entries[0].Hash, 64)
+}
+
+// TestCatalogQuery tests the filters of the queries.
+func TestCatalogQuery(t *testing.T) {
+	e := lib.CatalogEntry{
+		Classification: "Cycling Mountain",
+		Creator:        "Garmin Edge 530",
+		MinLat:         40.5,
+		MinLon:         0.1,
+		MaxLat:         40.8,
+		MaxLon:         0.3,
+		Distance:       25000,
+		Gain:           800,
+		Quality:        70,
+	}
+	assert.True(t, lib.CatalogQuery{}.Match(e))
+	assert.True(t, lib.CatalogQuery{Classification: "cycling", Creator: "garmin"}.Match(e))
+	assert.False(t, lib.CatalogQuery{Classification: "Running"}.Match(e))
+	assert.True(t, lib.CatalogQuery{MinDistance: 20000, MaxGain: 1000, MinQuality: 50}.Match(e))
+	assert.False(t, lib.CatalogQuery{MinDistance: 30000}.Match(e))
+	assert.True(t, lib.CatalogQuery{BBox: &gpx.BoundsType{MinLat: 40.7, MinLon: 0.2, MaxLat: 41, MaxLon: 1}}.Match(e))
+	assert.False(t, lib.CatalogQuery{BBox: &gpx.BoundsType{MinLat: 41, MinLon: 0.2, MaxLat: 42, MaxLon: 1}}.Match(e))
+	// the tracks without time don't match the dates
+	assert.False(t, lib.CatalogQuery{From: e.Start.AddDate(2000, 0, 0)}.Match(e))
+
+	// the dates are compared with the date of the track in its time zone
+	e.Start = time.Date(2022, time.May, 1, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	day := time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)
+	assert.True(t, lib.CatalogQuery{From: day, To: day.AddDate(0, 0, 1)}.Match(e))
+	assert.False(t, lib.CatalogQuery{From: day.AddDate(0, 0, 1)}.Match(e))
+	assert.False(t, lib.CatalogQuery{To: day}.Match(e))
+}
+
+// TestCatalogCached tests that the entries are reused while the file and the configuration of the quality
+// don't change.
+func TestCatalogCached(t *testing.T) {
+	dir := writeTracks(t, map[string]int{"a.gpx": 10})
+	c, err := lib.OpenCatalog(filepath.Join(t.TempDir(), "catalog.db"))
+	assert.Nil(t, err)
+	defer c.Close()
+
+	filename := filepath.Join(dir, "a.gpx")
+	_, cached := c.Cached(filename)
+	assert.False(t, cached)
+
+	files, err := lib.NewLoader().Load(context.Background(), dir)
+	assert.Nil(t, err)
+	_, err = c.Update(context.Background(), files, 2, nil)
+	assert.Nil(t, err)
+	e, cached := c.Cached(filename)
+	assert.True(t, cached)
+	assert.Equal(t, 10, e.Points)
+
+	modTime := time.Now().Add(time.Hour)
+	assert.Nil(t, os.Chtimes(filename, modTime, modTime))
+	_, cached = c.Cached(filename)
+	assert.False(t, cached)
+	_, err = c.Update(context.Background(), files, 2, nil)
+	assert.Nil(t, err)
+	_, cached = c.Cached(filename)
+	assert.True(t, cached)
+
+	c.QualityConfig.ReferencePoints = 0
+	_, cached = c.Cached(filename)
+	assert.False(t, cached)
+}
+
+// TestCatalogDuplicates tests that the same points saved in different formats are found as duplicates.
+func TestCatalogDuplicates(t *testing.T) {
+	dir := writeTracks(t, map[string]int{"a.gpx": 10, "b.tcx": 10, "c.gpx": 20})
+	c, err := lib.OpenCatalog(filepath.Join(t.TempDir(), "catalog.db"))
+	assert.Nil(t, err)
+	defer c.Close()
+
+	files, err := lib.NewLoader().Load(context.Background(), dir)
+	assert.Nil(t, err)
+	_, err = c.Update(context.Background(), files, 2, nil)
+	assert.Nil(t, err)
+
+	groups, err := c.Duplicates()
+	assert.Nil(t, err)
+	assert.Len(t, groups, 1)
+	assert.Len(t, groups[0], 2)
+	assert.Equal(t, "a.gpx", filepath.Base(groups[0][0].Path))
+	assert.Equal(t, "b.tcx", filepath.Base(groups[0][1].Path))
+
+	entries, err := c.Query(lib.CatalogQuery{Fingerprint: groups[0][0].Fingerprint})
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+}
@@ -0,0 +1,70 @@
+package lib
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+// WriteCSV writes a row for each point of the tracks.
+func WriteCSV(w io.Writer, g gpx.GPX) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{"track", "segment", "point", "time", "lat", "lon", "ele", "distance", "speed", "hr", "cad", "power", "atemp"})
+	if err != nil {
+		return err
+	}
+
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	sensor := func(s trackmaster.Sensor, field trackmaster.SensorFields, f float64) string {
+		if !s.Available(field) {
+			return ""
+		}
+		return float(f)
+	}
+
+	for trkTypeNo, TrkType := range g.Trk {
+		for trkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			var distance float64
+			for wptTypeNo, WptType := range TrkSegType.TrkPt {
+				var speed float64
+				if wptTypeNo > 0 {
+					point := trackmaster.SpeedBetween(*TrkSegType.TrkPt[wptTypeNo-1], *WptType, false)
+					distance += point.Length
+					speed = point.Speed
+				}
+				var t string
+				if !WptType.Time.IsZero() {
+					t = WptType.Time.Format(time.RFC3339)
+				}
+				s := trackmaster.GetSensor(*WptType)
+				err := c.Write([]string{
+					strconv.Itoa(trkTypeNo),
+					strconv.Itoa(trkSegTypeNo),
+					strconv.Itoa(wptTypeNo),
+					t,
+					float(WptType.Lat),
+					float(WptType.Lon),
+					float(WptType.Ele),
+					strconv.FormatFloat(distance, 'f', 2, 64),
+					strconv.FormatFloat(speed, 'f', 2, 64),
+					sensor(s, trackmaster.SensorHeartRate, s.HeartRate),
+					sensor(s, trackmaster.SensorCadence, s.Cadence),
+					sensor(s, trackmaster.SensorPower, s.Power),
+					sensor(s, trackmaster.SensorTemperature, s.Temperature),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	c.Flush()
+	return c.Error()
+}
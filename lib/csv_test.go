@@ -0,0 +1,28 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWriteCSV tests that there is a row for each point with the distance from the start of the segment.
+func TestWriteCSV(t *testing.T) {
+	g := exportGPX(false)
+	trackmaster.SetSensor(g.Trk[0].TrkSeg[0].TrkPt[1], trackmaster.Sensor{HeartRate: 120, Temperature: 0, Zero: trackmaster.SensorTemperature})
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteCSV(&b, g))
+
+	rows, err := csv.NewReader(&b).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 5)
+	assert.Equal(t, []string{"track", "segment", "point", "time", "lat", "lon", "ele", "distance", "speed", "hr", "cad", "power", "atemp"}, rows[0])
+	assert.Equal(t, []string{"0", "0", "0", "2023-06-04T09:00:00Z", "40", "0.5", "100", "0.00", "0.00", "", "", "", ""}, rows[1])
+	assert.Equal(t, []string{"0", "0", "1", "2023-06-04T09:00:10Z", "40", "0.501", "101", "85.12", "8.51", "120", "", "", "0"}, rows[2])
+	// the points without time and the distance starts again in each segment
+	assert.Equal(t, []string{"0", "1", "0", "", "40.1", "0.5", "100", "0.00", "0.00", "", "", "", ""}, rows[3])
+}
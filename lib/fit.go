@@ -0,0 +1,686 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+// Garmin FIT protocol, see https://developer.garmin.com/fit/protocol/
+
+const (
+	fitHeaderSize      = 14
+	fitProtocolVersion = 0x20
+	fitProfileVersion  = 2132
+
+	fitMesgFileID   = 0
+	fitMesgSession  = 18
+	fitMesgLap      = 19
+	fitMesgRecord   = 20
+	fitMesgActivity = 34
+
+	fitFieldTimestamp = 253
+)
+
+// FIT base types.
+const (
+	fitEnum    = 0x00
+	fitSint8   = 0x01
+	fitUint8   = 0x02
+	fitSint16  = 0x83
+	fitUint16  = 0x84
+	fitSint32  = 0x85
+	fitUint32  = 0x86
+	fitFloat32 = 0x88
+	fitFloat64 = 0x89
+	fitUint8z  = 0x0A
+	fitUint16z = 0x8B
+	fitUint32z = 0x8C
+	fitByte    = 0x0D
+	fitSint64  = 0x8E
+	fitUint64  = 0x8F
+	fitUint64z = 0x90
+)
+
+var (
+	ErrFITHeader = errors.New("invalid FIT header")
+	ErrFITCRC    = errors.New("invalid FIT checksum")
+	ErrFITData   = errors.New("invalid FIT data")
+)
+
+// fitEpoch is the origin of the FIT timestamps.
+var fitEpoch = time.Date(1989, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// semicircles to degrees.
+const fitSemicircles = 180.0 / (1 << 31)
+
+var fitManufacturers = map[uint16]string{
+	1:   "Garmin",
+	23:  "Suunto",
+	32:  "Wahoo",
+	89:  "Tacx",
+	123: "Polar",
+	260: "Zwift",
+	265: "Strava",
+	267: "Bryton",
+	289: "Hammerhead",
+	294: "Coros",
+}
+
+const fitManufacturerDevelopment = 255
+
+var fitSports = map[uint8]string{
+	0:  "generic",
+	1:  "running",
+	2:  "cycling",
+	5:  "swimming",
+	11: "walking",
+	12: "cross_country_skiing",
+	13: "alpine_skiing",
+	15: "rowing",
+	16: "mountaineering",
+	17: "hiking",
+}
+
+type fitFieldDefinition struct {
+	num      uint8
+	size     uint8
+	baseType uint8
+}
+
+type fitDefinition struct {
+	global    uint16
+	bigEndian bool
+	fields    []fitFieldDefinition
+	devSize   int
+}
+
+// fitMessage contains the numeric fields of a data message, invalid values are not included.
+type fitMessage struct {
+	global uint16
+	fields map[uint8]float64
+}
+
+// ReadFIT reads a FIT activity file, the laps are converted to track segments
+// and the sensor values are stored as Garmin TrackPointExtension.
+func ReadFIT(r io.Reader) (*gpx.GPX, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []fitMessage
+	// FIT files can be chained
+	for len(data) > 0 {
+		n, m, err := decodeFIT(data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m...)
+		data = data[n:]
+	}
+
+	return fitToGPX(messages), nil
+}
+
+func decodeFIT(data []byte) (int, []fitMessage, error) {
+	if len(data) < 12 || data[0] < 12 || string(data[8:12]) != ".FIT" {
+		return 0, nil, ErrFITHeader
+	}
+	headerSize := int(data[0])
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if len(data) < end+2 {
+		return 0, nil, ErrFITHeader
+	}
+	if fitCRC(0, data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return 0, nil, ErrFITCRC
+	}
+
+	var messages []fitMessage
+	definitions := make(map[uint8]fitDefinition)
+	var lastTimestamp uint32
+	buf := data[headerSize:end]
+
+	for len(buf) > 0 {
+		header := buf[0]
+		buf = buf[1:]
+
+		var local uint8
+		var timestamp uint32
+		compressed := header&0x80 != 0
+		if compressed {
+			local = (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp = lastTimestamp + ((offset - lastTimestamp&0x1F) & 0x1F)
+		} else {
+			local = header & 0x0F
+		}
+
+		if !compressed && header&0x40 != 0 {
+			def, n, err := decodeFITDefinition(buf, header&0x20 != 0)
+			if err != nil {
+				return 0, nil, err
+			}
+			definitions[local] = def
+			buf = buf[n:]
+			continue
+		}
+
+		def, ok := definitions[local]
+		if !ok {
+			return 0, nil, ErrFITData
+		}
+		m := fitMessage{global: def.global, fields: make(map[uint8]float64)}
+		for _, field := range def.fields {
+			if len(buf) < int(field.size) {
+				return 0, nil, ErrFITData
+			}
+			if value, ok := fitValue(buf[:field.size], field.baseType, def.bigEndian); ok {
+				m.fields[field.num] = value
+			}
+			buf = buf[field.size:]
+		}
+		if len(buf) < def.devSize {
+			return 0, nil, ErrFITData
+		}
+		buf = buf[def.devSize:]
+
+		if compressed {
+			m.fields[fitFieldTimestamp] = float64(timestamp)
+		}
+		if t, ok := m.fields[fitFieldTimestamp]; ok {
+			lastTimestamp = uint32(t)
+		}
+		messages = append(messages, m)
+	}
+
+	return end + 2, messages, nil
+}
+
+func decodeFITDefinition(buf []byte, developer bool) (fitDefinition, int, error) {
+	var def fitDefinition
+	if len(buf) < 5 {
+		return def, 0, ErrFITData
+	}
+	def.bigEndian = buf[1] == 1
+	if def.bigEndian {
+		def.global = binary.BigEndian.Uint16(buf[2:4])
+	} else {
+		def.global = binary.LittleEndian.Uint16(buf[2:4])
+	}
+	num := int(buf[4])
+	n := 5
+	if len(buf) < n+num*3 {
+		return def, 0, ErrFITData
+	}
+	for i := 0; i < num; i++ {
+		def.fields = append(def.fields, fitFieldDefinition{num: buf[n], size: buf[n+1], baseType: buf[n+2]})
+		n += 3
+	}
+	if developer {
+		if len(buf) < n+1 {
+			return def, 0, ErrFITData
+		}
+		num = int(buf[n])
+		n++
+		if len(buf) < n+num*3 {
+			return def, 0, ErrFITData
+		}
+		for i := 0; i < num; i++ {
+			def.devSize += int(buf[n+1])
+			n += 3
+		}
+	}
+	return def, n, nil
+}
+
+// fitValue decodes the first value of a field, it returns false when the value is invalid.
+func fitValue(b []byte, baseType uint8, bigEndian bool) (float64, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	switch baseType {
+	case fitEnum, fitUint8, fitUint8z, fitByte:
+		v := b[0]
+		return float64(v), v != 0xFF && (baseType != fitUint8z || v != 0)
+	case fitSint8:
+		v := int8(b[0])
+		return float64(v), v != math.MaxInt8
+	case fitSint16:
+		if len(b) < 2 {
+			return 0, false
+		}
+		v := int16(order.Uint16(b))
+		return float64(v), v != math.MaxInt16
+	case fitUint16, fitUint16z:
+		if len(b) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		return float64(v), v != math.MaxUint16 && (baseType != fitUint16z || v != 0)
+	case fitSint32:
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := int32(order.Uint32(b))
+		return float64(v), v != math.MaxInt32
+	case fitUint32, fitUint32z:
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		return float64(v), v != math.MaxUint32 && (baseType != fitUint32z || v != 0)
+	case fitFloat32:
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := math.Float32frombits(order.Uint32(b))
+		return float64(v), !math.IsNaN(float64(v)) && order.Uint32(b) != math.MaxUint32
+	case fitFloat64:
+		if len(b) < 8 {
+			return 0, false
+		}
+		v := math.Float64frombits(order.Uint64(b))
+		return v, !math.IsNaN(v) && order.Uint64(b) != math.MaxUint64
+	case fitSint64:
+		if len(b) < 8 {
+			return 0, false
+		}
+		v := int64(order.Uint64(b))
+		return float64(v), v != math.MaxInt64
+	case fitUint64, fitUint64z:
+		if len(b) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(b)
+		return float64(v), v != math.MaxUint64 && (baseType != fitUint64z || v != 0)
+	}
+	// strings, byte arrays and unknown types are not used
+	return 0, false
+}
+
+func fitTime(timestamp float64) time.Time {
+	return fitEpoch.Add(time.Duration(timestamp) * time.Second)
+}
+
+func fitToGPX(messages []fitMessage) *gpx.GPX {
+	g := &gpx.GPX{
+		Version: "1.1",
+		Creator: "gotrackmaster",
+	}
+	trk := &gpx.TrkType{}
+	var laps []time.Time
+	var points []*gpx.WptType
+
+	for _, m := range messages {
+		switch m.global {
+		case fitMesgFileID:
+			if manufacturer, ok := m.fields[1]; ok {
+				if name, ok := fitManufacturers[uint16(manufacturer)]; ok {
+					g.Creator = name
+				}
+			}
+			if created, ok := m.fields[4]; ok {
+				g.Metadata = &gpx.MetadataType{Time: fitTime(created)}
+			}
+		case fitMesgSession:
+			if sport, ok := m.fields[5]; ok {
+				trk.Type = fitSports[uint8(sport)]
+			}
+		case fitMesgLap:
+			// the timestamp of a lap is the time of its end
+			if end, ok := m.fields[fitFieldTimestamp]; ok {
+				laps = append(laps, fitTime(end))
+			}
+		case fitMesgRecord:
+			lat, okLat := m.fields[0]
+			lon, okLon := m.fields[1]
+			// a GPX point always needs a position
+			if !okLat || !okLon {
+				continue
+			}
+			w := &gpx.WptType{
+				Lat: lat * fitSemicircles,
+				Lon: lon * fitSemicircles,
+			}
+			if t, ok := m.fields[fitFieldTimestamp]; ok {
+				w.Time = fitTime(t)
+			}
+			if ele, ok := m.fields[78]; ok {
+				w.Ele = ele/5 - 500
+			} else if ele, ok := m.fields[2]; ok {
+				w.Ele = ele/5 - 500
+			}
+			var s trackmaster.Sensor
+			s.HeartRate = m.fields[3]
+			s.Cadence = m.fields[4]
+			s.Power = m.fields[7]
+			s.Temperature = m.fields[13]
+			s.Distance = m.fields[5] / 100
+			// a temperature of 0 °C is a valid value
+			if temperature, ok := m.fields[13]; ok && temperature == 0 {
+				s.Zero |= trackmaster.SensorTemperature
+			}
+			if !s.IsEmpty() {
+				trackmaster.SetSensor(w, s)
+			}
+			points = append(points, w)
+		}
+	}
+
+	trk.TrkSeg = fitSegments(points, laps)
+	if len(trk.TrkSeg) > 0 {
+		g.Trk = append(g.Trk, trk)
+	}
+
+	return g
+}
+
+// fitSegments splits the points into a segment for each lap.
+func fitSegments(points []*gpx.WptType, laps []time.Time) []*gpx.TrkSegType {
+	if len(points) == 0 {
+		return nil
+	}
+	if len(laps) < 2 {
+		return []*gpx.TrkSegType{{TrkPt: points}}
+	}
+
+	sort.Slice(laps, func(i, j int) bool {
+		return laps[i].Before(laps[j])
+	})
+
+	var result []*gpx.TrkSegType
+	seg := &gpx.TrkSegType{}
+	lap := 0
+	for _, w := range points {
+		for lap < len(laps)-1 && w.Time.After(laps[lap]) {
+			if len(seg.TrkPt) > 0 {
+				result = append(result, seg)
+				seg = &gpx.TrkSegType{}
+			}
+			lap++
+		}
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	if len(seg.TrkPt) > 0 {
+		result = append(result, seg)
+	}
+	return result
+}
+
+// fitField describes a field written by the encoder.
+type fitField struct {
+	num      uint8
+	baseType uint8
+	value    float64
+	valid    bool
+}
+
+type fitEncoder struct {
+	buf   bytes.Buffer
+	local map[uint16]uint8
+}
+
+// WriteFIT writes the tracks as a FIT activity file, each segment is written as a lap.
+func WriteFIT(w io.Writer, g gpx.GPX) error {
+	e := fitEncoder{local: make(map[uint16]uint8)}
+
+	var first, last time.Time
+	var sport uint8
+	for _, TrkType := range g.Trk {
+		if sport == 0 {
+			sport = fitSport(TrkType.Type)
+		}
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for _, WptType := range TrkSegType.TrkPt {
+				if WptType.Time.IsZero() {
+					continue
+				}
+				if first.IsZero() {
+					first = WptType.Time
+				}
+				last = WptType.Time
+			}
+		}
+	}
+
+	manufacturer := uint16(fitManufacturerDevelopment)
+	creator := trackmaster.GetCreator(g)
+	for k, v := range fitManufacturers {
+		if strings.EqualFold(v, creator) {
+			manufacturer = k
+		}
+	}
+
+	e.message(fitMesgFileID, []fitField{
+		{0, fitEnum, 4, true}, // activity
+		{1, fitUint16, float64(manufacturer), true},
+		{2, fitUint16, 0, true},
+		{4, fitUint32, fitTimestamp(first), !first.IsZero()},
+	})
+
+	// the points without elevation have 0, so the elevation is only written when the track has elevation
+	elevation := !trackmaster.ElevationEmpty(g)
+
+	var laps int
+	var distance, lapDistance float64
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) == 0 {
+				continue
+			}
+			lapDistance = 0
+			for wptTypeNo, WptType := range TrkSegType.TrkPt {
+				if wptTypeNo > 0 {
+					d := trackmaster.Distance2D(*TrkSegType.TrkPt[wptTypeNo-1], *WptType)
+					distance += d
+					lapDistance += d
+				}
+				// the distance of the device is not used because the filters don't update it
+				s := trackmaster.GetSensor(*WptType)
+				e.message(fitMesgRecord, []fitField{
+					{fitFieldTimestamp, fitUint32, fitTimestamp(WptType.Time), !WptType.Time.IsZero()},
+					{0, fitSint32, fitSemicircle(WptType.Lat), true},
+					{1, fitSint32, fitSemicircle(WptType.Lon), true},
+					{78, fitUint32, math.Round((WptType.Ele + 500) * 5), elevation},
+					{5, fitUint32, math.Round(distance * 100), true},
+					{3, fitUint8, s.HeartRate, s.HeartRate != 0},
+					{4, fitUint8, s.Cadence, s.Cadence != 0},
+					{7, fitUint16, s.Power, s.Power != 0},
+					{13, fitSint8, s.Temperature, s.Available(trackmaster.SensorTemperature)},
+				})
+			}
+			start := TrkSegType.TrkPt[0].Time
+			end := TrkSegType.TrkPt[len(TrkSegType.TrkPt)-1].Time
+			e.message(fitMesgLap, []fitField{
+				{fitFieldTimestamp, fitUint32, fitTimestamp(end), !end.IsZero()},
+				{254, fitUint16, float64(laps), true},
+				{0, fitEnum, 9, true}, // lap
+				{1, fitEnum, 1, true}, // stop
+				{2, fitUint32, fitTimestamp(start), !start.IsZero()},
+				{7, fitUint32, end.Sub(start).Seconds() * 1000, !start.IsZero() && !end.IsZero()},
+				{8, fitUint32, end.Sub(start).Seconds() * 1000, !start.IsZero() && !end.IsZero()},
+				{9, fitUint32, math.Round(lapDistance * 100), true},
+			})
+			laps++
+		}
+	}
+
+	e.message(fitMesgSession, []fitField{
+		{fitFieldTimestamp, fitUint32, fitTimestamp(last), !last.IsZero()},
+		{0, fitEnum, 8, true}, // session
+		{1, fitEnum, 1, true}, // stop
+		{2, fitUint32, fitTimestamp(first), !first.IsZero()},
+		{5, fitEnum, float64(sport), true},
+		{7, fitUint32, last.Sub(first).Seconds() * 1000, !first.IsZero()},
+		{8, fitUint32, last.Sub(first).Seconds() * 1000, !first.IsZero()},
+		{9, fitUint32, math.Round(distance * 100), true},
+		{25, fitUint16, 0, true},
+		{26, fitUint16, float64(laps), true},
+	})
+
+	e.message(fitMesgActivity, []fitField{
+		{fitFieldTimestamp, fitUint32, fitTimestamp(last), !last.IsZero()},
+		{1, fitUint16, 1, true},
+		{2, fitEnum, 0, true},  // manual
+		{3, fitEnum, 26, true}, // activity
+		{4, fitEnum, 1, true},  // stop
+	})
+
+	return e.write(w)
+}
+
+func fitSport(kind string) uint8 {
+	kind = strings.ToLower(kind)
+	for k, v := range fitSports {
+		if v == kind {
+			return k
+		}
+	}
+	return 0
+}
+
+// fitSemicircle converts degrees to semicircles, 180° is out of the range of a sint32 and math.MaxInt32 is the
+// invalid value, so it is clamped to the previous semicircle.
+func fitSemicircle(degrees float64) float64 {
+	return math.Min(math.Max(math.Round(degrees/fitSemicircles), math.MinInt32), math.MaxInt32-1)
+}
+
+func fitTimestamp(t time.Time) float64 {
+	return math.Floor(t.Sub(fitEpoch).Seconds())
+}
+
+// message writes a data message, the definition is written the first time that a message type is used.
+func (e *fitEncoder) message(global uint16, fields []fitField) {
+	local, ok := e.local[global]
+	if !ok {
+		local = uint8(len(e.local))
+		e.local[global] = local
+		e.buf.WriteByte(0x40 | local)
+		e.buf.WriteByte(0)
+		e.buf.WriteByte(0) // little endian
+		_ = binary.Write(&e.buf, binary.LittleEndian, global)
+		e.buf.WriteByte(uint8(len(fields)))
+		for _, f := range fields {
+			e.buf.WriteByte(f.num)
+			e.buf.WriteByte(fitSize(f.baseType))
+			e.buf.WriteByte(f.baseType)
+		}
+	}
+
+	e.buf.WriteByte(local)
+	for _, f := range fields {
+		fitPut(&e.buf, f)
+	}
+}
+
+func fitSize(baseType uint8) uint8 {
+	switch baseType {
+	case fitSint16, fitUint16:
+		return 2
+	case fitSint32, fitUint32:
+		return 4
+	}
+	return 1
+}
+
+func fitPut(b *bytes.Buffer, f fitField) {
+	switch f.baseType {
+	case fitSint8:
+		v := int8(math.MaxInt8)
+		if f.valid {
+			v = int8(f.value)
+		}
+		b.WriteByte(uint8(v))
+	case fitSint16:
+		v := int16(math.MaxInt16)
+		if f.valid {
+			v = int16(f.value)
+		}
+		_ = binary.Write(b, binary.LittleEndian, v)
+	case fitUint16:
+		v := uint16(math.MaxUint16)
+		if f.valid {
+			v = uint16(f.value)
+		}
+		_ = binary.Write(b, binary.LittleEndian, v)
+	case fitSint32:
+		v := int32(math.MaxInt32)
+		if f.valid {
+			v = int32(f.value)
+		}
+		_ = binary.Write(b, binary.LittleEndian, v)
+	case fitUint32:
+		v := uint32(math.MaxUint32)
+		if f.valid {
+			v = uint32(f.value)
+		}
+		_ = binary.Write(b, binary.LittleEndian, v)
+	default:
+		v := uint8(math.MaxUint8)
+		if f.valid {
+			v = uint8(f.value)
+		}
+		b.WriteByte(v)
+	}
+}
+
+func (e *fitEncoder) write(w io.Writer) error {
+	header := make([]byte, fitHeaderSize)
+	header[0] = fitHeaderSize
+	header[1] = fitProtocolVersion
+	binary.LittleEndian.PutUint16(header[2:4], fitProfileVersion)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(e.buf.Len()))
+	copy(header[8:12], ".FIT")
+	binary.LittleEndian.PutUint16(header[12:14], fitCRC(0, header[:12]))
+
+	crc := fitCRC(fitCRC(0, header), e.buf.Bytes())
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	if _, err := bw.Write(e.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, crc); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing FIT: %w", err)
+	}
+	return nil
+}
+
+var fitCRCTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+func fitCRC(crc uint16, data []byte) uint16 {
+	for _, b := range data {
+		tmp := fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[b&0xF]
+
+		tmp = fitCRCTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ fitCRCTable[(b>>4)&0xF]
+	}
+	return crc
+}
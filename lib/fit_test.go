@@ -0,0 +1,108 @@
+package lib_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestFITRoundTrip tests that a track written as FIT is read back with the same points, laps and sensors.
+func TestFITRoundTrip(t *testing.T) {
+	start := time.Date(2023, time.March, 5, 8, 27, 2, 0, time.UTC)
+	g := gpx.GPX{Version: "1.1", Creator: "Garmin Edge 530"}
+	trk := &gpx.TrkType{Type: "cycling"}
+	for lap := 0; lap < 2; lap++ {
+		seg := &gpx.TrkSegType{}
+		for i := 0; i < 10; i++ {
+			n := lap*10 + i
+			w := &gpx.WptType{
+				Lat:  42.0955141 + float64(n)*0.0001,
+				Lon:  2.4603103 + float64(n)*0.0001,
+				Ele:  531 + float64(n),
+				Time: start.Add(time.Duration(n) * time.Second),
+			}
+			trackmaster.SetSensor(w, trackmaster.Sensor{HeartRate: float64(120 + n), Cadence: 85, Power: 210})
+			seg.TrkPt = append(seg.TrkPt, w)
+		}
+		trk.TrkSeg = append(trk.TrkSeg, seg)
+	}
+	g.Trk = append(g.Trk, trk)
+
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteFIT(&b, g))
+
+	r, err := lib.ReadFIT(&b)
+	assert.NoError(t, err)
+	assert.Equal(t, "Garmin", r.Creator)
+	assert.Len(t, r.Trk, 1)
+	assert.Equal(t, "cycling", r.Trk[0].Type)
+	assert.Len(t, r.Trk[0].TrkSeg, 2)
+	for trkSegTypeNo, TrkSegType := range r.Trk[0].TrkSeg {
+		assert.Len(t, TrkSegType.TrkPt, 10)
+		for wptTypeNo, WptType := range TrkSegType.TrkPt {
+			original := g.Trk[0].TrkSeg[trkSegTypeNo].TrkPt[wptTypeNo]
+			assert.InDelta(t, original.Lat, WptType.Lat, 1e-6)
+			assert.InDelta(t, original.Lon, WptType.Lon, 1e-6)
+			assert.InDelta(t, original.Ele, WptType.Ele, 0.2)
+			assert.True(t, original.Time.Equal(WptType.Time))
+			s := trackmaster.GetSensor(*WptType)
+			assert.GreaterOrEqual(t, s.Distance, 0.0)
+			s.Distance = 0
+			assert.Equal(t, trackmaster.GetSensor(*original), s)
+		}
+	}
+}
+
+// TestFITPresence tests that a temperature of 0 °C is kept and the points without elevation are not
+// written with an elevation of 0 m.
+func TestFITPresence(t *testing.T) {
+	start := time.Date(2023, time.January, 5, 8, 27, 2, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < 3; i++ {
+		w := &gpx.WptType{Lat: 42 + float64(i)*0.0001, Lon: 2, Time: start.Add(time.Duration(i) * time.Second)}
+		s := trackmaster.Sensor{Temperature: float64(i - 1)}
+		if i == 1 {
+			s.Zero = trackmaster.SensorTemperature
+		}
+		trackmaster.SetSensor(w, s)
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	g := gpx.GPX{Version: "1.1", Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+	assert.True(t, trackmaster.GetSensor(*seg.TrkPt[1]).Available(trackmaster.SensorTemperature))
+
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteFIT(&b, g))
+	r, err := lib.ReadFIT(&b)
+	assert.NoError(t, err)
+	for i, WptType := range r.Trk[0].TrkSeg[0].TrkPt {
+		assert.Zero(t, WptType.Ele)
+		s := trackmaster.GetSensor(*WptType)
+		assert.True(t, s.Available(trackmaster.SensorTemperature))
+		assert.Equal(t, float64(i-1), s.Temperature)
+	}
+}
+
+// TestFITAntimeridian tests that the longitudes of ±180° are written in the range of the semicircles.
+func TestFITAntimeridian(t *testing.T) {
+	start := time.Date(2023, time.January, 5, 8, 27, 2, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i, lon := range []float64{179.9999, 180, -180} {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: -16.5, Lon: lon, Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	g := gpx.GPX{Version: "1.1", Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteFIT(&b, g))
+	r, err := lib.ReadFIT(&b)
+	assert.NoError(t, err)
+	points := r.Trk[0].TrkSeg[0].TrkPt
+	assert.Len(t, points, 3)
+	for i, WptType := range points {
+		assert.InDelta(t, seg.TrkPt[i].Lon, WptType.Lon, 1e-6)
+	}
+}
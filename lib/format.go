@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+// Format describes a file format of tracks, Read or Write are nil when the format can't be read or written.
+type Format struct {
+	Name       string
+	Extensions []string
+	MimeTypes  []string
+	Read       func(r io.Reader) (*gpx.GPX, error)
+	Write      func(w io.Writer, g gpx.GPX) error
+}
+
+var ErrUnknownFormat = errors.New("unknown track format")
+
+// Formats contains all the supported track formats.
+var Formats = []Format{
+	{
+		Name:       "gpx",
+		Extensions: []string{".gpx"},
+		MimeTypes:  []string{"application/gpx+xml", "text/xml"},
+		Read:       gpx.Read,
+		Write:      WriteGPX,
+	},
+	{
+		Name:       "fit",
+		Extensions: []string{".fit"},
+		Read:       ReadFIT,
+		Write:      WriteFIT,
+	},
+	{
+		Name:       "tcx",
+		Extensions: []string{".tcx"},
+		MimeTypes:  []string{"application/vnd.garmin.tcx+xml"},
+		Read:       ReadTCX,
+		Write:      WriteTCX,
+	},
+	{
+		Name:       "geojson",
+		Extensions: []string{".geojson", ".json"},
+		Write:      WriteGeoJSON,
+	},
+	{
+		Name:       "kml",
+		Extensions: []string{".kml"},
+		Write:      WriteKML,
+	},
+	{
+		Name:       "kmz",
+		Extensions: []string{".kmz"},
+		Write:      WriteKMZ,
+	},
+	{
+		Name:       "csv",
+		Extensions: []string{".csv"},
+		Write:      WriteCSV,
+	},
+}
+
+// FormatByName returns the format with the given name.
+func FormatByName(name string) (Format, error) {
+	for _, format := range Formats {
+		if strings.EqualFold(format.Name, name) {
+			return format, nil
+		}
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+// FormatByFilename returns the format of a file using its extension.
+func FormatByFilename(filename string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	for _, format := range Formats {
+		for _, e := range format.Extensions {
+			if e == ext {
+				return format, nil
+			}
+		}
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+// DetectFormat returns the readable format of a file using its extension or its content.
+func DetectFormat(filename string) (Format, error) {
+	format, err := FormatByFilename(filename)
+	if err == nil && format.Read != nil {
+		return format, nil
+	}
+
+	mtype, err := mimetype.DetectFile(filename)
+	if err != nil {
+		return Format{}, err
+	}
+	for _, format := range Formats {
+		for _, m := range format.MimeTypes {
+			if mtype.Is(m) && format.Read != nil {
+				return format, nil
+			}
+		}
+	}
+	return Format{}, ErrUnknownFormat
+}
+
+// ChangeExtension replaces the extension of a filename with the first extension of the format.
+func ChangeExtension(filename string, format Format) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + format.Extensions[0]
+}
+
+// ReadTrackFile reads a track in any of the supported formats.
+func ReadTrackFile(filename string) (*gpx.GPX, error) {
+	format, err := DetectFormat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return format.Read(f)
+}
+
+// WriteTrackFile writes a track using the format given by the extension of the filename. The track is
+// written to a temporary file that replaces the file at the end, so a failed write never truncates it.
+func WriteTrackFile(g gpx.GPX, filename string) error {
+	format, err := FormatByFilename(filename)
+	if err != nil {
+		return err
+	}
+	if format.Write == nil {
+		return ErrUnknownFormat
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*"+tempExtension)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := format.Write(f, g); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// keep the permissions of the replaced file, the temporary file is only readable by the owner
+	mode := os.FileMode(0o644)
+	if fileInfo, err := os.Stat(filename); err == nil {
+		mode = fileInfo.Mode().Perm()
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
+
+// WriteGPX writes a track as GPX with the XML header.
+func WriteGPX(w io.Writer, g gpx.GPX) error {
+	trackmaster.ExtensionNamespaces(&g)
+
+	// write xml header
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	return g.WriteIndent(w, "", "  ")
+}
@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codingsince1985/geo-golang"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	GeocoderOnline   = "osm"
+	GeocoderGeoNames = "geonames"
+	GeocoderNone     = "none"
+)
+
+// geoNamesMaxRing is the maximum number of cells of one degree searched around a position.
+const geoNamesMaxRing = 3
+
+type geoNamesCity struct {
+	name        string
+	lat         float64
+	lon         float64
+	countryCode string
+	admin1Code  string
+}
+
+type geoNamesCell struct {
+	lat int
+	lon int
+}
+
+// GeoNamesGeocoder is an offline geocoder that returns the nearest city of a GeoNames dump, the cities
+// are indexed in cells of one degree.
+type GeoNamesGeocoder struct {
+	cells     map[geoNamesCell][]geoNamesCity
+	admin1    map[string]string
+	countries map[string]string
+}
+
+// NewGeoNamesGeocoder loads the GeoNames files of a directory: the cities (cities500.txt or any other
+// citiesN.txt), admin1CodesASCII.txt for the names of the states and, optionally, countryInfo.txt for
+// the names of the countries. The files can be downloaded from https://download.geonames.org/export/dump/
+func NewGeoNamesGeocoder(dir string) (*GeoNamesGeocoder, error) {
+	g := &GeoNamesGeocoder{
+		cells:     make(map[geoNamesCell][]geoNamesCity),
+		admin1:    make(map[string]string),
+		countries: make(map[string]string),
+	}
+
+	cities, _ := filepath.Glob(filepath.Join(dir, "cities*.txt"))
+	if len(cities) == 0 {
+		return nil, fmt.Errorf("there isn't any GeoNames cities file in %s", dir)
+	}
+	err := readGeoNames(cities[0], 15, func(fields []string) {
+		lat, errLat := strconv.ParseFloat(fields[4], 64)
+		lon, errLon := strconv.ParseFloat(fields[5], 64)
+		if errLat != nil || errLon != nil {
+			return
+		}
+		city := geoNamesCity{name: fields[1], lat: lat, lon: lon, countryCode: fields[8], admin1Code: fields[10]}
+		cell := geoNamesCellOf(lat, lon)
+		g.cells[cell] = append(g.cells[cell], city)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readGeoNames(filepath.Join(dir, "admin1CodesASCII.txt"), 2, func(fields []string) {
+		g.admin1[fields[0]] = fields[1]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readGeoNames(filepath.Join(dir, "countryInfo.txt"), 5, func(fields []string) {
+		g.countries[fields[0]] = fields[4]
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return g, nil
+}
+
+// readGeoNames calls add with the fields of each line of a GeoNames file with at least minFields,
+// the comments are skipped.
+func readGeoNames(filename string, minFields int, add func(fields []string)) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) >= minFields {
+			add(fields)
+		}
+	}
+	return scanner.Err()
+}
+
+func geoNamesCellOf(lat, lon float64) geoNamesCell {
+	return geoNamesCell{lat: int(math.Floor(lat)), lon: int(math.Floor(lon))}
+}
+
+// nearest returns the nearest city in the cells at a maximum of ring cells of the position.
+func (g *GeoNamesGeocoder) nearest(lat, lon float64, ring int) (geoNamesCity, float64) {
+	var best geoNamesCity
+	bestDistance := math.MaxFloat64
+	center := geoNamesCellOf(lat, lon)
+	for dLat := -ring; dLat <= ring; dLat++ {
+		for dLon := -ring; dLon <= ring; dLon++ {
+			// the longitude wraps around the antimeridian
+			cellLon := (center.lon+dLon+180+360)%360 - 180
+			for _, city := range g.cells[geoNamesCell{lat: center.lat + dLat, lon: cellLon}] {
+				if d := trackmaster.HaversineDistance(lat, lon, city.lat, city.lon); d < bestDistance {
+					best, bestDistance = city, d
+				}
+			}
+		}
+	}
+	return best, bestDistance
+}
+
+// ReverseGeocode returns the address of the nearest city, nil when there isn't any city near.
+func (g *GeoNamesGeocoder) ReverseGeocode(lat, lng float64) (*geo.Address, error) {
+	for ring := 1; ring <= geoNamesMaxRing; ring++ {
+		city, d := g.nearest(lat, lng, ring)
+		if d == math.MaxFloat64 {
+			continue
+		}
+		// a city of the next ring can be nearer than a city of a corner of the ring
+		if next, dNext := g.nearest(lat, lng, ring+1); dNext < d {
+			city = next
+		}
+
+		country := g.countries[city.countryCode]
+		if country == "" {
+			country = city.countryCode
+		}
+		state := g.admin1[city.countryCode+"."+city.admin1Code]
+		return &geo.Address{
+			FormattedAddress: strings.Join([]string{city.name, state, country}, ", "),
+			City:             city.name,
+			State:            state,
+			StateCode:        city.admin1Code,
+			Country:          country,
+			CountryCode:      city.countryCode,
+		}, nil
+	}
+	return nil, nil
+}
+
+var geocoderBucket = []byte("addresses")
+
+// CachedGeocoder keeps the addresses of a geocoder in a bbolt file and limits the requests to one every
+// interval, so an online geocoder is not flooded. The positions are rounded to about 10 meters.
+type CachedGeocoder struct {
+	geocoder trackmaster.Geocoder
+	db       *bolt.DB
+	interval time.Duration
+	mu       sync.Mutex
+	last     time.Time
+}
+
+// NewCachedGeocoder opens or creates the cache file of a geocoder.
+func NewCachedGeocoder(geocoder trackmaster.Geocoder, filename string, interval time.Duration) (*CachedGeocoder, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filename, 0o644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(geocoderBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &CachedGeocoder{geocoder: geocoder, db: db, interval: interval}, nil
+}
+
+func (c *CachedGeocoder) Close() error {
+	return c.db.Close()
+}
+
+// ReverseGeocode returns the address from the cache or from the geocoder, the errors are not cached.
+func (c *CachedGeocoder) ReverseGeocode(lat, lng float64) (*geo.Address, error) {
+	key := []byte(fmt.Sprintf("%.4f,%.4f", lat, lng))
+	var address *geo.Address
+	err := c.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(geocoderBucket).Get(key)
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal(data, &address)
+	})
+	if err != nil || address != nil {
+		return address, err
+	}
+
+	c.wait()
+	address, err = c.geocoder.ReverseGeocode(lat, lng)
+	if err != nil || address == nil {
+		return address, err
+	}
+
+	data, err := json.Marshal(address)
+	if err != nil {
+		return address, err
+	}
+	return address, c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(geocoderBucket).Put(key, data)
+	})
+}
+
+// wait blocks until the interval since the last request has passed.
+func (c *CachedGeocoder) wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d := c.interval - time.Since(c.last); d > 0 {
+		time.Sleep(d)
+	}
+	c.last = time.Now()
+}
@@ -0,0 +1,95 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codingsince1985/geo-golang"
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeGeoNames writes a GeoNames dump with a few cities.
+func writeGeoNames(t *testing.T) string {
+	dir := t.TempDir()
+	city := func(id, name, lat, lon, country, admin1 string) string {
+		fields := make([]string, 19)
+		fields[0], fields[1], fields[2], fields[4], fields[5], fields[8], fields[10] = id, name, name, lat, lon, country, admin1
+		return strings.Join(fields, "\t")
+	}
+	cities := []string{
+		city("3128760", "Barcelona", "41.38879", "2.15899", "ES", "56"),
+		city("3119841", "Girona", "41.98311", "2.82493", "ES", "56"),
+		city("3108680", "Tortosa", "40.81249", "0.5216", "ES", "56"),
+		city("2988507", "Paris", "48.85341", "2.3488", "FR", "11"),
+	}
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "cities500.txt"), []byte(strings.Join(cities, "\n")+"\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "admin1CodesASCII.txt"), []byte("ES.56\tCatalonia\tCatalonia\t3336901\nFR.11\tIle-de-France\tIle-de-France\t3012874\n"), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "countryInfo.txt"), []byte("#ISO\tISO3\tISO-Numeric\tfips\tCountry\nES\tESP\t724\tSP\tSpain\n"), 0o644))
+	return dir
+}
+
+// TestGeoNamesGeocoder tests that the nearest city is found with the names of the state and the country.
+func TestGeoNamesGeocoder(t *testing.T) {
+	g, err := lib.NewGeoNamesGeocoder(writeGeoNames(t))
+	assert.Nil(t, err)
+
+	address, err := g.ReverseGeocode(41.9, 2.7)
+	assert.Nil(t, err)
+	assert.Equal(t, "Girona", address.City)
+	assert.Equal(t, "Catalonia", address.State)
+	assert.Equal(t, "Spain", address.Country)
+	assert.Equal(t, "ES", address.CountryCode)
+
+	address, _ = g.ReverseGeocode(40.74, 0.18)
+	assert.Equal(t, "Tortosa", address.City)
+
+	// without countryInfo.txt the country is the code
+	address, _ = g.ReverseGeocode(48.9, 2.4)
+	assert.Equal(t, "Paris", address.City)
+	assert.Equal(t, "FR", address.Country)
+
+	address, err = g.ReverseGeocode(-33.9, 151.2)
+	assert.Nil(t, err)
+	assert.Nil(t, address)
+
+	_, err = lib.NewGeoNamesGeocoder(t.TempDir())
+	assert.NotNil(t, err)
+}
+
+type countGeocoder struct {
+	count int
+}
+
+func (c *countGeocoder) ReverseGeocode(lat, lng float64) (*geo.Address, error) {
+	c.count++
+	return &geo.Address{City: "Girona"}, nil
+}
+
+// TestCachedGeocoder tests that the addresses are cached and the requests are limited.
+func TestCachedGeocoder(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "geocoder.db")
+	online := &countGeocoder{}
+	g, err := lib.NewCachedGeocoder(online, filename, 50*time.Millisecond)
+	assert.Nil(t, err)
+
+	start := time.Now()
+	for _, lat := range []float64{41.9, 41.90001, 42} {
+		address, err := g.ReverseGeocode(lat, 2.7)
+		assert.Nil(t, err)
+		assert.Equal(t, "Girona", address.City)
+	}
+	assert.Equal(t, 2, online.count)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Nil(t, g.Close())
+
+	g, err = lib.NewCachedGeocoder(online, filename, time.Second)
+	assert.Nil(t, err)
+	defer g.Close()
+	_, err = g.ReverseGeocode(42, 2.7)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, online.count)
+}
@@ -0,0 +1,176 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+)
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// geoJSONLine returns the geometry of the points of a segment, a LineString needs two positions so a
+// segment with only one point is a Point.
+func geoJSONLine(coordinates [][]float64) geoJSONGeometry {
+	if len(coordinates) == 1 {
+		return geoJSONGeometry{Type: "Point", Coordinates: coordinates[0]}
+	}
+	return geoJSONGeometry{Type: "LineString", Coordinates: coordinates}
+}
+
+// WriteGeoJSON writes each segment as a GeoJSON LineString, the values of each point are stored
+// in the coordinateProperties of the feature, in the same order as the coordinates. The values that
+// a point doesn't have are null.
+func WriteGeoJSON(w io.Writer, g gpx.GPX) error {
+	collection := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+	for trkTypeNo, TrkType := range g.Trk {
+		for trkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) == 0 {
+				continue
+			}
+			coordinates := make([][]float64, 0, len(TrkSegType.TrkPt))
+			times := make([]interface{}, 0, len(TrkSegType.TrkPt))
+			elevations := make([]float64, 0, len(TrkSegType.TrkPt))
+			speeds := make([]float64, 0, len(TrkSegType.TrkPt))
+			sensors := make(map[string][]interface{})
+			for wptTypeNo, WptType := range TrkSegType.TrkPt {
+				coordinates = append(coordinates, []float64{WptType.Lon, WptType.Lat, WptType.Ele})
+				if WptType.Time.IsZero() {
+					times = append(times, nil)
+				} else {
+					times = append(times, WptType.Time.Format(time.RFC3339))
+				}
+				elevations = append(elevations, WptType.Ele)
+				var speed float64
+				if wptTypeNo > 0 {
+					speed = trackmaster.SpeedBetween(*TrkSegType.TrkPt[wptTypeNo-1], *WptType, false).Speed
+				}
+				speeds = append(speeds, speed)
+				addSensorValues(sensors, trackmaster.GetSensor(*WptType), wptTypeNo, len(TrkSegType.TrkPt))
+			}
+
+			properties := map[string]interface{}{
+				"time":  times,
+				"ele":   elevations,
+				"speed": speeds,
+			}
+			for name, values := range sensors {
+				properties[name] = values
+			}
+			collection.Features = append(collection.Features, geoJSONFeature{
+				Type:     "Feature",
+				Geometry: geoJSONLine(coordinates),
+				Properties: map[string]interface{}{
+					"name":                 TrkType.Name,
+					"type":                 TrkType.Type,
+					"track":                trkTypeNo,
+					"segment":              trkSegTypeNo,
+					"coordinateProperties": properties,
+				},
+			})
+		}
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(collection)
+}
+
+// addSensorValues adds the sensor values of a point, the slices are only created when a sensor is used
+// and the points without the sensor are null.
+func addSensorValues(sensors map[string][]interface{}, s trackmaster.Sensor, i, total int) {
+	values := map[string]float64{
+		"hr":    s.HeartRate,
+		"cad":   s.Cadence,
+		"power": s.Power,
+		"atemp": s.Temperature,
+	}
+	fields := map[string]trackmaster.SensorFields{
+		"hr":    trackmaster.SensorHeartRate,
+		"cad":   trackmaster.SensorCadence,
+		"power": trackmaster.SensorPower,
+		"atemp": trackmaster.SensorTemperature,
+	}
+	for name, value := range values {
+		if !s.Available(fields[name]) {
+			continue
+		}
+		if sensors[name] == nil {
+			sensors[name] = make([]interface{}, total)
+		}
+		sensors[name][i] = value
+	}
+}
+
+// WriteDiffGeoJSON writes the changes between two versions of a track to be shown over a map, the tracks
+// are LineStrings, the removed and inserted points are Points and the moved points are LineStrings from
+// the old to the new position. The kind property tells what is each feature.
+func WriteDiffGeoJSON(w io.Writer, before, after gpx.GPX, d trackmaster.DiffResult) error {
+	collection := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+	addTrack := func(g gpx.GPX, kind string) {
+		for trkTypeNo, TrkType := range g.Trk {
+			for trkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+				if len(TrkSegType.TrkPt) == 0 {
+					continue
+				}
+				coordinates := make([][]float64, 0, len(TrkSegType.TrkPt))
+				for _, WptType := range TrkSegType.TrkPt {
+					coordinates = append(coordinates, []float64{WptType.Lon, WptType.Lat, WptType.Ele})
+				}
+				collection.Features = append(collection.Features, geoJSONFeature{
+					Type:       "Feature",
+					Geometry:   geoJSONLine(coordinates),
+					Properties: map[string]interface{}{"kind": kind, "track": trkTypeNo, "segment": trkSegTypeNo},
+				})
+			}
+		}
+	}
+	addTrack(before, "before")
+	addTrack(after, "after")
+
+	for _, p := range d.Points {
+		properties := map[string]interface{}{"kind": p.Kind}
+		var geometry geoJSONGeometry
+		switch p.Kind {
+		case trackmaster.DiffRemoved:
+			geometry = geoJSONGeometry{Type: "Point", Coordinates: []float64{p.Before.WptType.Lon, p.Before.WptType.Lat, p.Before.WptType.Ele}}
+		case trackmaster.DiffInserted:
+			geometry = geoJSONGeometry{Type: "Point", Coordinates: []float64{p.After.WptType.Lon, p.After.WptType.Lat, p.After.WptType.Ele}}
+		default:
+			geometry = geoJSONGeometry{Type: "LineString", Coordinates: [][]float64{
+				{p.Before.WptType.Lon, p.Before.WptType.Lat, p.Before.WptType.Ele},
+				{p.After.WptType.Lon, p.After.WptType.Lat, p.After.WptType.Ele},
+			}}
+			properties["distance"] = p.Distance
+			properties["elevation"] = p.Elevation
+			properties["time"] = p.Time
+		}
+		collection.Features = append(collection.Features, geoJSONFeature{Type: "Feature", Geometry: geometry, Properties: properties})
+	}
+
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(collection)
+}
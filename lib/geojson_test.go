@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWriteGeoJSON tests that each segment is a LineString with the values of the points in coordinateProperties.
+func TestWriteGeoJSON(t *testing.T) {
+	g := exportGPX(false)
+	trackmaster.SetSensor(g.Trk[0].TrkSeg[0].TrkPt[1], trackmaster.Sensor{HeartRate: 120})
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteGeoJSON(&b, g))
+
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string          `json:"type"`
+				Coordinates json.RawMessage `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Name                 string `json:"name"`
+				Segment              int    `json:"segment"`
+				CoordinateProperties struct {
+					Time []*string  `json:"time"`
+					Ele  []float64  `json:"ele"`
+					HR   []*float64 `json:"hr"`
+				} `json:"coordinateProperties"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Len(t, collection.Features, 2)
+
+	f := collection.Features[0]
+	assert.Equal(t, "LineString", f.Geometry.Type)
+	assert.JSONEq(t, `[[0.5, 40, 100], [0.501, 40, 101]]`, string(f.Geometry.Coordinates))
+	assert.Equal(t, "run", f.Properties.Name)
+	assert.Equal(t, "2023-06-04T09:00:10Z", *f.Properties.CoordinateProperties.Time[1])
+	assert.Equal(t, []float64{100, 101}, f.Properties.CoordinateProperties.Ele)
+	// the points without the sensor have a null value
+	assert.Len(t, f.Properties.CoordinateProperties.HR, 2)
+	assert.Nil(t, f.Properties.CoordinateProperties.HR[0])
+	assert.Equal(t, 120.0, *f.Properties.CoordinateProperties.HR[1])
+
+	// the points without time have a null time
+	f = collection.Features[1]
+	assert.Equal(t, 1, f.Properties.Segment)
+	assert.Equal(t, []*string{nil, nil}, f.Properties.CoordinateProperties.Time)
+	assert.Nil(t, f.Properties.CoordinateProperties.HR)
+
+	// a segment with one point is a Point
+	g.Trk[0].TrkSeg[1].TrkPt = g.Trk[0].TrkSeg[1].TrkPt[:1]
+	b.Reset()
+	assert.NoError(t, lib.WriteGeoJSON(&b, g))
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &collection))
+	f = collection.Features[1]
+	assert.Equal(t, "Point", f.Geometry.Type)
+	assert.JSONEq(t, `[0.5, 40.1, 100]`, string(f.Geometry.Coordinates))
+}
@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/twpayne/go-gpx"
+)
+
+type kmlDocument struct {
+	XMLName    xml.Name       `xml:"kml"`
+	XMLNS      string         `xml:"xmlns,attr"`
+	XMLNSGX    string         `xml:"xmlns:gx,attr"`
+	Name       string         `xml:"Document>name,omitempty"`
+	Placemarks []kmlPlacemark `xml:"Document>Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name          string            `xml:"name,omitempty"`
+	MultiTrack    *kmlMultiTrack    `xml:"gx:MultiTrack"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlMultiTrack struct {
+	AltitudeMode string     `xml:"altitudeMode"`
+	Interpolate  int        `xml:"gx:interpolate"`
+	Tracks       []kmlTrack `xml:"gx:Track"`
+}
+
+type kmlTrack struct {
+	When  []string `xml:"when"`
+	Coord []string `xml:"gx:coord"`
+}
+
+type kmlMultiGeometry struct {
+	LineStrings []kmlLineString `xml:"LineString"`
+}
+
+type kmlLineString struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// WriteKML writes each track as a placemark with a gx:Track for each segment, so the time of the points is kept.
+// The tracks with points without time are written with a LineString for each segment.
+func WriteKML(w io.Writer, g gpx.GPX) error {
+	doc := kmlDocument{
+		XMLNS:   "http://www.opengis.net/kml/2.2",
+		XMLNSGX: "http://www.google.com/kml/ext/2.2",
+	}
+	if g.Metadata != nil {
+		doc.Name = g.Metadata.Name
+	}
+	for _, TrkType := range g.Trk {
+		placemark := kmlPlacemark{Name: TrkType.Name}
+		if kmlTimes(*TrkType) {
+			placemark.MultiTrack = &kmlMultiTrack{AltitudeMode: "absolute"}
+			for _, TrkSegType := range TrkType.TrkSeg {
+				var track kmlTrack
+				for _, WptType := range TrkSegType.TrkPt {
+					// gx:Track needs the same number of when and coord elements
+					track.When = append(track.When, WptType.Time.Format(time.RFC3339))
+					track.Coord = append(track.Coord, fmt.Sprintf("%v %v %v", WptType.Lon, WptType.Lat, WptType.Ele))
+				}
+				placemark.MultiTrack.Tracks = append(placemark.MultiTrack.Tracks, track)
+			}
+		} else {
+			placemark.MultiGeometry = &kmlMultiGeometry{}
+			for _, TrkSegType := range TrkType.TrkSeg {
+				coordinates := make([]string, 0, len(TrkSegType.TrkPt))
+				for _, WptType := range TrkSegType.TrkPt {
+					coordinates = append(coordinates, fmt.Sprintf("%v,%v,%v", WptType.Lon, WptType.Lat, WptType.Ele))
+				}
+				placemark.MultiGeometry.LineStrings = append(placemark.MultiGeometry.LineStrings, kmlLineString{
+					AltitudeMode: "absolute",
+					Coordinates:  strings.Join(coordinates, " "),
+				})
+			}
+		}
+		doc.Placemarks = append(doc.Placemarks, placemark)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return e.Encode(doc)
+}
+
+// kmlTimes returns true when all the points of the track have a time.
+func kmlTimes(t gpx.TrkType) bool {
+	for _, TrkSegType := range t.TrkSeg {
+		for _, WptType := range TrkSegType.TrkPt {
+			if WptType.Time.IsZero() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// WriteKMZ writes the KML compressed in a zip file.
+func WriteKMZ(w io.Writer, g gpx.GPX) error {
+	z := zip.NewWriter(w)
+	f, err := z.Create("doc.kml")
+	if err != nil {
+		return err
+	}
+	if err := WriteKML(f, g); err != nil {
+		return err
+	}
+	return z.Close()
+}
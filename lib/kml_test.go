@@ -0,0 +1,67 @@
+package lib_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/twpayne/go-gpx"
+)
+
+// exportGPX returns a track with two segments of two points, the points of the second segment have no time
+// when times is false.
+func exportGPX(times bool) gpx.GPX {
+	start := time.Date(2023, time.June, 4, 9, 0, 0, 0, time.UTC)
+	g := gpx.GPX{Trk: []*gpx.TrkType{{Name: "run"}}}
+	for i := 0; i < 2; i++ {
+		seg := &gpx.TrkSegType{}
+		for j := 0; j < 2; j++ {
+			w := &gpx.WptType{Lat: 40 + float64(i)/10, Lon: 0.5 + float64(j)/1000, Ele: 100 + float64(j)}
+			if times || i == 0 {
+				w.Time = start.Add(time.Duration(i*60+j*10) * time.Second)
+			}
+			seg.TrkPt = append(seg.TrkPt, w)
+		}
+		g.Trk[0].TrkSeg = append(g.Trk[0].TrkSeg, seg)
+	}
+	return g
+}
+
+type kmlResult struct {
+	Placemarks []struct {
+		Name   string `xml:"name"`
+		Tracks []struct {
+			When  []string `xml:"when"`
+			Coord []string `xml:"coord"`
+		} `xml:"MultiTrack>Track"`
+		LineStrings []struct {
+			Coordinates string `xml:"coordinates"`
+		} `xml:"MultiGeometry>LineString"`
+	} `xml:"Document>Placemark"`
+}
+
+// TestWriteKML tests that the tracks with times are written as gx:Track and the others as LineString.
+func TestWriteKML(t *testing.T) {
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteKML(&b, exportGPX(true)))
+	var k kmlResult
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &k))
+	assert.Len(t, k.Placemarks, 1)
+	assert.Equal(t, "run", k.Placemarks[0].Name)
+	assert.Len(t, k.Placemarks[0].Tracks, 2)
+	assert.Empty(t, k.Placemarks[0].LineStrings)
+	assert.Equal(t, []string{"2023-06-04T09:01:00Z", "2023-06-04T09:01:10Z"}, k.Placemarks[0].Tracks[1].When)
+	assert.Equal(t, []string{"0.5 40.1 100", "0.501 40.1 101"}, k.Placemarks[0].Tracks[1].Coord)
+
+	b.Reset()
+	assert.NoError(t, lib.WriteKML(&b, exportGPX(false)))
+	assert.NotContains(t, b.String(), "0001-01-01")
+	k = kmlResult{}
+	assert.NoError(t, xml.Unmarshal(b.Bytes(), &k))
+	assert.Empty(t, k.Placemarks[0].Tracks)
+	assert.Len(t, k.Placemarks[0].LineStrings, 2)
+	assert.Equal(t, "0.5,40.1,100 0.501,40.1,101", k.Placemarks[0].LineStrings[1].Coordinates)
+}
@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/karrick/godirwalk"
+	"github.com/twpayne/go-gpx"
+)
+
+// TrackFile is a file with a track in a readable format.
+type TrackFile struct {
+	Filename string
+	Format   Format
+}
+
+// Read parses the track of the file.
+func (f TrackFile) Read() (*gpx.GPX, error) {
+	r, err := os.Open(f.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return f.Format.Read(r)
+}
+
+// Loader locates the tracks of a file or a directory. It has no global state, so several loaders
+// can be used at the same time.
+type Loader struct {
+	// Formats are the formats that are loaded, all the readable formats when it is empty
+	Formats []Format
+}
+
+// NewLoader returns a loader of all the readable formats.
+func NewLoader() *Loader {
+	return &Loader{}
+}
+
+// Load returns the tracks of a file or the tracks found recursively in a directory sorted by name,
+// the files of unknown formats are skipped.
+func (l *Loader) Load(ctx context.Context, path string) ([]TrackFile, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("no open track path: %w", err)
+	}
+
+	var files []TrackFile
+	add := func(filename string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// the backups and the files being written are not tracks to process
+		if ext := filepath.Ext(filename); ext == BackupExtension || ext == tempExtension {
+			return nil
+		}
+		format, err := DetectFormat(filename)
+		if errors.Is(err, ErrUnknownFormat) || (err == nil && !l.accept(format)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		files = append(files, TrackFile{Filename: filename, Format: format})
+		return nil
+	}
+
+	if !fileInfo.IsDir() {
+		if err := add(path); err != nil {
+			return nil, err
+		}
+		return files, nil
+	}
+
+	err = godirwalk.Walk(path, &godirwalk.Options{
+		Callback: func(path string, de *godirwalk.Dirent) error {
+			if de.IsDir() {
+				return nil
+			}
+			return add(path)
+		},
+		Unsorted: false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (l *Loader) accept(format Format) bool {
+	if len(l.Formats) == 0 {
+		return true
+	}
+	for _, f := range l.Formats {
+		if f.Name == format.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// TrackCount is the number of tracks processed and the number of tracks that could not be read.
+type TrackCount struct {
+	Valid  int
+	Errors int
+}
+
+// trackJob is the result of processing a track in a worker.
+type trackJob[T any] struct {
+	g      gpx.GPX
+	err    error
+	result T
+}
+
+// ProcessTracks reads and processes the tracks with a pool of jobs workers, each track is parsed once,
+// jobs 0 uses the number of CPUs. The process function runs concurrently, the done function is called
+// in the order of the files with the error when the track could not be read, so the output is always
+// the same. When the context is canceled no more tracks are started and the error of the context is returned.
+func ProcessTracks[T any](ctx context.Context, files []TrackFile, jobs int, process func(g gpx.GPX, f TrackFile) T, done func(g gpx.GPX, f TrackFile, result T, err error)) (TrackCount, error) {
+	var count TrackCount
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	results := make([]chan trackJob[T], len(files))
+	for i := range results {
+		results[i] = make(chan trackJob[T], 1)
+	}
+
+	// a track only takes a slot until it is done, so the memory is bounded when a track is slow
+	slots := make(chan struct{}, jobs)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, f := range files {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			wg.Add(1)
+			go func(i int, f TrackFile) {
+				defer wg.Done()
+				var job trackJob[T]
+				g, err := f.Read()
+				if err != nil {
+					job.err = err
+				} else {
+					job.g = *g
+					job.result = process(job.g, f)
+				}
+				results[i] <- job
+			}(i, f)
+		}
+	}()
+	defer wg.Wait()
+	defer close(stop)
+
+	for i, f := range files {
+		var job trackJob[T]
+		select {
+		case job = <-results[i]:
+		case <-ctx.Done():
+			return count, ctx.Err()
+		}
+		if job.err != nil {
+			count.Errors++
+		} else {
+			count.Valid++
+		}
+		done(job.g, f, job.result, job.err)
+		<-slots
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,82 @@
+package lib_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// writeTracks writes a track with n points for each name in a new directory.
+func writeTracks(t *testing.T, names map[string]int) string {
+	dir := t.TempDir()
+	start := time.Date(2023, time.March, 5, 8, 27, 2, 0, time.UTC)
+	for name, n := range names {
+		seg := &gpx.TrkSegType{}
+		for i := 0; i < n; i++ {
+			seg.TrkPt = append(seg.TrkPt, &gpx.WptType{
+				Lat:  42.0955141 + float64(i)*0.0001,
+				Lon:  2.4603103,
+				Time: start.Add(time.Duration(i) * time.Second),
+			})
+		}
+		g := gpx.GPX{Version: "1.1", Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		assert.Nil(t, lib.WriteTrackFile(g, filepath.Join(dir, name)))
+	}
+	return dir
+}
+
+// TestLoaderLoad tests that the tracks are found sorted and the other files are skipped.
+func TestLoaderLoad(t *testing.T) {
+	dir := writeTracks(t, map[string]int{"b.gpx": 2, "a.gpx": 3, "sub/c.tcx": 1})
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a track"), 0o644))
+
+	files, err := lib.NewLoader().Load(context.Background(), dir)
+	assert.Nil(t, err)
+	var names []string
+	for _, f := range files {
+		names = append(names, filepath.Base(f.Filename))
+	}
+	assert.Equal(t, []string{"a.gpx", "b.gpx", "c.tcx"}, names)
+
+	gpxFormat, _ := lib.FormatByName("gpx")
+	files, err = (&lib.Loader{Formats: []lib.Format{gpxFormat}}).Load(context.Background(), dir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+
+	_, err = lib.NewLoader().Load(context.Background(), filepath.Join(dir, "missing"))
+	assert.NotNil(t, err)
+}
+
+// TestProcessTracks tests that the results are returned in order and the broken tracks are counted.
+func TestProcessTracks(t *testing.T) {
+	dir := writeTracks(t, map[string]int{"a.gpx": 1, "b.gpx": 2, "c.gpx": 3, "d.gpx": 4})
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "b.gpx"), []byte("<gpx"), 0o644))
+	files, err := lib.NewLoader().Load(context.Background(), dir)
+	assert.Nil(t, err)
+
+	var points []int
+	count, err := lib.ProcessTracks(context.Background(), files, 3, func(g gpx.GPX, f lib.TrackFile) int {
+		return len(g.Trk[0].TrkSeg[0].TrkPt)
+	}, func(g gpx.GPX, f lib.TrackFile, n int, err error) {
+		points = append(points, n)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 0, 3, 4}, points)
+	assert.Equal(t, lib.TrackCount{Valid: 3, Errors: 1}, count)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	count, err = lib.ProcessTracks(ctx, files, 1, func(g gpx.GPX, f lib.TrackFile) int {
+		return 0
+	}, func(g gpx.GPX, f lib.TrackFile, n int, err error) {
+		cancel()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, count.Valid)
+}
@@ -0,0 +1,189 @@
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameData contains the fields that can be used in the templates of the names of the tracks, Distance
+// is in kilometers and Gain in meters. Year, Month, Day, Hour, Minute and Weekday are taken from Time.
+type NameData struct {
+	Time        time.Time
+	Year        string
+	Month       string
+	Day         string
+	Hour        string
+	Minute      string
+	Weekday     string
+	Country     string
+	CountryCode string
+	City        string
+	State       string
+	EndCity     string
+	Degree1     string
+	Degree05    string
+	Original    string
+	Kind        string
+	Creator     string
+	Name        string
+	Quality     float64
+	Distance    float64
+	Duration    time.Duration
+	Gain        float64
+	Hash        string
+	Fingerprint string
+}
+
+// legacyPlaceholders converts the placeholders of the first formats to template actions.
+var legacyPlaceholders = strings.NewReplacer(
+	"{year}", "{{.Year}}",
+	"{month}", "{{.Month}}",
+	"{day}", "{{.Day}}",
+	"{hour}", "{{.Hour}}",
+	"{minute}", "{{.Minute}}",
+	"{country}", "{{.Country}}",
+	"{countrycode}", "{{.CountryCode}}",
+	"{city}", "{{.City}}",
+	"{state}", "{{.State}}",
+	"{degree1}", "{{.Degree1}}",
+	"{degree0.5}", "{{.Degree05}}",
+	"{original}", "{{.Original}}",
+	"{kind}", "{{.Kind}}",
+	"{creator}", "{{.Creator}}",
+	"{quality}", `{{printf "%0.0f" .Quality}}`,
+)
+
+var nameFuncs = template.FuncMap{
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"slug":    Slug,
+	"default": defaultValue,
+}
+
+// NameTemplate is a Go template of a name, the placeholders of the first formats like {year} are also accepted.
+type NameTemplate struct {
+	text     string
+	template *template.Template
+}
+
+// ParseNameTemplate parses the template of a name.
+func ParseNameTemplate(format string) (*NameTemplate, error) {
+	text := legacyPlaceholders.Replace(format)
+	t, err := template.New("name").Funcs(nameFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &NameTemplate{text: text, template: t}, nil
+}
+
+// Uses returns true when the template uses any of the fields.
+func (n *NameTemplate) Uses(fields ...string) bool {
+	for _, field := range fields {
+		if regexp.MustCompile(`\.` + field + `\b`).MatchString(n.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute returns the name of the data, the fields can't add directories and each directory of the
+// name is sanitized.
+func (n *NameTemplate) Execute(data NameData) (string, error) {
+	if !data.Time.IsZero() {
+		data.Year = fmt.Sprintf("%d", data.Time.Year())
+		data.Month = fmt.Sprintf("%02d", data.Time.Month())
+		data.Day = fmt.Sprintf("%02d", data.Time.Day())
+		data.Hour = fmt.Sprintf("%02d", data.Time.Hour())
+		data.Minute = fmt.Sprintf("%02d", data.Time.Minute())
+		data.Weekday = data.Time.Weekday().String()
+	}
+	separators := strings.NewReplacer("/", "_", "\\", "_")
+	for _, field := range []*string{&data.Country, &data.CountryCode, &data.City, &data.State, &data.EndCity, &data.Original, &data.Kind, &data.Creator, &data.Name} {
+		*field = separators.Replace(*field)
+	}
+
+	var b strings.Builder
+	if err := n.template.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return SanitizePath(b.String()), nil
+}
+
+// defaultValue returns def when the value is empty, used as {{default "unknown" .City}}.
+func defaultValue(def string, value interface{}) interface{} {
+	if value == nil || reflect.ValueOf(value).IsZero() {
+		return def
+	}
+	return value
+}
+
+// Slug returns the text in lower case without accents and with hyphens instead of the other characters.
+func Slug(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range norm.NFD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		default:
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+var windowsReserved = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+
+// maxNameLength is the maximum length in bytes of a file name leaving space for the extension and the suffixes.
+const maxNameLength = 200
+
+// SanitizePath returns a relative path valid in Linux, macOS and Windows: the characters that are not
+// allowed are replaced by underscores, the names reserved by Windows are prefixed with an underscore
+// and the directories can't be empty, "." or "..".
+func SanitizePath(path string) string {
+	parts := strings.Split(strings.ReplaceAll(path, "\\", "/"), "/")
+	var result []string
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		result = append(result, sanitizeName(part))
+	}
+	return strings.Join(result, "/")
+}
+
+func sanitizeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	// Windows doesn't allow names ending with a dot or a space
+	name = strings.TrimRight(strings.TrimLeft(name, " "), ". ")
+	if name == "" {
+		return "_"
+	}
+	if windowsReserved.MatchString(name) {
+		name = "_" + name
+	}
+	for len(name) > maxNameLength {
+		r := []rune(name)
+		name = string(r[:len(r)-1])
+	}
+	return name
+}
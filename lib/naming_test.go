@@ -0,0 +1,80 @@
+package lib_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+var nameData = lib.NameData{
+	Time:        time.Date(2023, time.March, 5, 8, 27, 2, 0, time.UTC),
+	Country:     "España",
+	CountryCode: "ES",
+	City:        "Girona",
+	State:       "Catalunya",
+	Kind:        "trail running",
+	Name:        "Volta per l'Ermita",
+	Quality:     87.4,
+	Distance:    12.345,
+	Duration:    90 * time.Minute,
+}
+
+func executeName(t *testing.T, format string, data lib.NameData) string {
+	tmpl, err := lib.ParseNameTemplate(format)
+	assert.Nil(t, err)
+	name, err := tmpl.Execute(data)
+	assert.Nil(t, err)
+	return name
+}
+
+func TestNameTemplateLegacy(t *testing.T) {
+	assert.Equal(t, "2023/ES/Girona_20230305_87", executeName(t, "{year}/{countrycode}/{city}_{year}{month}{day}_{quality}", nameData))
+}
+
+func TestNameTemplateFuncs(t *testing.T) {
+	assert.Equal(t, "2023/trail-running/0305_volta-per-l-ermita_12.3km",
+		executeName(t, `{{.Year}}/{{slug .Kind}}/{{.Month}}{{.Day}}_{{slug .Name}}_{{printf "%.1f" .Distance}}km`, nameData))
+	assert.Equal(t, "ESPAÑA_sunday_1h30m0s", executeName(t, `{{upper .Country}}_{{lower .Weekday}}_{{.Duration}}`, nameData))
+	assert.Equal(t, "unknown_track", executeName(t, `{{default "unknown" .EndCity}}_{{default "x" "track"}}`, nameData))
+
+	_, err := lib.ParseNameTemplate("{{.Year")
+	assert.NotNil(t, err)
+	tmpl, err := lib.ParseNameTemplate("{{.Missing}}")
+	assert.Nil(t, err)
+	_, err = tmpl.Execute(nameData)
+	assert.NotNil(t, err)
+}
+
+func TestNameTemplateFields(t *testing.T) {
+	data := nameData
+	data.City = "../etc/passwd"
+	data.Name = `a\b`
+	assert.Equal(t, ".._etc_passwd/a_b", executeName(t, "{{.City}}/{{.Name}}", data))
+}
+
+func TestNameTemplateUses(t *testing.T) {
+	tmpl, err := lib.ParseNameTemplate("{year}/{{slug .City}}_{{.CountryCode}}")
+	assert.Nil(t, err)
+	assert.True(t, tmpl.Uses("Year"))
+	assert.True(t, tmpl.Uses("Country", "City"))
+	assert.False(t, tmpl.Uses("Country"))
+	assert.False(t, tmpl.Uses("Quality", "Hash"))
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "cami-de-ronda-sant-feliu", lib.Slug("  Camí de Ronda: Sant Feliu! "))
+	assert.Equal(t, "muhlenweg-2", lib.Slug("Mühlenweg #2"))
+	assert.Equal(t, "", lib.Slug("---"))
+}
+
+func TestSanitizePath(t *testing.T) {
+	assert.Equal(t, "a/b", lib.SanitizePath("/a//b/"))
+	assert.Equal(t, "_/_/x", lib.SanitizePath("../ ./x"))
+	assert.Equal(t, "a_b_c_d", lib.SanitizePath(`a:b?c*d`))
+	assert.Equal(t, "_CON/_nul.gpx/com1x", lib.SanitizePath("CON/nul.gpx/com1x"))
+	assert.Equal(t, "name", lib.SanitizePath("name. "))
+	assert.Equal(t, strings.Repeat("ñ", 100), lib.SanitizePath(strings.Repeat("ñ", 300)))
+}
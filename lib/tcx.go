@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/twpayne/go-gpx"
+	"golang.org/x/net/html/charset"
+)
+
+// Garmin Training Center XML, see https://www8.garmin.com/xmlschemas/TrainingCenterDatabasev2.xsd
+
+type tcxDatabase struct {
+	XMLName    xml.Name      `xml:"http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2 TrainingCenterDatabase"`
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport   string      `xml:"Sport,attr"`
+	ID      time.Time   `xml:"Id"`
+	Laps    []tcxLap    `xml:"Lap"`
+	Creator *tcxCreator `xml:"Creator,omitempty"`
+}
+
+// tcxCreator is a Device_t, all the elements are required by the schema.
+type tcxCreator struct {
+	Type      string      `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Name      string      `xml:"Name"`
+	UnitID    uint32      `xml:"UnitId"`
+	ProductID uint16      `xml:"ProductID"`
+	Version   *tcxVersion `xml:"Version"`
+}
+
+type tcxVersion struct {
+	VersionMajor uint16 `xml:"VersionMajor"`
+	VersionMinor uint16 `xml:"VersionMinor"`
+}
+
+type tcxLap struct {
+	StartTime        time.Time  `xml:"StartTime,attr"`
+	TotalTimeSeconds float64    `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64    `xml:"DistanceMeters"`
+	Calories         int        `xml:"Calories"`
+	Intensity        string     `xml:"Intensity"`
+	TriggerMethod    string     `xml:"TriggerMethod"`
+	Tracks           []tcxTrack `xml:"Track"`
+}
+
+type tcxTrack struct {
+	Trackpoints []tcxTrackpoint `xml:"Trackpoint"`
+}
+
+type tcxTrackpoint struct {
+	Time           time.Time      `xml:"Time"`
+	Position       *tcxPosition   `xml:"Position,omitempty"`
+	AltitudeMeters float64        `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters float64        `xml:"DistanceMeters,omitempty"`
+	HeartRateBpm   *tcxHeartRate  `xml:"HeartRateBpm,omitempty"`
+	Cadence        float64        `xml:"Cadence,omitempty"`
+	Extensions     *tcxExtensions `xml:"Extensions,omitempty"`
+}
+
+type tcxPosition struct {
+	LatitudeDegrees  float64 `xml:"LatitudeDegrees"`
+	LongitudeDegrees float64 `xml:"LongitudeDegrees"`
+}
+
+type tcxHeartRate struct {
+	Value float64 `xml:"Value"`
+}
+
+type tcxExtensions struct {
+	TPX *tcxTPX `xml:"http://www.garmin.com/xmlschemas/ActivityExtension/v2 TPX,omitempty"`
+}
+
+type tcxTPX struct {
+	Speed float64 `xml:"Speed,omitempty"`
+	Watts float64 `xml:"Watts,omitempty"`
+}
+
+// tcxInteger rounds a value of the schema that is an integer, like the heart rate that is an unsignedByte.
+func tcxInteger(value, max float64) float64 {
+	return math.Min(math.Max(math.Round(value), 0), max)
+}
+
+var tcxSports = map[string]string{
+	"Running": "running",
+	"Biking":  "cycling",
+}
+
+// ReadTCX reads a TCX file, each activity is converted to a track and each lap to a segment.
+func ReadTCX(r io.Reader) (*gpx.GPX, error) {
+	var db tcxDatabase
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	if err := d.Decode(&db); err != nil {
+		return nil, err
+	}
+
+	g := &gpx.GPX{
+		Version: "1.1",
+		Creator: "gotrackmaster",
+	}
+	for _, activity := range db.Activities {
+		if activity.Creator != nil && activity.Creator.Name != "" {
+			g.Creator = activity.Creator.Name
+		}
+		trk := &gpx.TrkType{Type: tcxSports[activity.Sport]}
+		if trk.Type == "" {
+			trk.Type = strings.ToLower(activity.Sport)
+		}
+		for _, lap := range activity.Laps {
+			seg := &gpx.TrkSegType{}
+			for _, track := range lap.Tracks {
+				for _, tp := range track.Trackpoints {
+					// a GPX point always needs a position
+					if tp.Position == nil {
+						continue
+					}
+					w := &gpx.WptType{
+						Lat:  tp.Position.LatitudeDegrees,
+						Lon:  tp.Position.LongitudeDegrees,
+						Ele:  tp.AltitudeMeters,
+						Time: tp.Time,
+					}
+					s := trackmaster.Sensor{
+						Cadence:  tp.Cadence,
+						Distance: tp.DistanceMeters,
+					}
+					if tp.HeartRateBpm != nil {
+						s.HeartRate = tp.HeartRateBpm.Value
+					}
+					if tp.Extensions != nil && tp.Extensions.TPX != nil {
+						s.Power = tp.Extensions.TPX.Watts
+						s.Speed = tp.Extensions.TPX.Speed
+					}
+					if !s.IsEmpty() {
+						trackmaster.SetSensor(w, s)
+					}
+					seg.TrkPt = append(seg.TrkPt, w)
+				}
+			}
+			if len(seg.TrkPt) > 0 {
+				trk.TrkSeg = append(trk.TrkSeg, seg)
+			}
+		}
+		if len(trk.TrkSeg) > 0 {
+			g.Trk = append(g.Trk, trk)
+		}
+	}
+
+	return g, nil
+}
+
+// WriteTCX writes the tracks as TCX, each track is written as an activity and each segment as a lap.
+func WriteTCX(w io.Writer, g gpx.GPX) error {
+	var db tcxDatabase
+	for _, TrkType := range g.Trk {
+		activity := tcxActivity{Sport: "Other"}
+		for k, v := range tcxSports {
+			if strings.EqualFold(v, TrkType.Type) {
+				activity.Sport = k
+			}
+		}
+		if g.Creator != "" {
+			activity.Creator = &tcxCreator{Type: "Device_t", Name: g.Creator, Version: &tcxVersion{}}
+		}
+
+		var distance float64
+		var previous *gpx.WptType
+		for _, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) == 0 {
+				continue
+			}
+			first := TrkSegType.TrkPt[0]
+			last := TrkSegType.TrkPt[len(TrkSegType.TrkPt)-1]
+			if activity.ID.IsZero() {
+				activity.ID = first.Time
+			}
+
+			lap := tcxLap{
+				StartTime:        first.Time,
+				TotalTimeSeconds: trackmaster.TimeDiff(*first, *last),
+				Intensity:        "Active",
+				TriggerMethod:    "Manual",
+			}
+			var track tcxTrack
+			start := distance
+			for _, WptType := range TrkSegType.TrkPt {
+				// the laps are consecutive, so the distance between them is added too
+				if previous != nil {
+					distance += trackmaster.Distance2D(*previous, *WptType)
+				}
+				previous = WptType
+				// the distance of the device is not used because the filters don't update it
+				s := trackmaster.GetSensor(*WptType)
+				tp := tcxTrackpoint{
+					Time:           WptType.Time,
+					Position:       &tcxPosition{LatitudeDegrees: WptType.Lat, LongitudeDegrees: WptType.Lon},
+					AltitudeMeters: WptType.Ele,
+					DistanceMeters: distance,
+					Cadence:        tcxInteger(s.Cadence, math.MaxUint8),
+				}
+				if heartRate := tcxInteger(s.HeartRate, math.MaxUint8); heartRate != 0 {
+					tp.HeartRateBpm = &tcxHeartRate{Value: heartRate}
+				}
+				if s.Power != 0 || s.Speed != 0 {
+					tp.Extensions = &tcxExtensions{TPX: &tcxTPX{Speed: s.Speed, Watts: tcxInteger(s.Power, math.MaxUint16)}}
+				}
+				track.Trackpoints = append(track.Trackpoints, tp)
+			}
+			lap.DistanceMeters = distance - start
+			lap.Tracks = append(lap.Tracks, track)
+			activity.Laps = append(activity.Laps, lap)
+		}
+		db.Activities = append(db.Activities, activity)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+	return e.Encode(db)
+}
@@ -0,0 +1,114 @@
+package lib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+const tcxSample = `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2022-05-01T07:00:00.000Z</Id>
+      <Lap StartTime="2022-05-01T07:00:00.000Z">
+        <TotalTimeSeconds>2</TotalTimeSeconds>
+        <DistanceMeters>20</DistanceMeters>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Manual</TriggerMethod>
+        <Track>
+          <Trackpoint>
+            <Time>2022-05-01T07:00:00.000Z</Time>
+            <Position><LatitudeDegrees>39.9299175</LatitudeDegrees><LongitudeDegrees>-0.3367962</LongitudeDegrees></Position>
+            <AltitudeMeters>333.9</AltitudeMeters>
+            <DistanceMeters>0</DistanceMeters>
+            <HeartRateBpm><Value>101</Value></HeartRateBpm>
+            <Cadence>80</Cadence>
+            <Extensions><ns3:TPX><ns3:Watts>180</ns3:Watts></ns3:TPX></Extensions>
+          </Trackpoint>
+          <Trackpoint>
+            <Time>2022-05-01T07:00:02.000Z</Time>
+            <Position><LatitudeDegrees>39.9300175</LatitudeDegrees><LongitudeDegrees>-0.3367962</LongitudeDegrees></Position>
+            <AltitudeMeters>334.2</AltitudeMeters>
+            <DistanceMeters>11.1</DistanceMeters>
+            <HeartRateBpm><Value>103</Value></HeartRateBpm>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Lap StartTime="2022-05-01T07:00:04.000Z">
+        <TotalTimeSeconds>0</TotalTimeSeconds>
+        <DistanceMeters>0</DistanceMeters>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Manual</TriggerMethod>
+        <Track>
+          <Trackpoint>
+            <Time>2022-05-01T07:00:04.000Z</Time>
+            <Position><LatitudeDegrees>39.9301175</LatitudeDegrees><LongitudeDegrees>-0.3367962</LongitudeDegrees></Position>
+            <DistanceMeters>22.2</DistanceMeters>
+          </Trackpoint>
+        </Track>
+      </Lap>
+      <Creator><Name>Forerunner 245</Name></Creator>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+// TestTCXRoundTrip tests that laps and sensors survive reading and writing a TCX file.
+func TestTCXRoundTrip(t *testing.T) {
+	g, err := lib.ReadTCX(strings.NewReader(tcxSample))
+	assert.NoError(t, err)
+	assert.Len(t, g.Trk, 1)
+	assert.Equal(t, "cycling", g.Trk[0].Type)
+	assert.Equal(t, "Forerunner 245", g.Creator)
+	assert.Len(t, g.Trk[0].TrkSeg, 2)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 2)
+	s := trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[0])
+	assert.Equal(t, trackmaster.Sensor{HeartRate: 101, Cadence: 80, Power: 180}, s)
+
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteTCX(&b, *g))
+	r, err := lib.ReadTCX(bytes.NewReader(b.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, g.Creator, r.Creator)
+	assert.Len(t, r.Trk[0].TrkSeg, 2)
+	for trkSegTypeNo, TrkSegType := range r.Trk[0].TrkSeg {
+		assert.Len(t, TrkSegType.TrkPt, len(g.Trk[0].TrkSeg[trkSegTypeNo].TrkPt))
+		for wptTypeNo, WptType := range TrkSegType.TrkPt {
+			original := g.Trk[0].TrkSeg[trkSegTypeNo].TrkPt[wptTypeNo]
+			assert.Equal(t, original.Lat, WptType.Lat)
+			assert.Equal(t, original.Ele, WptType.Ele)
+			assert.True(t, original.Time.Equal(WptType.Time))
+			// the distance is calculated again from the positions
+			expected, sensor := trackmaster.GetSensor(*original), trackmaster.GetSensor(*WptType)
+			assert.InDelta(t, expected.Distance, sensor.Distance, 0.1)
+			expected.Distance, sensor.Distance = 0, 0
+			assert.Equal(t, expected, sensor)
+		}
+	}
+	assert.Contains(t, b.String(), "<UnitId>0</UnitId>")
+}
+
+// TestTCXSensorIntegers tests that the heart rate, the cadence and the power are written as integers and the speed
+// is kept.
+func TestTCXSensorIntegers(t *testing.T) {
+	g, err := lib.ReadTCX(strings.NewReader(tcxSample))
+	assert.NoError(t, err)
+	w := g.Trk[0].TrkSeg[0].TrkPt[0]
+	trackmaster.SetSensor(w, trackmaster.Sensor{HeartRate: 101.6, Cadence: 80.4, Power: 180.5, Speed: 3.5})
+
+	var b bytes.Buffer
+	assert.NoError(t, lib.WriteTCX(&b, *g))
+	assert.Contains(t, b.String(), "<Value>102</Value>")
+	assert.Contains(t, b.String(), "<Cadence>80</Cadence>")
+	assert.Contains(t, b.String(), "<Watts>181</Watts>")
+
+	r, err := lib.ReadTCX(bytes.NewReader(b.Bytes()))
+	assert.NoError(t, err)
+	s := trackmaster.GetSensor(*r.Trk[0].TrkSeg[0].TrkPt[0])
+	assert.Equal(t, 3.5, s.Speed)
+	assert.Equal(t, 102.0, s.HeartRate)
+}
@@ -0,0 +1,211 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	TransferCopy     = "copy"
+	TransferMove     = "move"
+	TransferHardlink = "hardlink"
+	TransferSymlink  = "symlink"
+)
+
+// ValidTransferMode returns true when the mode is copy, move, hardlink or symlink.
+func ValidTransferMode(mode string) bool {
+	return mode == TransferCopy || mode == TransferMove || mode == TransferHardlink || mode == TransferSymlink
+}
+
+// TransferFile copies, moves or links src to dst. The file is created with a temporary name and renamed,
+// so an existing dst is replaced atomically and an interrupted transfer doesn't leave a partial file.
+// The symbolic links point to the absolute path of src.
+func TransferFile(src, dst, mode string) error {
+	if !ValidTransferMode(mode) {
+		return fmt.Errorf("unknown transfer mode %s", mode)
+	}
+	if mode == TransferMove {
+		err := os.Rename(src, dst)
+		var linkErr *os.LinkError
+		// rename doesn't work between file systems
+		if !errors.As(err, &linkErr) || !errors.Is(linkErr.Err, syscall.EXDEV) {
+			return err
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*"+tempExtension)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	// the links can't replace an existing file
+	if mode == TransferHardlink || mode == TransferSymlink {
+		if err := os.Remove(tmp); err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case TransferHardlink:
+		err = os.Link(src, tmp)
+	case TransferSymlink:
+		var abs string
+		if abs, err = filepath.Abs(src); err == nil {
+			err = os.Symlink(abs, tmp)
+		}
+	default:
+		var info os.FileInfo
+		if info, err = os.Stat(src); err == nil {
+			err = CopyFile(src, tmp)
+		}
+		// the temporary files are created only readable by the owner
+		if err == nil {
+			err = os.Chmod(tmp, info.Mode().Perm())
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if mode == TransferMove {
+		return os.Remove(src)
+	}
+	return nil
+}
+
+// SameFile returns true when both names are the same file, a link to it or a file with the same content.
+func SameFile(a, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(infoA, infoB) {
+		return true, nil
+	}
+	if infoA.Size() != infoB.Size() {
+		return false, nil
+	}
+	hashA, err := FileHash(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := FileHash(b)
+	return err == nil && hashA == hashB, err
+}
+
+// ImportJournalName is the file of the destination directory where the imported tracks are recorded.
+const ImportJournalName = ".gotrackmaster-import.jsonl"
+
+// ImportJournalEntry is a track imported with all its targets, the size and the modification time of
+// the source are used to know if it changed after the import.
+type ImportJournalEntry struct {
+	Source  string    `json:"source"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Targets []string  `json:"targets"`
+}
+
+// ImportJournal records the tracks imported into a directory, so an import that failed midway can be
+// resumed without processing again the tracks that were already imported.
+type ImportJournal struct {
+	filename string
+	entries  map[string]ImportJournalEntry
+}
+
+// OpenImportJournal reads the journal of a destination directory, it is empty when the file doesn't exist.
+func OpenImportJournal(dir string) (*ImportJournal, error) {
+	j := &ImportJournal{
+		filename: filepath.Join(dir, ImportJournalName),
+		entries:  make(map[string]ImportJournalEntry),
+	}
+	f, err := os.Open(j.filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var e ImportJournalEntry
+		// the last line can be incomplete when the import was interrupted
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			j.entries[e.Source] = e
+		}
+	}
+	return j, scanner.Err()
+}
+
+// Done returns true when the source has been imported, it has not changed since and all its targets exist.
+func (j *ImportJournal) Done(source string) bool {
+	path, err := filepath.Abs(source)
+	if err != nil {
+		return false
+	}
+	e, found := j.entries[path]
+	if !found {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != e.Size || !info.ModTime().Equal(e.ModTime) {
+		return false
+	}
+	for _, target := range e.Targets {
+		if _, err := os.Lstat(target); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Add records that the source has been imported to the targets, the entry is appended to the file at once.
+func (j *ImportJournal) Add(source string, targets []string) error {
+	path, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	e := ImportJournalEntry{Source: path, Size: info.Size(), ModTime: info.ModTime(), Targets: targets}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.filename), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(j.filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	j.entries[path] = e
+	return nil
+}
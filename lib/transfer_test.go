@@ -0,0 +1,68 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.gpx")
+	assert.Nil(t, os.WriteFile(src, []byte("track"), 0o644))
+
+	for _, mode := range []string{lib.TransferCopy, lib.TransferHardlink, lib.TransferSymlink} {
+		dst := filepath.Join(dir, mode+".gpx")
+		assert.Nil(t, os.WriteFile(dst, []byte("old"), 0o644))
+		assert.Nil(t, lib.TransferFile(src, dst, mode))
+		data, err := os.ReadFile(dst)
+		assert.Nil(t, err)
+		assert.Equal(t, "track", string(data))
+		same, err := lib.SameFile(src, dst)
+		assert.Nil(t, err)
+		assert.True(t, same)
+	}
+	info, err := os.Lstat(filepath.Join(dir, "symlink.gpx"))
+	assert.Nil(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	dst := filepath.Join(dir, "move.gpx")
+	assert.Nil(t, lib.TransferFile(src, dst, lib.TransferMove))
+	_, err = os.Stat(src)
+	assert.True(t, os.IsNotExist(err))
+	assert.NotNil(t, lib.TransferFile(dst, src, "rsync"))
+
+	// the temporary files are removed
+	files, err := filepath.Glob(filepath.Join(dir, ".*"))
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestImportJournal(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.gpx")
+	dst := filepath.Join(dir, "dst", "track.gpx")
+	assert.Nil(t, os.WriteFile(src, []byte("track"), 0o644))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(dst), 0o755))
+	assert.Nil(t, os.WriteFile(dst, []byte("track"), 0o644))
+
+	j, err := lib.OpenImportJournal(filepath.Join(dir, "dst"))
+	assert.Nil(t, err)
+	assert.False(t, j.Done(src))
+	assert.Nil(t, j.Add(src, []string{dst}))
+	assert.True(t, j.Done(src))
+
+	j, err = lib.OpenImportJournal(filepath.Join(dir, "dst"))
+	assert.Nil(t, err)
+	assert.True(t, j.Done(src))
+
+	// the track is imported again when the target is removed or the source changes
+	assert.Nil(t, os.WriteFile(src, []byte("changed track"), 0o644))
+	assert.False(t, j.Done(src))
+	assert.Nil(t, j.Add(src, []string{dst}))
+	assert.Nil(t, os.Remove(dst))
+	assert.False(t, j.Done(src))
+}
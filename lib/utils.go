@@ -1,111 +1,47 @@
 package lib
 
 import (
-	"fmt"
+	"errors"
 	"io"
-	"log"
+	"io/fs"
 	"os"
-
-	"github.com/gabriel-vasile/mimetype"
-	"github.com/karrick/godirwalk"
-	"github.com/twpayne/go-gpx"
 )
 
-var (
-	Tracks     []string
-	TrackValid int
-	TrackError int
+const (
+	// BackupExtension is added to the copies of the tracks kept before they are overwritten
+	BackupExtension = ".orig"
+	tempExtension   = ".tmp"
 )
 
-func ReadGPX(filename string) {
-	mtype, err := mimetype.DetectFile(filename)
-	if err != nil {
-		log.Fatal(ColorRed(err))
-	}
-
-	if !mtype.Is("application/gpx+xml") && !mtype.Is("text/xml") {
-		return
+// BackupFile copies the file to a file with the backup extension before it is overwritten. An existing
+// backup is kept, so it always contains the original track.
+func BackupFile(filename string) error {
+	if _, err := os.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+		return nil
 	}
-
-	fmt.Printf("Reading: %v \n", filename)
-
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Println(ColorYellow("Warning: GPX file could not be processed, error: ", ColorRed(err)))
-		TrackError++
-		return
+	backup := filename + BackupExtension
+	if _, err := os.Stat(backup); err == nil {
+		return nil
 	}
-	defer file.Close()
-
-	_, err = gpx.Read(file)
-	if err != nil {
-		fmt.Println(ColorYellow("Warning: GPX file could not be processed, error: ", ColorRed(err)))
-		TrackError++
-		return
-	}
-
-	Tracks = append(Tracks, filename)
-	TrackValid++
+	return CopyFile(filename, backup)
 }
 
-func ReadGPXDir(trackDir string) {
-	err := godirwalk.Walk(trackDir, &godirwalk.Options{
-		Callback: func(path string, de *godirwalk.Dirent) error {
-			if de.IsDir() {
-				return nil // do not remove directory that was provided top-level directory
-			}
-
-			ReadGPX(path)
-
-			return nil
-		},
-		Unsorted: false,
-	})
-	if err != nil {
-		fmt.Println(err)
-	}
-}
-
-func ReadTracks(track string) {
-	fileInfo, err := os.Stat(track)
-	if err != nil {
-		log.Fatal(ColorRed("No open GPX path"))
-	}
-
-	Pass("Reading tracks...")
-
-	if fileInfo.IsDir() {
-		ReadGPXDir(track)
-	} else {
-		ReadGPX(track)
-	}
-
-	if len(Tracks) == 0 {
-		Warning("There is no track processed\n")
-	}
-
-	if TrackError == 0 {
-		fmt.Printf(ColorGreen("Located %d track(s)\n"), TrackValid)
-	} else {
-		fmt.Printf(ColorYellow("Located %d track(s), %d with error(s)\n"), TrackValid, TrackError)
-	}
-}
-
-func CopyFile(src, dst string) {
+// CopyFile copies the file src to dst, dst is replaced when it exists.
+func CopyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
-		log.Print(ColorRed(err))
+		return err
 	}
 	defer srcFile.Close()
 
 	dstFile, err := os.Create(dst)
 	if err != nil {
-		log.Print(ColorRed(err))
+		return err
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		log.Print(ColorRed(err))
+	if _, err = io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
 	}
+	return dstFile.Close()
 }
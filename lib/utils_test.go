@@ -0,0 +1,49 @@
+package lib_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inode64/gotrackmaster/lib"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestWriteTrackFile tests that the track is replaced without temporary files and keeps the permissions.
+func TestWriteTrackFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "track.gpx")
+	assert.Nil(t, os.WriteFile(filename, []byte("old"), 0o640))
+
+	g := gpx.GPX{Version: "1.1", Wpt: []*gpx.WptType{{Lat: 42, Lon: 2}}}
+	assert.Nil(t, lib.WriteTrackFile(g, filename))
+
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+	fileInfo, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0o640), fileInfo.Mode().Perm())
+
+	r, err := lib.TrackFile{Filename: filename, Format: lib.Formats[0]}.Read()
+	assert.Nil(t, err)
+	assert.Len(t, r.Wpt, 1)
+}
+
+// TestBackupFile tests that the first backup is kept when the file is overwritten several times.
+func TestBackupFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "track.gpx")
+	assert.Nil(t, lib.BackupFile(filename))
+	_, err := os.Stat(filename + lib.BackupExtension)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, os.WriteFile(filename, []byte("original"), 0o644))
+	assert.Nil(t, lib.BackupFile(filename))
+	assert.Nil(t, os.WriteFile(filename, []byte("changed"), 0o644))
+	assert.Nil(t, lib.BackupFile(filename))
+
+	data, err := os.ReadFile(filename + lib.BackupExtension)
+	assert.Nil(t, err)
+	assert.Equal(t, "original", string(data))
+}
@@ -1,7 +1,9 @@
 package trackmaster
 
 import (
+	"encoding/json"
 	"errors"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	gpx "github.com/twpayne/go-gpx"
@@ -25,6 +27,32 @@ type GPXElementInfo struct {
 	WptType       gpx.WptType
 }
 
+// MarshalJSON returns the indices, the values and the coordinates of the point.
+func (e GPXElementInfo) MarshalJSON() ([]byte, error) {
+	var t *time.Time
+	if !e.WptType.Time.IsZero() {
+		t = &e.WptType.Time
+	}
+	return json.Marshal(struct {
+		TrkTypeNo     int        `json:"track"`
+		TrkSegTypeNo  int        `json:"segment"`
+		WptTypeNo     int        `json:"point"`
+		Count         int        `json:"count,omitempty"`
+		Length        float64    `json:"length,omitempty"`
+		Speed         float64    `json:"speed,omitempty"`
+		SpeedVertical float64    `json:"speedVertical,omitempty"`
+		Elevation     float64    `json:"elevation,omitempty"`
+		Duration      float64    `json:"duration,omitempty"`
+		Lat           float64    `json:"lat"`
+		Lon           float64    `json:"lon"`
+		Ele           float64    `json:"ele,omitempty"`
+		Time          *time.Time `json:"time,omitempty"`
+	}{
+		e.TrkTypeNo, e.TrkSegTypeNo, e.WptTypeNo, e.Count, e.Length, e.Speed, e.SpeedVertical, e.Elevation, e.Duration,
+		e.WptType.Lat, e.WptType.Lon, e.WptType.Ele, t,
+	})
+}
+
 const (
 	ClassificationNone             = "Unknown"
 	ClassificationCyClingSport     = "Cycling Sport"
@@ -0,0 +1,182 @@
+package trackmaster
+
+import (
+	"math"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+const (
+	DiffRemoved  = "removed"
+	DiffInserted = "inserted"
+	DiffMoved    = "moved"
+)
+
+const (
+	// diffWindow is the number of points searched ahead to align the two versions of a track
+	diffWindow = 200
+	// diffEpsilon is the minimum change in meters or seconds that is considered a move
+	diffEpsilon = 0.01
+)
+
+// DiffPoint is a point that changed between two versions of a track, Before is nil for the inserted
+// points and After is nil for the removed points. Distance is in meters, Elevation in meters and Time
+// in seconds, from Before to After.
+type DiffPoint struct {
+	Kind      string          `json:"kind"`
+	Before    *GPXElementInfo `json:"before,omitempty"`
+	After     *GPXElementInfo `json:"after,omitempty"`
+	Distance  float64         `json:"distance,omitempty"`
+	Elevation float64         `json:"elevation,omitempty"`
+	Time      float64         `json:"time,omitempty"`
+}
+
+// DiffStats is the summary of the changes between two versions of a track.
+type DiffStats struct {
+	PointsBefore   int     `json:"pointsBefore"`
+	PointsAfter    int     `json:"pointsAfter"`
+	Removed        int     `json:"removed"`
+	Inserted       int     `json:"inserted"`
+	Moved          int     `json:"moved"`
+	MaxMoved       float64 `json:"maxMoved"`
+	DistanceBefore float64 `json:"distanceBefore"`
+	DistanceAfter  float64 `json:"distanceAfter"`
+	GainBefore     float64 `json:"gainBefore"`
+	GainAfter      float64 `json:"gainAfter"`
+}
+
+// DiffResult contains the points that changed between two versions of a track.
+type DiffResult struct {
+	Points []DiffPoint `json:"points,omitempty"`
+	Stats  DiffStats   `json:"stats"`
+}
+
+// Changed returns true when a point was removed, inserted or moved.
+func (d DiffResult) Changed() bool {
+	return len(d.Points) > 0
+}
+
+// flattenPoints returns the points of all the segments in order with their indices.
+func flattenPoints(g gpx.GPX) []GPXElementInfo {
+	var result []GPXElementInfo
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			for WptTypeNo, WptType := range TrkSegType.TrkPt {
+				result = append(result, GPXElementInfo{
+					TrkTypeNo:    TrkTypeNo,
+					TrkSegTypeNo: TrkSegTypeNo,
+					WptTypeNo:    WptTypeNo,
+					WptType:      *WptType,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// samePoint returns true when two points are the same point of the track, they have the same time
+// or the same position.
+func samePoint(a, b gpx.WptType) bool {
+	if timeValid(a.Time) && timeValid(b.Time) && a.Time.Equal(b.Time) {
+		return true
+	}
+	return Distance2D(a, b) < diffEpsilon
+}
+
+// findPoint returns the offset of the first point of the window that is the same point as w, or -1.
+func findPoint(points []GPXElementInfo, w gpx.WptType) int {
+	for k := 0; k < len(points) && k < diffWindow; k++ {
+		if samePoint(points[k].WptType, w) {
+			return k
+		}
+	}
+	return -1
+}
+
+// Diff aligns two versions of a track and returns the points removed, inserted and moved. The points with
+// the same time or position are aligned searching a window of points ahead, the filters keep the order
+// of the points.
+func Diff(before, after gpx.GPX) DiffResult {
+	a := flattenPoints(before)
+	b := flattenPoints(after)
+
+	var result DiffResult
+	removed := func(e GPXElementInfo) {
+		result.Points = append(result.Points, DiffPoint{Kind: DiffRemoved, Before: &e})
+		result.Stats.Removed++
+	}
+	inserted := func(e GPXElementInfo) {
+		result.Points = append(result.Points, DiffPoint{Kind: DiffInserted, After: &e})
+		result.Stats.Inserted++
+	}
+	moved := func(e, o GPXElementInfo) {
+		p := DiffPoint{
+			Kind:      DiffMoved,
+			Before:    &e,
+			After:     &o,
+			Distance:  HaversineDistanceTrkPt(e.WptType, o.WptType),
+			Elevation: o.WptType.Ele - e.WptType.Ele,
+		}
+		if timeValid(e.WptType.Time) && timeValid(o.WptType.Time) {
+			p.Time = o.WptType.Time.Sub(e.WptType.Time).Seconds()
+		}
+		if p.Distance < diffEpsilon && math.Abs(p.Elevation) < diffEpsilon && math.Abs(p.Time) < diffEpsilon {
+			return
+		}
+		result.Points = append(result.Points, p)
+		result.Stats.Moved++
+		result.Stats.MaxMoved = math.Max(result.Stats.MaxMoved, p.Distance)
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j >= len(b):
+			removed(a[i])
+			i++
+		case i >= len(a):
+			inserted(b[j])
+			j++
+		case samePoint(a[i].WptType, b[j].WptType):
+			moved(a[i], b[j])
+			i++
+			j++
+		default:
+			ahead := findPoint(b[j+1:], a[i].WptType)
+			behind := findPoint(a[i+1:], b[j].WptType)
+			switch {
+			case ahead >= 0 && (behind < 0 || ahead <= behind):
+				for k := 0; k <= ahead; k++ {
+					inserted(b[j+k])
+				}
+				j += ahead + 1
+			case behind >= 0:
+				for k := 0; k <= behind; k++ {
+					removed(a[i+k])
+				}
+				i += behind + 1
+			case timeValid(a[i].WptType.Time) && timeValid(b[j].WptType.Time) && a[i].WptType.Time.Before(b[j].WptType.Time):
+				removed(a[i])
+				i++
+			case timeValid(a[i].WptType.Time) && timeValid(b[j].WptType.Time):
+				inserted(b[j])
+				j++
+			default:
+				// the point has changed its position and there isn't time to align it
+				moved(a[i], b[j])
+				i++
+				j++
+			}
+		}
+	}
+
+	summaryBefore := Summary(before, DefaultSummaryConfig()).Total
+	summaryAfter := Summary(after, DefaultSummaryConfig()).Total
+	result.Stats.PointsBefore = len(a)
+	result.Stats.PointsAfter = len(b)
+	result.Stats.DistanceBefore = summaryBefore.Distance2D
+	result.Stats.DistanceAfter = summaryAfter.Distance2D
+	result.Stats.GainBefore = summaryBefore.Gain
+	result.Stats.GainAfter = summaryAfter.Gain
+	return result
+}
@@ -0,0 +1,59 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+func diffGPX(n int, withTime bool) gpx.GPX {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < n; i++ {
+		w := &gpx.WptType{Lat: 40 + float64(i)*0.001, Lon: 0.1, Ele: 100 + float64(i)}
+		if withTime {
+			w.Time = start.Add(time.Duration(i*10) * time.Second)
+		}
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	return gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+// TestDiff tests the alignment of the removed, inserted and moved points with and without time.
+func TestDiff(t *testing.T) {
+	for _, withTime := range []bool{true, false} {
+		before := diffGPX(10, withTime)
+		after := trackmaster.Clone(before)
+		points := after.Trk[0].TrkSeg[0].TrkPt
+		// remove the points 2 and 3, move the point 5 and insert a point after the point 7
+		inserted := *points[7]
+		inserted.Lon += 0.001
+		inserted.Time = inserted.Time.Add(5 * time.Second)
+		points[5].Ele += 10
+		points = append(points[:2], points[4:]...)
+		points = append(points[:6], append([]*gpx.WptType{&inserted}, points[6:]...)...)
+		after.Trk[0].TrkSeg[0].TrkPt = points
+
+		d := trackmaster.Diff(before, after)
+		assert.True(t, d.Changed())
+		assert.Equal(t, 2, d.Stats.Removed)
+		assert.Equal(t, 1, d.Stats.Inserted)
+		assert.Equal(t, 1, d.Stats.Moved)
+		assert.Equal(t, 10, d.Stats.PointsBefore)
+		assert.Equal(t, 9, d.Stats.PointsAfter)
+
+		assert.Equal(t, trackmaster.DiffRemoved, d.Points[0].Kind)
+		assert.Equal(t, 2, d.Points[0].Before.WptTypeNo)
+		assert.Equal(t, trackmaster.DiffMoved, d.Points[2].Kind)
+		assert.InDelta(t, 10, d.Points[2].Elevation, 1e-9)
+		assert.Equal(t, trackmaster.DiffInserted, d.Points[3].Kind)
+		assert.Equal(t, 6, d.Points[3].After.WptTypeNo)
+		assert.Greater(t, d.Stats.GainAfter, d.Stats.GainBefore)
+	}
+
+	d := trackmaster.Diff(diffGPX(5, true), diffGPX(5, true))
+	assert.False(t, d.Changed())
+}
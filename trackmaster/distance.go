@@ -53,6 +53,20 @@ func HaversineDistanceTrkPt(pointA, pointB gpx.WptType) float64 {
 	return HaversineDistance(pointA.Lat, pointA.Lon, pointB.Lat, pointB.Lon)
 }
 
+// GaussianConfig defines the window and the sigma of the Gaussian filter.
+type GaussianConfig struct {
+	WindowSize int
+	Sigma      float64
+}
+
+// DefaultGaussianConfig returns the configuration used by the smoothgaussiandistance command.
+func DefaultGaussianConfig() GaussianConfig {
+	return GaussianConfig{
+		WindowSize: 1,
+		Sigma:      1.1,
+	}
+}
+
 // Gaussian smooths the positions of a GPX file using a Gaussian filter.
 func SmoothGaussian(g gpx.GPX, windowSize int, sigma float64) {
 	for _, TrkType := range g.Trk {
@@ -132,6 +146,7 @@ func RemoveFirstNoise(g gpx.GPX, fix bool) []GPXElementInfo {
 					}
 					result = append(result, point)
 					if fix {
+						mergeSensorPoints(TrkSegType.TrkPt[i], TrkSegType.TrkPt[i+1:closerPoint])
 						dst = append(dst, TrkSegType.TrkPt[i])
 						if closerPoint >= 10 {
 							dst = append(dst, TrkSegType.TrkPt[closerPoint:]...)
@@ -156,6 +171,22 @@ func RemoveFirstNoise(g gpx.GPX, fix bool) []GPXElementInfo {
 	return result
 }
 
+// NoiseConfig defines the points that are considered noise, distances are in meters.
+type NoiseConfig struct {
+	MaxDistance  float64
+	MaxElevation float64
+	MaxPoints    int
+}
+
+// DefaultNoiseConfig returns the configuration used by the removenoise command.
+func DefaultNoiseConfig() NoiseConfig {
+	return NoiseConfig{
+		MaxDistance:  6,
+		MaxElevation: 1.1,
+		MaxPoints:    4,
+	}
+}
+
 func RemoveNoise(g gpx.GPX, maxDistance, maxElevation float64, maxPoints int, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
 	for TrkTypeNo, TrkType := range g.Trk {
@@ -172,6 +203,9 @@ func RemoveNoise(g gpx.GPX, maxDistance, maxElevation float64, maxPoints int, fi
 						TrkTypeNo:    TrkTypeNo,
 					}
 					result = append(result, point)
+					if fix {
+						mergeSensorPoints(TrkSegType.TrkPt[wptTypeNo], TrkSegType.TrkPt[wptTypeNo+1:closerPoint])
+					}
 					dst = append(dst, TrkSegType.TrkPt[wptTypeNo])
 					dst = append(dst, TrkSegType.TrkPt[closerPoint])
 					wptTypeNo = closerPoint
@@ -187,6 +221,24 @@ func RemoveNoise(g gpx.GPX, maxDistance, maxElevation float64, maxPoints int, fi
 	return result
 }
 
+// StopsConfig defines the points that are considered a stop, distances are in meters and times in seconds.
+type StopsConfig struct {
+	MinSeconds   float64
+	MaxDistance  float64
+	MaxElevation float64
+	MinPoints    int
+}
+
+// DefaultStopsConfig returns the configuration used by the removestops command.
+func DefaultStopsConfig() StopsConfig {
+	return StopsConfig{
+		MinSeconds:   90,
+		MaxDistance:  5,
+		MaxElevation: 0.5,
+		MinPoints:    3,
+	}
+}
+
 func RemoveStops(g gpx.GPX, minSeconds, maxDistance, maxElevation float64, minPoints int, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
 	var distance float64
@@ -227,6 +279,14 @@ func RemoveStops(g gpx.GPX, minSeconds, maxDistance, maxElevation float64, minPo
 							Duration:     seconds,
 						}
 						result = append(result, point)
+						if fix {
+							// the points of the stop are removed, but not their sensor values
+							last := wptTypeNo + 1
+							if minPoints != 0 {
+								last = wptTypeNo
+							}
+							mergeSensorPoints(TrkSegType.TrkPt[firstPoint], TrkSegType.TrkPt[firstPoint+1:last])
+						}
 						if numPoints > minPoints && seconds > minSeconds {
 							dst = append(dst, TrkSegType.TrkPt[firstPoint])
 						} else {
@@ -246,6 +306,23 @@ func RemoveStops(g gpx.GPX, minSeconds, maxDistance, maxElevation float64, minPo
 					firstPoint, numPoints = -1, 0
 				}
 			}
+			// the stop at the end of the segment is reported also without fix, so it is not counted as moving
+			if last := len(TrkSegType.TrkPt) - 1; numPoints > minPoints && TimeDiff(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[last]) > minSeconds {
+				distance = HaversineDistanceTrkPt(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[last])
+				elevation := ElevationAbs(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[last])
+				seconds := TimeDiff(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[last])
+				point := GPXElementInfo{
+					WptType:      *TrkSegType.TrkPt[firstPoint],
+					WptTypeNo:    firstPoint,
+					TrkSegTypeNo: TrkSegTypeNo,
+					TrkTypeNo:    TrkTypeNo,
+					Count:        numPoints,
+					Length:       distance,
+					Elevation:    elevation,
+					Duration:     seconds,
+				}
+				result = append(result, point)
+			}
 			if fix {
 				if numPoints == 0 {
 					if len(TrkSegType.TrkPt) != 0 {
@@ -253,20 +330,6 @@ func RemoveStops(g gpx.GPX, minSeconds, maxDistance, maxElevation float64, minPo
 					}
 				} else {
 					dst = append(dst, TrkSegType.TrkPt[firstPoint:]...)
-					distance = HaversineDistanceTrkPt(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[len(TrkSegType.TrkPt)-1])
-					elevation := ElevationAbs(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[len(TrkSegType.TrkPt)-1])
-					seconds := TimeDiff(*TrkSegType.TrkPt[firstPoint], *TrkSegType.TrkPt[len(TrkSegType.TrkPt)-1])
-					point := GPXElementInfo{
-						WptType:      *TrkSegType.TrkPt[firstPoint],
-						WptTypeNo:    firstPoint,
-						TrkSegTypeNo: TrkSegTypeNo,
-						TrkTypeNo:    TrkTypeNo,
-						Count:        numPoints,
-						Length:       distance,
-						Elevation:    elevation,
-						Duration:     seconds,
-					}
-					result = append(result, point)
 				}
 				g.Trk[TrkTypeNo].TrkSeg[TrkSegTypeNo].TrkPt = dst
 			}
@@ -308,6 +371,9 @@ func orientation(p, q, r gpx.WptType) int {
 	return 2
 }
 
+// DefaultIntersectionPoints is the maximum number of points of an intersection used by the removeintersections command.
+const DefaultIntersectionPoints = 6
+
 // CheckIntersecting - check intersecting segments.
 func RemoveIntersections(g gpx.GPX, max int, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
@@ -331,6 +397,7 @@ func RemoveIntersections(g gpx.GPX, max int, fix bool) []GPXElementInfo {
 				}
 				if lastPoint != -1 {
 					if fix {
+						mergeSensorPoints(TrkSegType.TrkPt[wptTypeNo], TrkSegType.TrkPt[wptTypeNo+1:lastPoint])
 						TrkSegType.TrkPt = append(TrkSegType.TrkPt[:wptTypeNo+1], TrkSegType.TrkPt[lastPoint:]...)
 					}
 					wptTypeNo = lastPoint - 1
@@ -437,8 +504,9 @@ func GetPositionStart(g gpx.GPX) gpx.WptType {
 }
 
 func GetPositionEnd(g gpx.GPX) gpx.WptType {
-	for _, TrkType := range g.Trk {
-		for _, TrkSegType := range TrkType.TrkSeg {
+	for t := len(g.Trk) - 1; t >= 0; t-- {
+		for s := len(g.Trk[t].TrkSeg) - 1; s >= 0; s-- {
+			TrkSegType := g.Trk[t].TrkSeg[s]
 			for i := len(TrkSegType.TrkPt) - 1; i >= 0; i-- {
 				WptType := TrkSegType.TrkPt[i]
 				if WptType.Lat != 0 && WptType.Lon != 0 {
@@ -449,48 +517,3 @@ func GetPositionEnd(g gpx.GPX) gpx.WptType {
 	}
 	return gpx.WptType{}
 }
-
-func DistanceQuality(g gpx.GPX) float64 {
-	var distance float64
-	var quality float64 = 100
-	var num int
-
-	for _, TrkType := range g.Trk {
-		for _, TrkSegType := range TrkType.TrkSeg {
-			for i := 0; i < len(TrkSegType.TrkPt)-1; i++ {
-				distance += Distance2D(*TrkSegType.TrkPt[i], *TrkSegType.TrkPt[i+1])
-			}
-			num += len(TrkSegType.TrkPt)
-		}
-	}
-
-	// check if points are very far away from each other
-	step := distance / float64(num)
-	if step > 30 {
-		quality -= 12
-	}
-	if step > 8 {
-		quality -= 6
-	}
-
-	// check intersections
-	result := RemoveIntersections(g, 5, false)
-	quality -= float64(len(result)) * 0.6
-
-	// check first noise
-	result = RemoveFirstNoise(g, false)
-	quality -= float64(len(result)) * 0.3
-
-	// check close points
-	result = RemoveStops(g, 0.0, .5, math.MaxFloat64, 0, false)
-	quality -= float64(len(result)) * 0.2
-
-	// check high noise
-	result = RemoveNoise(g, 6, 1.1, 4, false)
-	quality -= float64(len(result)) * 0.4
-
-	if quality < 0 {
-		quality = 0
-	}
-	return quality
-}
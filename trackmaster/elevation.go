@@ -2,6 +2,7 @@ package trackmaster
 
 import (
 	"math"
+	"sync"
 
 	"github.com/inode64/godem"
 	gpx "github.com/twpayne/go-gpx"
@@ -37,6 +38,9 @@ func LostElevation(g gpx.GPX, fix bool) []GPXElementInfo {
 	return result
 }
 
+// DefaultMaxSpeedVertical is the maximum vertical speed used by the smoothgaussianelevation command.
+const DefaultMaxSpeedVertical = 1.5
+
 // MaxSpeedVertical finds the maximum vertical speed between two points.
 func MaxSpeedVertical(g gpx.GPX, max float64, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
@@ -122,6 +126,32 @@ func MiddleElevation(w, pt gpx.WptType) float64 {
 	return pt.Ele + (w.Ele-pt.Ele)/2
 }
 
+// srtmTiles contains the SRTM tiles that are available. The tiles are downloaded the first time they are
+// used, so the first access to a tile is serialized by srtmMutex and then the tile is read without locking.
+var (
+	srtmMutex sync.Mutex
+	srtmTiles = make(map[string]bool)
+)
+
+func srtmElevation(srtm *godem.Srtm, lat, lon float64) (float64, error) {
+	dem, zip, file, _ := srtm.GetSrtm(lat, lon)
+	tile := dem + "/" + zip + "/" + file
+
+	srtmMutex.Lock()
+	if !srtmTiles[tile] {
+		defer srtmMutex.Unlock()
+		elevation, _, err := srtm.GetElevation(lat, lon)
+		if err == nil {
+			srtmTiles[tile] = true
+		}
+		return elevation, err
+	}
+	srtmMutex.Unlock()
+
+	elevation, _, err := srtm.GetElevation(lat, lon)
+	return elevation, err
+}
+
 func ElevationSRTM(g gpx.GPX) error {
 	srtm, err := godem.NewSrtm(godem.SOURCE_ESA)
 	if err != nil {
@@ -134,7 +164,7 @@ func ElevationSRTM(g gpx.GPX) error {
 	for _, TrkType := range g.Trk {
 		for _, TrkSegType := range TrkType.TrkSeg {
 			for wptTypeNo, WptType := range TrkSegType.TrkPt {
-				elevation, _, err := srtm.GetElevation(WptType.Lat, WptType.Lon)
+				elevation, err := srtmElevation(srtm, WptType.Lat, WptType.Lon)
 				if err != nil {
 					return err
 				}
@@ -156,21 +186,25 @@ func ElevationSRTM(g gpx.GPX) error {
 	return nil
 }
 
-func ElevationSRTMAccuracy(g gpx.GPX) (int, error) {
+// elevationIssues returns the points whose elevation deviates from the SRTM elevation, the points that
+// deviate a lot and the number of points. The allowed deviation is a percentage that is lower in the
+// mountains.
+func elevationIssues(g gpx.GPX) ([]GPXElementInfo, []GPXElementInfo, int, error) {
 	srtm, err := godem.NewSrtm(godem.SOURCE_ESA)
 	if err != nil {
-		return -1, err
+		return nil, nil, 0, err
 	}
 
-	var num, total int
+	var deviated, far []GPXElementInfo
+	var total int
 	var max1, max2 float64
 
-	for _, TrkType := range g.Trk {
-		for _, TrkSegType := range TrkType.TrkSeg {
-			for _, WptType := range TrkSegType.TrkPt {
-				elevation, _, err := srtm.GetElevation(WptType.Lat, WptType.Lon)
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			for WptTypeNo, WptType := range TrkSegType.TrkPt {
+				elevation, err := srtmElevation(srtm, WptType.Lat, WptType.Lon)
 				if err != nil {
-					return -1, err
+					return nil, nil, 0, err
 				}
 				max1 = 9
 				max2 = 45
@@ -194,17 +228,45 @@ func ElevationSRTMAccuracy(g gpx.GPX) (int, error) {
 					max1 = 2
 					max2 = 15
 				}
+				info := GPXElementInfo{WptType: *WptType, WptTypeNo: WptTypeNo, TrkSegTypeNo: TrkSegTypeNo, TrkTypeNo: TrkTypeNo}
 				e := math.Abs(elevation-WptType.Ele) * 100 / elevation
 				if e > max1 {
-					num++
+					deviated = append(deviated, info)
 				}
 				if e > max2 {
-					num += 4
+					far = append(far, info)
 				}
 				total++
 			}
 		}
 	}
+	return deviated, far, total, nil
+}
+
+// ElevationEmpty returns true if there is no elevation information in the GPX file, the points without
+// elevation have an elevation of 0.
+func ElevationEmpty(g gpx.GPX) bool {
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for _, WptType := range TrkSegType.TrkPt {
+				if WptType.Ele != 0 {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// DefaultElevationAccuracy is the minimum accuracy to update the elevation used by the elevation command.
+const DefaultElevationAccuracy = 60
+
+func ElevationSRTMAccuracy(g gpx.GPX) (int, error) {
+	deviated, far, total, err := elevationIssues(g)
+	if err != nil {
+		return -1, err
+	}
+	num := len(deviated) + 4*len(far)
 	if num > total {
 		return 0, nil
 	}
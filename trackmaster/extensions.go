@@ -0,0 +1,444 @@
+package trackmaster
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// Sensor contains the values recorded by external sensors for a track point.
+// A zero value means that the sensor value is not available unless it is in Zero.
+type Sensor struct {
+	HeartRate   float64
+	Cadence     float64
+	Power       float64
+	Temperature float64
+	Speed       float64
+	Course      float64
+	Distance    float64
+	// Zero contains the values that are available with a value of 0, like a temperature of 0 °C
+	Zero SensorFields
+}
+
+// SensorFields is a set of sensor values.
+type SensorFields uint8
+
+const (
+	SensorHeartRate SensorFields = 1 << iota
+	SensorCadence
+	SensorPower
+	SensorTemperature
+	SensorSpeed
+	SensorCourse
+	SensorDistance
+)
+
+// sensorFields contains the sensor values by the key of sensorNames.
+var sensorFields = map[string]SensorFields{
+	"hr":       SensorHeartRate,
+	"cad":      SensorCadence,
+	"power":    SensorPower,
+	"atemp":    SensorTemperature,
+	"speed":    SensorSpeed,
+	"course":   SensorCourse,
+	"distance": SensorDistance,
+}
+
+// value returns a pointer to a sensor value.
+func (s *Sensor) value(field SensorFields) *float64 {
+	switch field {
+	case SensorHeartRate:
+		return &s.HeartRate
+	case SensorCadence:
+		return &s.Cadence
+	case SensorPower:
+		return &s.Power
+	case SensorTemperature:
+		return &s.Temperature
+	case SensorSpeed:
+		return &s.Speed
+	case SensorCourse:
+		return &s.Course
+	}
+	return &s.Distance
+}
+
+// Available returns true when the sensor value is available, even when it is 0.
+func (s Sensor) Available(field SensorFields) bool {
+	return *s.value(field) != 0 || s.Zero&field != 0
+}
+
+// sensorNames contains the names of the elements used by Garmin TrackPointExtension v1/v2,
+// Garmin PowerExtension and OsmAnd for each sensor value, the first name has more priority.
+var sensorNames = map[string][]string{
+	"hr":       {"hr", "heart_rate"},
+	"cad":      {"cad", "cadence", "bike_cadence"},
+	"power":    {"PowerInWatts", "power", "bike_power"},
+	"atemp":    {"atemp", "temperature", "temp"},
+	"speed":    {"speed"},
+	"course":   {"course", "bearing", "heading"},
+	"distance": {"distance"},
+}
+
+// namespaces used by the extensions written by gotrackmaster.
+var extensionNamespaces = map[string]string{
+	"gpxtpx": "http://www.garmin.com/xmlschemas/TrackPointExtension/v2",
+	"gpxpx":  "http://www.garmin.com/xmlschemas/PowerExtension/v1",
+	"gpxx":   "http://www.garmin.com/xmlschemas/GpxExtensions/v3",
+	"osmand": "https://osmand.net",
+	"gtm":    "https://github.com/inode64/gotrackmaster",
+}
+
+// IsEmpty returns true when there are no sensor values.
+func (s Sensor) IsEmpty() bool {
+	return s == Sensor{}
+}
+
+// GetSensor returns the sensor values stored in the extensions of a point.
+func GetSensor(w gpx.WptType) Sensor {
+	var s Sensor
+	if w.Extensions == nil {
+		return s
+	}
+	values := make(map[string]float64)
+	d := xml.NewDecoder(bytes.NewReader(w.Extensions.XML))
+	var name string
+	for {
+		token, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+		case xml.EndElement:
+			name = ""
+		case xml.CharData:
+			value, err := strconv.ParseFloat(strings.TrimSpace(string(t)), 64)
+			if err == nil && name != "" {
+				values[name] = value
+			}
+		}
+	}
+	if len(values) == 0 {
+		return s
+	}
+
+	for sensor, field := range sensorFields {
+		for _, name := range sensorNames[sensor] {
+			if value, ok := values[name]; ok {
+				*s.value(field) = value
+				if value == 0 {
+					s.Zero |= field
+				}
+				break
+			}
+		}
+	}
+	return s
+}
+
+// SetSensor replaces the sensor values in the extensions of a point. Each value is written in the element
+// from which GetSensor reads it, the values without an element are added as Garmin TrackPointExtension v2
+// and the other extensions are kept.
+func SetSensor(w *gpx.WptType, s Sensor) {
+	var raw []byte
+	if w.Extensions != nil {
+		raw = w.Extensions.XML
+	}
+	elements, container := sensorElements(raw)
+
+	type edit struct {
+		start, end int64
+		text       string
+	}
+	var edits []edit
+	var added, tpx bytes.Buffer
+	removed := 0
+	for _, sensor := range []string{"atemp", "hr", "cad", "speed", "course", "power", "distance"} {
+		field := sensorFields[sensor]
+		e, found := elements[field]
+		switch {
+		case found && s.Available(field):
+			edits = append(edits, edit{start: e.value, end: e.close, text: formatSensor(s, field)})
+		case found:
+			edits = append(edits, edit{start: e.start, end: e.end})
+			if container != nil && e.start > container.start && e.end < container.end {
+				removed++
+			}
+		case sensor == "power":
+			writeExtensionValue(&added, "gpxpx:PowerInWatts", s, field)
+		case sensor == "distance":
+			// the distance recorded by the device, there is no Garmin extension for it
+			writeExtensionValue(&added, "gtm:distance", s, field)
+		case container != nil:
+			writeExtensionValue(&tpx, container.prefix+sensor, s, field)
+		default:
+			writeExtensionValue(&tpx, "gpxtpx:"+sensor, s, field)
+		}
+	}
+	if container != nil {
+		if tpx.Len() == 0 && removed == container.children {
+			// the values of the TrackPointExtension are removed
+			edits = append(edits, edit{start: container.start, end: container.end})
+		} else {
+			edits = append(edits, edit{start: container.close, end: container.close, text: tpx.String()})
+		}
+	} else if tpx.Len() > 0 {
+		added.WriteString("<gpxtpx:TrackPointExtension>" + tpx.String() + "</gpxtpx:TrackPointExtension>")
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+	var b bytes.Buffer
+	var last int64
+	for _, e := range edits {
+		if e.start < last {
+			// inside an element already removed
+			continue
+		}
+		b.Write(raw[last:e.start])
+		b.WriteString(e.text)
+		last = e.end
+	}
+	b.Write(raw[last:])
+	b.Write(added.Bytes())
+
+	if len(bytes.TrimSpace(b.Bytes())) == 0 {
+		w.Extensions = nil
+		return
+	}
+	w.Extensions = &gpx.ExtensionsType{XML: b.Bytes()}
+}
+
+// extensionElement is the position of an element in raw extension XML, from start to end, with its
+// content from value to close.
+type extensionElement struct {
+	start, end   int64
+	value, close int64
+	// prefix of the name of the element, like "gpxtpx:"
+	prefix   string
+	children int
+}
+
+// sensorElements returns the elements from which GetSensor reads each sensor value and the Garmin
+// TrackPointExtension element, nothing is returned when raw is not valid XML.
+func sensorElements(raw []byte) (map[SensorFields]extensionElement, *extensionElement) {
+	found := make(map[string]extensionElement)
+	var container *extensionElement
+	var stack []extensionElement
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			if err != io.EOF {
+				return nil, nil
+			}
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) > 0 {
+				stack[len(stack)-1].children++
+			}
+			e := extensionElement{start: offset, value: d.InputOffset()}
+			name := raw[offset+1:]
+			if i := bytes.IndexAny(name, " \t\r\n/>"); i >= 0 {
+				name = name[:i]
+			}
+			if i := bytes.IndexByte(name, ':'); i >= 0 {
+				e.prefix = string(name[:i+1])
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			e.close, e.end = offset, d.InputOffset()
+			if t.Name.Local == "TrackPointExtension" && container == nil {
+				container = &e
+			}
+			// the elements with other elements or without a value
+			if e.children > 0 || e.close == e.value {
+				continue
+			}
+			if _, err := strconv.ParseFloat(strings.TrimSpace(string(raw[e.value:e.close])), 64); err == nil {
+				found[t.Name.Local] = e
+			}
+		}
+	}
+
+	elements := make(map[SensorFields]extensionElement)
+	for sensor, field := range sensorFields {
+		for _, name := range sensorNames[sensor] {
+			if e, ok := found[name]; ok {
+				elements[field] = e
+				break
+			}
+		}
+	}
+	return elements, container
+}
+
+// MergeSensor returns the average of the available values of the sensors, the heart rate, the cadence
+// and the power are rounded, the course is averaged as an angle and the distance is the last one.
+func MergeSensor(sensors ...Sensor) Sensor {
+	var result, num Sensor
+	var sin, cos float64
+	add := func(s Sensor, field SensorFields) {
+		if s.Available(field) {
+			*result.value(field) += *s.value(field)
+			*num.value(field)++
+		}
+	}
+	for _, s := range sensors {
+		add(s, SensorHeartRate)
+		add(s, SensorCadence)
+		add(s, SensorPower)
+		add(s, SensorTemperature)
+		add(s, SensorSpeed)
+		if s.Course != 0 {
+			sin += math.Sin(toRadians(s.Course))
+			cos += math.Cos(toRadians(s.Course))
+		}
+		result.Distance = math.Max(result.Distance, s.Distance)
+	}
+	average := func(sum, n float64) float64 {
+		if n == 0 {
+			return 0
+		}
+		return sum / n
+	}
+	result.HeartRate = math.Round(average(result.HeartRate, num.HeartRate))
+	result.Cadence = math.Round(average(result.Cadence, num.Cadence))
+	result.Power = math.Round(average(result.Power, num.Power))
+	result.Temperature = average(result.Temperature, num.Temperature)
+	result.Speed = average(result.Speed, num.Speed)
+	if sin != 0 || cos != 0 {
+		result.Course = math.Mod(toDegrees(math.Atan2(sin, cos))+360, 360)
+	}
+	if result.Temperature == 0 && num.Temperature > 0 {
+		result.Zero |= SensorTemperature
+	}
+	return result
+}
+
+// InterpolateSensor returns the sensor values at the fraction f between a and b, when a value is only
+// available in one of them that value is used. The heart rate, the cadence and the power are rounded.
+func InterpolateSensor(a, b Sensor, f float64) Sensor {
+	linear := func(x, y float64) float64 {
+		if x == 0 {
+			return y
+		}
+		if y == 0 {
+			return x
+		}
+		return x + (y-x)*f
+	}
+	result := Sensor{
+		HeartRate: math.Round(linear(a.HeartRate, b.HeartRate)),
+		Cadence:   math.Round(linear(a.Cadence, b.Cadence)),
+		Power:     math.Round(linear(a.Power, b.Power)),
+		Speed:     linear(a.Speed, b.Speed),
+		Distance:  linear(a.Distance, b.Distance),
+		Course:    linear(a.Course, b.Course),
+	}
+	// the temperature can be 0
+	switch ta, tb := a.Available(SensorTemperature), b.Available(SensorTemperature); {
+	case ta && tb:
+		result.Temperature = a.Temperature + (b.Temperature-a.Temperature)*f
+	case ta:
+		result.Temperature = a.Temperature
+	case tb:
+		result.Temperature = b.Temperature
+	}
+	if result.Temperature == 0 && (a.Available(SensorTemperature) || b.Available(SensorTemperature)) {
+		result.Zero |= SensorTemperature
+	}
+	if a.Course != 0 && b.Course != 0 {
+		// interpolate the course using the shortest turn
+		diff := math.Mod(b.Course-a.Course+540, 360) - 180
+		result.Course = math.Mod(a.Course+diff*f+360, 360)
+	}
+	return result
+}
+
+// mergeSensorPoints merges the sensor values of the removed points into the point that is kept.
+func mergeSensorPoints(keep *gpx.WptType, removed []*gpx.WptType) {
+	if len(removed) == 0 {
+		return
+	}
+	sensors := []Sensor{GetSensor(*keep)}
+	for _, w := range removed {
+		sensors = append(sensors, GetSensor(*w))
+	}
+	merged := MergeSensor(sensors...)
+	if merged != sensors[0] {
+		SetSensor(keep, merged)
+	}
+}
+
+func writeExtensionValue(b *bytes.Buffer, name string, s Sensor, field SensorFields) {
+	if !s.Available(field) {
+		return
+	}
+	fmt.Fprintf(b, "<%s>%s</%s>", name, formatSensor(s, field), name)
+}
+
+// sensorIntegers are the sensor values that are integers in the extensions, the schemas define the heart
+// rate and the cadence as unsignedByte.
+const sensorIntegers = SensorHeartRate | SensorCadence | SensorPower
+
+// formatSensor returns the text of a sensor value, the integer values are rounded.
+func formatSensor(s Sensor, field SensorFields) string {
+	value := *s.value(field)
+	if field&sensorIntegers != 0 {
+		value = math.Round(value)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// ExtensionNamespaces declares the namespaces of the extension prefixes used in the GPX,
+// the GPX reader does not keep them, so they must be added again before writing.
+func ExtensionNamespaces(g *gpx.GPX) {
+	used := make(map[string]bool)
+	check := func(ext *gpx.ExtensionsType) {
+		if ext == nil {
+			return
+		}
+		for prefix := range extensionNamespaces {
+			if bytes.Contains(ext.XML, []byte("<"+prefix+":")) {
+				used[prefix] = true
+			}
+		}
+	}
+
+	check(g.Extensions)
+	for _, WptType := range g.Wpt {
+		check(WptType.Extensions)
+	}
+	for _, TrkType := range g.Trk {
+		check(TrkType.Extensions)
+		for _, TrkSegType := range TrkType.TrkSeg {
+			check(TrkSegType.Extensions)
+			for _, WptType := range TrkSegType.TrkPt {
+				check(WptType.Extensions)
+			}
+		}
+	}
+
+	for prefix := range used {
+		if g.XMLAttrs == nil {
+			g.XMLAttrs = make(map[string]string)
+		}
+		g.XMLAttrs["xmlns:"+prefix] = extensionNamespaces[prefix]
+	}
+}
@@ -0,0 +1,111 @@
+package trackmaster_test
+
+import (
+	"testing"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestGetSensor tests the sensor values of the Garmin and OsmAnd extensions.
+func TestGetSensor(t *testing.T) {
+	tests := map[string]struct {
+		xml    string
+		sensor trackmaster.Sensor
+	}{
+		"garmin v1": {
+			xml:    `<gpxtpx:TrackPointExtension><gpxtpx:atemp>12.5</gpxtpx:atemp><gpxtpx:hr>141</gpxtpx:hr><gpxtpx:cad>88</gpxtpx:cad></gpxtpx:TrackPointExtension>`,
+			sensor: trackmaster.Sensor{HeartRate: 141, Cadence: 88, Temperature: 12.5},
+		},
+		"garmin v2 with power": {
+			xml:    `<gpxtpx:TrackPointExtension><gpxtpx:hr>120</gpxtpx:hr><gpxtpx:speed>4.2</gpxtpx:speed><gpxtpx:course>270</gpxtpx:course></gpxtpx:TrackPointExtension><gpxpx:PowerInWatts>250</gpxpx:PowerInWatts>`,
+			sensor: trackmaster.Sensor{HeartRate: 120, Power: 250, Speed: 4.2, Course: 270},
+		},
+		"osmand": {
+			xml:    `<osmand:bearing>264.7</osmand:bearing><osmand:speed>14.9</osmand:speed><osmand:heading>146</osmand:heading>`,
+			sensor: trackmaster.Sensor{Speed: 14.9, Course: 264.7},
+		},
+		"osmand old": {
+			xml:    `<speed>0.48</speed><heading>164</heading>`,
+			sensor: trackmaster.Sensor{Speed: 0.48, Course: 164},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := gpx.WptType{Extensions: &gpx.ExtensionsType{XML: []byte(test.xml)}}
+			assert.Equal(t, test.sensor, trackmaster.GetSensor(w))
+		})
+	}
+}
+
+// TestSetSensor tests that the sensor values are replaced in their elements and the other extensions are kept.
+func TestSetSensor(t *testing.T) {
+	w := gpx.WptType{Extensions: &gpx.ExtensionsType{XML: []byte(`<gpxx:Depth>3</gpxx:Depth><osmand:speed>14.9</osmand:speed>`)}}
+	trackmaster.SetSensor(&w, trackmaster.Sensor{HeartRate: 100, Speed: 3})
+	assert.Equal(t, trackmaster.Sensor{HeartRate: 100, Speed: 3}, trackmaster.GetSensor(w))
+	assert.Equal(t, `<gpxx:Depth>3</gpxx:Depth><osmand:speed>3</osmand:speed><gpxtpx:TrackPointExtension><gpxtpx:hr>100</gpxtpx:hr></gpxtpx:TrackPointExtension>`, string(w.Extensions.XML))
+
+	trackmaster.SetSensor(&w, trackmaster.Sensor{})
+	assert.Equal(t, "<gpxx:Depth>3</gpxx:Depth>", string(w.Extensions.XML))
+
+	// the OsmAnd values and the other values of the TrackPointExtension are kept in their elements
+	w = gpx.WptType{Extensions: &gpx.ExtensionsType{XML: []byte(`<osmand:heading>90</osmand:heading><osmand:bearing>80</osmand:bearing>` +
+		`<ns3:TrackPointExtension><ns3:depth>2</ns3:depth><ns3:hr>120</ns3:hr></ns3:TrackPointExtension>`)}}
+	s := trackmaster.GetSensor(w)
+	assert.Equal(t, trackmaster.Sensor{HeartRate: 120, Course: 80}, s)
+	s.Course, s.Cadence = 85, 90
+	trackmaster.SetSensor(&w, s)
+	assert.Equal(t, `<osmand:heading>90</osmand:heading><osmand:bearing>85</osmand:bearing>`+
+		`<ns3:TrackPointExtension><ns3:depth>2</ns3:depth><ns3:hr>120</ns3:hr><ns3:cad>90</ns3:cad></ns3:TrackPointExtension>`, string(w.Extensions.XML))
+}
+
+// TestMergeSensor tests the merge and the interpolation of sensor values.
+func TestMergeSensor(t *testing.T) {
+	s := trackmaster.MergeSensor(
+		trackmaster.Sensor{HeartRate: 100, Course: 350, Distance: 10},
+		trackmaster.Sensor{HeartRate: 110, Course: 10, Distance: 12},
+		trackmaster.Sensor{Power: 200},
+	)
+	assert.Equal(t, 105.0, s.HeartRate)
+	assert.Equal(t, 200.0, s.Power)
+	assert.Equal(t, 12.0, s.Distance)
+	assert.InDelta(t, 0, s.Course, 1e-9)
+
+	s = trackmaster.InterpolateSensor(trackmaster.Sensor{HeartRate: 100, Course: 350}, trackmaster.Sensor{HeartRate: 120, Course: 30, Cadence: 90}, 0.25)
+	assert.Equal(t, 105.0, s.HeartRate)
+	assert.Equal(t, 90.0, s.Cadence)
+	assert.InDelta(t, 0, s.Course, 1e-9)
+}
+
+// TestSensorIntegers tests that the heart rate, the cadence and the power are written as integers.
+func TestSensorIntegers(t *testing.T) {
+	s := trackmaster.MergeSensor(trackmaster.Sensor{HeartRate: 101, Cadence: 80, Speed: 3}, trackmaster.Sensor{HeartRate: 102, Cadence: 81, Speed: 4})
+	assert.Equal(t, trackmaster.Sensor{HeartRate: 102, Cadence: 81, Speed: 3.5}, s)
+
+	var w gpx.WptType
+	trackmaster.SetSensor(&w, trackmaster.InterpolateSensor(trackmaster.Sensor{HeartRate: 100, Power: 200}, trackmaster.Sensor{HeartRate: 103, Power: 201}, 0.25))
+	assert.Equal(t, `<gpxpx:PowerInWatts>200</gpxpx:PowerInWatts><gpxtpx:TrackPointExtension><gpxtpx:hr>101</gpxtpx:hr></gpxtpx:TrackPointExtension>`, string(w.Extensions.XML))
+
+	// the values read from other applications are rounded too
+	w = gpx.WptType{Extensions: &gpx.ExtensionsType{XML: []byte(`<osmand:hr>0</osmand:hr>`)}}
+	trackmaster.SetSensor(&w, trackmaster.Sensor{HeartRate: 120.6, Speed: 2.25})
+	assert.Equal(t, `<osmand:hr>121</osmand:hr><gpxtpx:TrackPointExtension><gpxtpx:speed>2.25</gpxtpx:speed></gpxtpx:TrackPointExtension>`, string(w.Extensions.XML))
+}
+
+// TestRemoveStopsSensor tests that the sensor values of a stop are merged into the point that is kept.
+func TestRemoveStopsSensor(t *testing.T) {
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < 6; i++ {
+		w := &gpx.WptType{Lat: 40, Lon: 0.1}
+		if i == 5 {
+			w.Lat = 40.01
+		}
+		trackmaster.SetSensor(w, trackmaster.Sensor{HeartRate: float64(100 + i*2)})
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+	trackmaster.RemoveStops(g, -1, 1, 1, 0, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 2)
+	assert.Equal(t, 104.0, trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[0]).HeartRate)
+}
@@ -0,0 +1,52 @@
+package trackmaster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+const (
+	// fingerprintPosition rounds the coordinates to 6 decimals, about 0.1 m
+	fingerprintPosition = 1e6
+	// fingerprintElevation rounds the elevation to decimeters
+	fingerprintElevation = 10
+)
+
+// Fingerprint returns the SHA-256 of the normalized points of a track, so the same track saved by different
+// applications has the same fingerprint. The coordinates and the elevation are rounded, the time is
+// truncated to seconds and the creator, the metadata, the names, the extensions and the segments are
+// ignored. It is empty when the track has no points.
+func Fingerprint(g gpx.GPX) string {
+	h := sha256.New()
+	var line []byte
+	points := 0
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for _, WptType := range TrkSegType.TrkPt {
+				line = strconv.AppendInt(line[:0], int64(math.Round(WptType.Lat*fingerprintPosition)), 10)
+				line = append(line, ' ')
+				line = strconv.AppendInt(line, int64(math.Round(WptType.Lon*fingerprintPosition)), 10)
+				line = append(line, ' ')
+				line = strconv.AppendInt(line, int64(math.Round(WptType.Ele*fingerprintElevation)), 10)
+				line = append(line, ' ')
+				// the points without time are different from the points at the Unix epoch
+				if WptType.Time.IsZero() {
+					line = append(line, '-')
+				} else {
+					line = strconv.AppendInt(line, WptType.Time.Unix(), 10)
+				}
+				line = append(line, '\n')
+				h.Write(line)
+				points++
+			}
+		}
+	}
+	if points == 0 {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
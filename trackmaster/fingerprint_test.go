@@ -0,0 +1,36 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+func TestFingerprint(t *testing.T) {
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	a := timedGPX(42, 2, t0, 100)
+	fingerprint := trackmaster.Fingerprint(a)
+	assert.Len(t, fingerprint, 64)
+
+	// the same points with other precision, other metadata and split in two segments
+	b := timedGPX(42, 2, t0, 100)
+	b.Creator = "other"
+	b.Metadata = &gpx.MetadataType{Name: "other"}
+	for _, WptType := range b.Trk[0].TrkSeg[0].TrkPt {
+		WptType.Lat += 0.00000001
+		WptType.Time = WptType.Time.Add(300 * time.Millisecond)
+	}
+	points := b.Trk[0].TrkSeg[0].TrkPt
+	b.Trk[0].TrkSeg = []*gpx.TrkSegType{{TrkPt: points[:50]}, {TrkPt: points[50:]}}
+	assert.Equal(t, fingerprint, trackmaster.Fingerprint(b))
+
+	// other points
+	b.Trk[0].TrkSeg[1].TrkPt[0].Ele = 10
+	assert.NotEqual(t, fingerprint, trackmaster.Fingerprint(b))
+	assert.NotEqual(t, fingerprint, trackmaster.Fingerprint(timedGPX(42, 2, t0.Add(time.Second), 100)))
+
+	assert.Empty(t, trackmaster.Fingerprint(gpx.GPX{}))
+}
@@ -0,0 +1,165 @@
+package trackmaster
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/inode64/godem"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// syntheticExtension marks the points that are not measured by the GPS.
+const syntheticExtension = "<gtm:synthetic>true</gtm:synthetic>"
+
+// ElevationFunc returns the elevation of a coordinate.
+type ElevationFunc func(lat, lon float64) (float64, error)
+
+// ElevationDEM returns an ElevationFunc that uses the SRTM data.
+func ElevationDEM() (ElevationFunc, error) {
+	srtm, err := godem.NewSrtm(godem.SOURCE_ESA)
+	if err != nil {
+		return nil, err
+	}
+	return func(lat, lon float64) (float64, error) {
+		return srtmElevation(srtm, lat, lon)
+	}, nil
+}
+
+// IsSynthetic returns true when the point was added by gotrackmaster and is not measured.
+func IsSynthetic(w gpx.WptType) bool {
+	return w.Extensions != nil && bytes.Contains(w.Extensions.XML, []byte("<gtm:synthetic>"))
+}
+
+func setSynthetic(w *gpx.WptType) {
+	if w.Extensions == nil {
+		w.Extensions = &gpx.ExtensionsType{}
+	}
+	w.Extensions.XML = append(w.Extensions.XML, syntheticExtension...)
+}
+
+// isGap returns true when the time or the distance between two points is bigger than the maximums,
+// a maximum of 0 is not checked.
+func isGap(a, b gpx.WptType, maxSeconds, maxDistance float64) bool {
+	if maxSeconds > 0 && timeValid(a.Time) && timeValid(b.Time) && b.Time.Sub(a.Time).Seconds() > maxSeconds {
+		return true
+	}
+	return maxDistance > 0 && HaversineDistanceTrkPt(a, b) > maxDistance
+}
+
+// samplingRate returns the median time and distance between the points of a segment.
+func samplingRate(ts gpx.TrkSegType) (float64, float64) {
+	var seconds, distances []float64
+	for i := 1; i < len(ts.TrkPt); i++ {
+		if timeValid(ts.TrkPt[i-1].Time) && timeValid(ts.TrkPt[i].Time) {
+			seconds = append(seconds, ts.TrkPt[i].Time.Sub(ts.TrkPt[i-1].Time).Seconds())
+		}
+		distances = append(distances, HaversineDistanceTrkPt(*ts.TrkPt[i-1], *ts.TrkPt[i]))
+	}
+	median := func(values []float64) float64 {
+		if len(values) == 0 {
+			return 0
+		}
+		sort.Float64s(values)
+		return values[len(values)/2]
+	}
+	return median(seconds), median(distances)
+}
+
+// FillGapsConfig defines the gaps that are filled, distances are in meters and times in seconds.
+type FillGapsConfig struct {
+	MaxSeconds  float64
+	MaxDistance float64
+	MaxPoints   int
+	// DEM takes the elevation of the added points from the SRTM instead of interpolating it
+	DEM bool
+}
+
+// DefaultFillGapsConfig returns the configuration used by the fillgaps command.
+func DefaultFillGapsConfig() FillGapsConfig {
+	return FillGapsConfig{
+		MaxSeconds:  30,
+		MaxDistance: 200,
+		MaxPoints:   1000,
+		DEM:         true,
+	}
+}
+
+// FillGaps finds the gaps bigger than maxSeconds or maxDistance inside the segments and fills them with
+// points at the sampling rate of the segment along the great circle, the elevation is taken from the
+// elevation function or interpolated when it is nil. The added points are tagged as synthetic.
+// The gaps that need more than maxPoints points are not filled and they are returned apart, 0 for no limit.
+func FillGaps(g gpx.GPX, maxSeconds, maxDistance float64, maxPoints int, elevation ElevationFunc, fix bool) ([]GPXElementInfo, []GPXElementInfo, error) {
+	var result, skipped []GPXElementInfo
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) < 2 {
+				continue
+			}
+			rateSeconds, rateDistance := samplingRate(*TrkSegType)
+
+			var dst []*gpx.WptType
+			for wptTypeNo, WptType := range TrkSegType.TrkPt {
+				if wptTypeNo == 0 || !isGap(*TrkSegType.TrkPt[wptTypeNo-1], *WptType, maxSeconds, maxDistance) {
+					dst = append(dst, WptType)
+					continue
+				}
+
+				last := *TrkSegType.TrkPt[wptTypeNo-1]
+				length := HaversineDistanceTrkPt(last, *WptType)
+				duration := 0.0
+				if timeValid(last.Time) && timeValid(WptType.Time) {
+					duration = WptType.Time.Sub(last.Time).Seconds()
+				}
+
+				// number of points to add to keep the sampling rate
+				var count int
+				if duration > 0 && rateSeconds > 0 {
+					count = int(math.Round(duration/rateSeconds)) - 1
+				} else if rateDistance > 0 {
+					count = int(math.Round(length/rateDistance)) - 1
+				}
+
+				gap := GPXElementInfo{
+					WptType:      *WptType,
+					WptTypeNo:    wptTypeNo,
+					TrkSegTypeNo: TrkSegTypeNo,
+					TrkTypeNo:    TrkTypeNo,
+					Count:        int(math.Max(float64(count), 0)),
+					Length:       length,
+					Duration:     duration,
+				}
+				// a long loss of the signal can not be rebuilt with a straight line
+				if maxPoints > 0 && count > maxPoints {
+					skipped = append(skipped, gap)
+					dst = append(dst, WptType)
+					continue
+				}
+				result = append(result, gap)
+
+				for i := 1; i <= count && fix; i++ {
+					f := float64(i) / float64(count+1)
+					w := greatCircle(last, *WptType, f)
+					if duration > 0 {
+						w.Time = last.Time.Add(time.Duration(duration * f * float64(time.Second)))
+					}
+					if elevation != nil {
+						ele, err := elevation(w.Lat, w.Lon)
+						if err != nil {
+							return result, skipped, err
+						}
+						w.Ele = ele
+					}
+					setSynthetic(&w)
+					dst = append(dst, &w)
+				}
+				dst = append(dst, WptType)
+			}
+			if fix {
+				TrkSegType.TrkPt = dst
+			}
+		}
+	}
+	return result, skipped, nil
+}
@@ -0,0 +1,54 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestFillGaps tests that a gap is filled at the sampling rate of the segment with synthetic points.
+func TestFillGaps(t *testing.T) {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for _, seconds := range []int{0, 2, 4, 6, 16, 18} {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{
+			Lat:  40 + float64(seconds)*0.0001,
+			Lon:  0.1,
+			Ele:  100,
+			Time: start.Add(time.Duration(seconds) * time.Second),
+		})
+	}
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	dem := func(lat, lon float64) (float64, error) {
+		return 500, nil
+	}
+	result, skipped, err := trackmaster.FillGaps(g, 5, 0, 0, dem, true)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Len(t, result, 1)
+	assert.Equal(t, 4, result[0].Count)
+	assert.Equal(t, 10.0, result[0].Duration)
+
+	points := g.Trk[0].TrkSeg[0].TrkPt
+	assert.Len(t, points, 10)
+	assert.False(t, trackmaster.IsSynthetic(*points[3]))
+	for _, w := range points[4:8] {
+		assert.True(t, trackmaster.IsSynthetic(*w))
+		assert.Equal(t, 500.0, w.Ele)
+	}
+	assert.Equal(t, start.Add(8*time.Second), points[4].Time)
+	assert.InDelta(t, 40.0008, points[4].Lat, 1e-7)
+
+	// the gaps that need more points than the maximum are not filled
+	seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: 40.01, Lon: 0.1, Ele: 100, Time: start.Add(time.Hour)})
+	result, skipped, err = trackmaster.FillGaps(g, 5, 0, 100, dem, true)
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, 10, skipped[0].WptTypeNo)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 11)
+}
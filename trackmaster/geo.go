@@ -79,3 +79,19 @@ func gaussianFilter(elevations gpx.TrkSegType, start, end, windowSize int, sigma
 func Gaussian(x, sigma float64) float64 {
 	return (1.0 / (math.Sqrt(2*math.Pi) * sigma)) * math.Exp(-math.Pow(x, 2.0)/(2*math.Pow(sigma, 2.0)))
 }
+
+// greatCircle returns the point at the fraction f of the great circle between two coordinates,
+// the elevation is interpolated linearly.
+func greatCircle(coord1, coord2 gpx.WptType, f float64) gpx.WptType {
+	x1, y1, z1 := geoToCartesian(gpx.WptType{Lat: coord1.Lat, Lon: coord1.Lon})
+	x2, y2, z2 := geoToCartesian(gpx.WptType{Lat: coord2.Lat, Lon: coord2.Lon})
+	omega := math.Acos(math.Max(-1, math.Min(1, (x1*x2+y1*y2+z1*z2)/(earthRadius*earthRadius))))
+	a, b := 1-f, f
+	if math.Sin(omega) > 1e-12 {
+		a = math.Sin((1-f)*omega) / math.Sin(omega)
+		b = math.Sin(f*omega) / math.Sin(omega)
+	}
+	result := cartesianToGeo(a*x1+b*x2, a*y1+b*y2, a*z1+b*z2)
+	result.Ele = coord1.Ele + (coord2.Ele-coord1.Ele)*f
+	return result
+}
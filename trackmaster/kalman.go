@@ -0,0 +1,191 @@
+package trackmaster
+
+import (
+	"math"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// KalmanConfig defines the noise used by the Kalman filter, distances are in meters.
+type KalmanConfig struct {
+	// Accuracy is the horizontal error used when a point has no hdop
+	Accuracy float64
+	// ElevationAccuracy is the vertical error used when a point has no vdop
+	ElevationAccuracy float64
+	// DOPFactor converts hdop and vdop to meters, OsmAnd stores the accuracy in meters so the factor is 1
+	DOPFactor float64
+	// Acceleration is the expected horizontal acceleration in m/s²
+	Acceleration float64
+	// ElevationAcceleration is the expected vertical acceleration in m/s²
+	ElevationAcceleration float64
+}
+
+// DefaultKalmanConfig returns the configuration used by the smoothkalman command.
+func DefaultKalmanConfig() KalmanConfig {
+	return KalmanConfig{
+		Accuracy:              5,
+		ElevationAccuracy:     10,
+		DOPFactor:             1,
+		Acceleration:          1,
+		ElevationAcceleration: 0.2,
+	}
+}
+
+// mat2 is a 2x2 matrix [[a, b], [c, d]].
+type mat2 struct {
+	a, b, c, d float64
+}
+
+func (m mat2) mul(o mat2) mat2 {
+	return mat2{m.a*o.a + m.b*o.c, m.a*o.b + m.b*o.d, m.c*o.a + m.d*o.c, m.c*o.b + m.d*o.d}
+}
+
+func (m mat2) add(o mat2) mat2 {
+	return mat2{m.a + o.a, m.b + o.b, m.c + o.c, m.d + o.d}
+}
+
+func (m mat2) sub(o mat2) mat2 {
+	return mat2{m.a - o.a, m.b - o.b, m.c - o.c, m.d - o.d}
+}
+
+func (m mat2) transpose() mat2 {
+	return mat2{m.a, m.c, m.b, m.d}
+}
+
+func (m mat2) inverse() (mat2, bool) {
+	det := m.a*m.d - m.b*m.c
+	if det == 0 {
+		return mat2{}, false
+	}
+	return mat2{m.d / det, -m.b / det, -m.c / det, m.a / det}, true
+}
+
+// kalmanSmooth smooths the measurements with a constant velocity model and the Rauch–Tung–Striebel smoother,
+// the measurements with a zero accuracy are missing and only the model is used.
+func kalmanSmooth(values, accuracy, dts []float64, acceleration float64) []float64 {
+	n := len(values)
+	result := make([]float64, n)
+
+	first := -1
+	for i := range values {
+		if accuracy[i] > 0 {
+			first = i
+			break
+		}
+	}
+	if first == -1 {
+		copy(result, values)
+		return result
+	}
+
+	// position and velocity after the prediction and after the update
+	predicted := make([][2]float64, n)
+	predictedP := make([]mat2, n)
+	filtered := make([][2]float64, n)
+	filteredP := make([]mat2, n)
+	transitions := make([]mat2, n)
+
+	x := [2]float64{values[first], 0}
+	P := mat2{accuracy[first] * accuracy[first], 0, 0, 100}
+	q := acceleration * acceleration
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			dt := dts[i]
+			F := mat2{1, dt, 0, 1}
+			Q := mat2{q * dt * dt * dt * dt / 4, q * dt * dt * dt / 2, q * dt * dt * dt / 2, q * dt * dt}
+			x = [2]float64{x[0] + dt*x[1], x[1]}
+			P = F.mul(P).mul(F.transpose()).add(Q)
+			transitions[i] = F
+		}
+		predicted[i], predictedP[i] = x, P
+
+		if accuracy[i] > 0 {
+			S := P.a + accuracy[i]*accuracy[i]
+			k0, k1 := P.a/S, P.c/S
+			y := values[i] - x[0]
+			x = [2]float64{x[0] + k0*y, x[1] + k1*y}
+			P = mat2{(1 - k0) * P.a, (1 - k0) * P.b, P.c - k1*P.a, P.d - k1*P.b}
+		}
+		filtered[i], filteredP[i] = x, P
+	}
+
+	smoothed := filtered[n-1]
+	smoothedP := filteredP[n-1]
+	result[n-1] = smoothed[0]
+	for i := n - 2; i >= 0; i-- {
+		inverse, ok := predictedP[i+1].inverse()
+		if !ok {
+			smoothed, smoothedP = filtered[i], filteredP[i]
+			result[i] = smoothed[0]
+			continue
+		}
+		C := filteredP[i].mul(transitions[i+1].transpose()).mul(inverse)
+		d0, d1 := smoothed[0]-predicted[i+1][0], smoothed[1]-predicted[i+1][1]
+		smoothed = [2]float64{filtered[i][0] + C.a*d0 + C.b*d1, filtered[i][1] + C.c*d0 + C.d*d1}
+		smoothedP = filteredP[i].add(C.mul(smoothedP.sub(predictedP[i+1])).mul(C.transpose()))
+		result[i] = smoothed[0]
+	}
+
+	return result
+}
+
+// SmoothKalman smooths the positions and elevations of a GPX with a Kalman filter and a backward smoother,
+// the time between points is used in the model and hdop and vdop as the error of each point.
+func SmoothKalman(g gpx.GPX, config KalmanConfig) {
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			kalmanSegment(*TrkSegType, config)
+		}
+	}
+}
+
+func kalmanSegment(ts gpx.TrkSegType, config KalmanConfig) {
+	n := len(ts.TrkPt)
+	if n < 3 {
+		return
+	}
+
+	origin := ts.TrkPt[0]
+	coefficient := math.Cos(toRadians(origin.Lat)) * oneDegree
+	xs, ys, zs := make([]float64, n), make([]float64, n), make([]float64, n)
+	horizontal, vertical := make([]float64, n), make([]float64, n)
+	dts := make([]float64, n)
+	for i, WptType := range ts.TrkPt {
+		xs[i] = (WptType.Lon - origin.Lon) * coefficient
+		ys[i] = (WptType.Lat - origin.Lat) * oneDegree
+		zs[i] = WptType.Ele
+
+		horizontal[i] = config.Accuracy
+		if WptType.HDOP > 0 {
+			horizontal[i] = WptType.HDOP * config.DOPFactor
+		}
+		// points without elevation are not used as measurements
+		if WptType.Ele != 0 {
+			vertical[i] = config.ElevationAccuracy
+			if WptType.VDOP > 0 {
+				vertical[i] = WptType.VDOP * config.DOPFactor
+			}
+		}
+
+		if i > 0 {
+			// one second between points when the time is unknown
+			dts[i] = 1
+			if timeValid(WptType.Time) && timeValid(ts.TrkPt[i-1].Time) {
+				dts[i] = math.Max(WptType.Time.Sub(ts.TrkPt[i-1].Time).Seconds(), 0)
+			}
+		}
+	}
+
+	xs = kalmanSmooth(xs, horizontal, dts, config.Acceleration)
+	ys = kalmanSmooth(ys, horizontal, dts, config.Acceleration)
+	zs = kalmanSmooth(zs, vertical, dts, config.ElevationAcceleration)
+
+	lat, lon := origin.Lat, origin.Lon
+	for i, WptType := range ts.TrkPt {
+		WptType.Lat = lat + ys[i]/oneDegree
+		WptType.Lon = lon + xs[i]/coefficient
+		if WptType.Ele != 0 {
+			WptType.Ele = zs[i]
+		}
+	}
+}
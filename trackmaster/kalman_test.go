@@ -0,0 +1,45 @@
+package trackmaster_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestSmoothKalman tests that the noise of a track at constant speed is reduced and the bad points weigh less.
+func TestSmoothKalman(t *testing.T) {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	noise := []float64{3, -4, 2, -1, 4, -3, 1, -2, 3, -4, 2, -3, 4, -1, 2, -2, 3, -3, 1, -4}
+	seg := &gpx.TrkSegType{}
+	for i, n := range noise {
+		w := &gpx.WptType{
+			Lat:  40 + float64(i)*0.0001,
+			Lon:  0.1 + n/85000,
+			Ele:  100 + n,
+			Time: start.Add(time.Duration(i) * 5 * time.Second),
+			HDOP: 4,
+		}
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	// a point with a bad accuracy
+	seg.TrkPt[10].Lon += 50.0 / 85000
+	seg.TrkPt[10].HDOP = 60
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	trackmaster.SmoothKalman(g, trackmaster.DefaultKalmanConfig())
+	var horizontal, vertical, raw float64
+	for i, w := range g.Trk[0].TrkSeg[0].TrkPt {
+		horizontal += math.Abs(w.Lon-0.1) * 85000
+		vertical += math.Abs(w.Ele - 100)
+		raw += math.Abs(noise[i])
+		assert.InDelta(t, 40+float64(i)*0.0001, w.Lat, 1e-6, i)
+	}
+	// the error of the point with a bad accuracy is mostly removed
+	assert.Less(t, horizontal, raw)
+	assert.Less(t, vertical, raw/2)
+	assert.Less(t, math.Abs(g.Trk[0].TrkSeg[0].TrkPt[10].Lon-0.1)*85000, 10.0)
+}
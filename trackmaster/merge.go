@@ -0,0 +1,282 @@
+package trackmaster
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+const (
+	// MergeSpan is the default duration in seconds of the spans where the source of the positions is selected.
+	MergeSpan = 60
+	// MergeMinOverlap is the minimum fraction of the time of the shorter track that must overlap with the
+	// other track to merge them
+	MergeMinOverlap = 0.5
+)
+
+var ErrMergeTime = errors.New("the tracks don't have times to be aligned or they don't overlap in time")
+
+// MergeStats contains the source of each value of a merged track, 0 for the first track, 1 for the
+// second one and -1 when none of them has the value. PositionSpans is the number of spans whose
+// positions are taken from each track.
+type MergeStats struct {
+	PositionSpans [2]int `json:"positionSpans"`
+	Elevation     int    `json:"elevation"`
+	HeartRate     int    `json:"heartRate"`
+	Cadence       int    `json:"cadence"`
+	Power         int    `json:"power"`
+	Temperature   int    `json:"temperature"`
+}
+
+// timedPoints returns a copy of the points with time and position sorted by time.
+func timedPoints(g gpx.GPX) []*gpx.WptType {
+	var result []*gpx.WptType
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for _, WptType := range TrkSegType.TrkPt {
+				if timeValid(WptType.Time) && (WptType.Lat != 0 || WptType.Lon != 0) {
+					w := *WptType
+					result = append(result, &w)
+				}
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result
+}
+
+// elevationNoise returns the average of the absolute second differences of the elevation, the
+// barometric altimeters are smoother than the elevation of the GPS.
+func elevationNoise(points []*gpx.WptType) float64 {
+	if len(points) < 3 {
+		return math.MaxFloat64
+	}
+	var sum float64
+	for i := 1; i < len(points)-1; i++ {
+		sum += math.Abs(points[i+1].Ele - 2*points[i].Ele + points[i-1].Ele)
+	}
+	return sum / float64(len(points)-2)
+}
+
+func hasElevation(points []*gpx.WptType) bool {
+	for _, w := range points {
+		if w.Ele != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// elevationSource returns the source with elevation, the smoother one when both have it.
+func elevationSource(sources [2][]*gpx.WptType) int {
+	switch a, b := hasElevation(sources[0]), hasElevation(sources[1]); {
+	case a && b:
+		if elevationNoise(sources[1]) < elevationNoise(sources[0]) {
+			return 1
+		}
+		return 0
+	case a:
+		return 0
+	case b:
+		return 1
+	}
+	return -1
+}
+
+// sensorSource returns the source with more points with the value of the sensor.
+func sensorSource(sources [2][]*gpx.WptType, value func(*Sensor) *float64) int {
+	var count [2]int
+	for k, points := range sources {
+		for _, w := range points {
+			if s := GetSensor(*w); *value(&s) != 0 {
+				count[k]++
+			}
+		}
+	}
+	switch {
+	case count[0] == 0 && count[1] == 0:
+		return -1
+	case count[1] > count[0]:
+		return 1
+	}
+	return 0
+}
+
+// pointsAround returns the points of a source before and after t and the fraction of t between them,
+// false when t is outside the source or in a gap longer than maxGap seconds.
+func pointsAround(points []*gpx.WptType, t time.Time, maxGap float64) (gpx.WptType, gpx.WptType, float64, bool) {
+	i := sort.Search(len(points), func(i int) bool {
+		return !points[i].Time.Before(t)
+	})
+	if i == len(points) {
+		return gpx.WptType{}, gpx.WptType{}, 0, false
+	}
+	if points[i].Time.Equal(t) {
+		return *points[i], *points[i], 0, true
+	}
+	if i == 0 {
+		return gpx.WptType{}, gpx.WptType{}, 0, false
+	}
+	a, b := *points[i-1], *points[i]
+	gap := b.Time.Sub(a.Time).Seconds()
+	if gap > maxGap {
+		return gpx.WptType{}, gpx.WptType{}, 0, false
+	}
+	return a, b, t.Sub(a.Time).Seconds() / gap, true
+}
+
+// spanSource returns the source whose positions have the best DistanceQuality in a span, the source
+// with more points when the quality is the same and -1 when there aren't points.
+func spanSource(spans [2][]*gpx.WptType) int {
+	switch {
+	case len(spans[0]) == 0 && len(spans[1]) == 0:
+		return -1
+	case len(spans[0]) == 0:
+		return 1
+	case len(spans[1]) == 0:
+		return 0
+	}
+	var quality [2]float64
+	for k, points := range spans {
+		// DistanceQuality doesn't change the points
+		quality[k] = DistanceQuality(gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{{TrkPt: points}}}}})
+	}
+	if quality[1] > quality[0] || (quality[1] == quality[0] && len(spans[1]) > len(spans[0])) {
+		return 1
+	}
+	return 0
+}
+
+// mergeSensor is a sensor value and the source of the value.
+type mergeSensor struct {
+	source int
+	value  func(*Sensor) *float64
+}
+
+// mergePoint returns the point of a source with the elevation and the sensor values of the sources
+// selected for them, interpolated at the time of the point.
+func mergePoint(w gpx.WptType, source int, sources [2][]*gpx.WptType, elevation int, sensors []mergeSensor, span float64) gpx.WptType {
+	if elevation >= 0 && elevation != source {
+		if p, q, f, ok := pointsAround(sources[elevation], w.Time, span); ok {
+			w.Ele = p.Ele + (q.Ele-p.Ele)*f
+		}
+	}
+
+	own := GetSensor(w)
+	sensor := own
+	for _, k := range sensors {
+		if k.source < 0 || k.source == source {
+			continue
+		}
+		if p, q, f, ok := pointsAround(sources[k.source], w.Time, span); ok {
+			s := InterpolateSensor(GetSensor(p), GetSensor(q), f)
+			*k.value(&sensor) = *k.value(&s)
+		}
+	}
+	if sensor != own {
+		SetSensor(&w, sensor)
+	}
+	return w
+}
+
+// Merge aligns two recordings of the same activity by time and returns a track with the best of each one.
+// The time is divided in spans of span seconds and the positions of each span are taken from the track
+// with the best DistanceQuality in the span, the other track fills the part of the span that is not
+// covered by the selected track. The elevation is taken from the smoother track, usually the
+// one with a barometric altimeter, and the heart rate, cadence, power and temperature from the track with
+// more values of each sensor, they are interpolated at the time of each point. The tracks must overlap
+// at least MergeMinOverlap of the time of the shorter one.
+func Merge(a, b gpx.GPX, span float64) (gpx.GPX, MergeStats, error) {
+	var stats MergeStats
+	sources := [2][]*gpx.WptType{timedPoints(a), timedPoints(b)}
+	if len(sources[0]) < 2 || len(sources[1]) < 2 || span <= 0 {
+		return gpx.GPX{}, stats, ErrMergeTime
+	}
+	// two recordings of the same activity are recorded at the same time
+	startA, endA := sources[0][0].Time, sources[0][len(sources[0])-1].Time
+	startB, endB := sources[1][0].Time, sources[1][len(sources[1])-1].Time
+	overlapStart, overlapEnd, ok := TimeOverlap(startA, endA, startB, endB)
+	shorter := math.Min(endA.Sub(startA).Seconds(), endB.Sub(startB).Seconds())
+	if !ok || overlapEnd.Sub(overlapStart).Seconds() < shorter*MergeMinOverlap {
+		return gpx.GPX{}, stats, ErrMergeTime
+	}
+
+	heartRate := func(s *Sensor) *float64 { return &s.HeartRate }
+	cadence := func(s *Sensor) *float64 { return &s.Cadence }
+	power := func(s *Sensor) *float64 { return &s.Power }
+	temperature := func(s *Sensor) *float64 { return &s.Temperature }
+	stats.Elevation = elevationSource(sources)
+	stats.HeartRate = sensorSource(sources, heartRate)
+	stats.Cadence = sensorSource(sources, cadence)
+	stats.Power = sensorSource(sources, power)
+	stats.Temperature = sensorSource(sources, temperature)
+	sensors := []mergeSensor{{stats.HeartRate, heartRate}, {stats.Cadence, cadence}, {stats.Power, power}, {stats.Temperature, temperature}}
+
+	start, end := startA, endA
+	if startB.Before(start) {
+		start = startB
+	}
+	if endB.After(end) {
+		end = endB
+	}
+
+	trk := &gpx.TrkType{}
+	var seg *gpx.TrkSegType
+	add := func(source int, points []*gpx.WptType) {
+		for _, WptType := range points {
+			w := mergePoint(*WptType, source, sources, stats.Elevation, sensors, span)
+			// a new segment starts after a gap longer than the span
+			if seg == nil || w.Time.Sub(seg.TrkPt[len(seg.TrkPt)-1].Time).Seconds() > span {
+				seg = &gpx.TrkSegType{}
+				trk.TrkSeg = append(trk.TrkSeg, seg)
+			}
+			seg.TrkPt = append(seg.TrkPt, &w)
+		}
+	}
+
+	var index [2]int
+	duration := time.Duration(span * float64(time.Second))
+	for t0 := start; !t0.After(end); t0 = t0.Add(duration) {
+		var spans [2][]*gpx.WptType
+		for k, points := range sources {
+			for index[k] < len(points) && points[index[k]].Time.Before(t0.Add(duration)) {
+				spans[k] = append(spans[k], points[index[k]])
+				index[k]++
+			}
+		}
+		source := spanSource(spans)
+		if source < 0 {
+			continue
+		}
+		stats.PositionSpans[source]++
+
+		// the other track fills the beginning and the end of the span when the source doesn't cover them
+		points := spans[source]
+		var before, after []*gpx.WptType
+		for _, w := range spans[1-source] {
+			if w.Time.Before(points[0].Time) {
+				before = append(before, w)
+			} else if w.Time.After(points[len(points)-1].Time) {
+				after = append(after, w)
+			}
+		}
+		add(1-source, before)
+		add(source, points)
+		add(1-source, after)
+	}
+
+	result := gpx.GPX{
+		Version: "1.1",
+		Creator: a.Creator,
+		Trk:     []*gpx.TrkType{trk},
+	}
+	if len(a.Trk) > 0 {
+		trk.Name, trk.Type = a.Trk[0].Name, a.Trk[0].Type
+	}
+	return result, stats, nil
+}
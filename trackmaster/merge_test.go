@@ -0,0 +1,89 @@
+package trackmaster_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// mergeGPX returns a track going north with a point every second from the offset, the positions of
+// the first two minutes are noisy with noisyPositions and the elevation is noisy with noisyElevation.
+func mergeGPX(offset, n int, noisyPositions, noisyElevation bool, heartRate float64) gpx.GPX {
+	start := time.Date(2023, time.June, 4, 9, 0, 0, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i := offset; i < offset+n; i++ {
+		w := &gpx.WptType{
+			Lat:  42 + float64(i)*0.00003,
+			Lon:  2,
+			Ele:  100 + float64(i)/10,
+			Time: start.Add(time.Duration(i) * time.Second),
+		}
+		if noisyPositions && i < 120 {
+			w.Lon += math.Pow(-1, float64(i)) * 0.0003
+		}
+		if noisyElevation {
+			w.Ele += math.Pow(-1, float64(i)) * 3
+		}
+		if heartRate != 0 {
+			trackmaster.SetSensor(w, trackmaster.Sensor{HeartRate: heartRate})
+		}
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	return gpx.GPX{Creator: "test", Trk: []*gpx.TrkType{{Name: "run", TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+func TestMerge(t *testing.T) {
+	// the watch has a barometric altimeter and heart rate but bad positions at the beginning,
+	// the phone started 30 seconds later
+	watch := mergeGPX(0, 300, true, false, 150)
+	phone := mergeGPX(30, 300, false, true, 0)
+
+	g, stats, err := trackmaster.Merge(watch, phone, trackmaster.MergeSpan)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Elevation)
+	assert.Equal(t, 0, stats.HeartRate)
+	assert.Equal(t, -1, stats.Power)
+	assert.Equal(t, [2]int{3, 3}, stats.PositionSpans)
+	assert.Equal(t, "run", g.Trk[0].Name)
+
+	points := g.Trk[0].TrkSeg[0].TrkPt
+	assert.Len(t, points, 330)
+	for i, w := range points {
+		assert.Equal(t, i, int(w.Time.Sub(points[0].Time).Seconds()))
+		// the elevation of the phone is replaced while the watch has data
+		if i < 300 {
+			assert.InDelta(t, 100+float64(i)/10, w.Ele, 1e-6)
+			assert.Equal(t, 150.0, trackmaster.GetSensor(*w).HeartRate)
+		}
+		// the noisy positions of the watch are only used before the phone started
+		if i >= 30 {
+			assert.Equal(t, 2.0, w.Lon)
+		}
+	}
+
+	_, _, err = trackmaster.Merge(watch, gpx.GPX{}, trackmaster.MergeSpan)
+	assert.Equal(t, trackmaster.ErrMergeTime, err)
+
+	// the same route recorded on different days or only partially at the same time
+	_, _, err = trackmaster.Merge(watch, mergeGPX(86400, 300, false, false, 0), trackmaster.MergeSpan)
+	assert.Equal(t, trackmaster.ErrMergeTime, err)
+	_, _, err = trackmaster.Merge(watch, mergeGPX(250, 300, false, false, 0), trackmaster.MergeSpan)
+	assert.Equal(t, trackmaster.ErrMergeTime, err)
+
+	// the elevations that are missing in both tracks are not filled by the quality of the spans
+	a, b := mergeGPX(0, 300, false, false, 0), mergeGPX(0, 300, true, false, 0)
+	for _, g := range []gpx.GPX{a, b} {
+		for _, w := range g.Trk[0].TrkSeg[0].TrkPt[10:20] {
+			w.Ele = 0
+		}
+	}
+	g, _, err = trackmaster.Merge(a, b, trackmaster.MergeSpan)
+	assert.NoError(t, err)
+	for _, w := range g.Trk[0].TrkSeg[0].TrkPt[10:20] {
+		assert.Equal(t, 0.0, w.Ele)
+	}
+}
@@ -2,7 +2,6 @@ package trackmaster
 
 import (
 	"math"
-	"os"
 	"strings"
 
 	"github.com/codingsince1985/geo-golang"
@@ -23,6 +22,9 @@ type MoveTrk struct {
 	Segment int
 }
 
+// DefaultSegmentPoints is the minimum number of points of a segment used by the joinsegments command.
+const DefaultSegmentPoints = 14
+
 func MoveSegment(g gpx.GPX, minPoints int, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
 	var move []MoveTrk
@@ -122,42 +124,58 @@ func PreviousSegment(g gpx.GPX, trkTypeNo, trkSegTypeNo int) (int, int) {
 	return trkTypeNo, trkSegTypeNo
 }
 
-func ClassificationTrack(filename string) string {
+// Clone returns a deep copy of the tracks of a GPX, so that it can be fixed without modifying the original.
+func Clone(g gpx.GPX) gpx.GPX {
+	dst := g
+	dst.Trk = make([]*gpx.TrkType, len(g.Trk))
+	for trkTypeNo, TrkType := range g.Trk {
+		trk := *TrkType
+		trk.TrkSeg = make([]*gpx.TrkSegType, len(TrkType.TrkSeg))
+		for trkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			seg := *TrkSegType
+			seg.TrkPt = make([]*gpx.WptType, len(TrkSegType.TrkPt))
+			for wptTypeNo, WptType := range TrkSegType.TrkPt {
+				wpt := *WptType
+				if WptType.Extensions != nil {
+					wpt.Extensions = &gpx.ExtensionsType{XML: append([]byte(nil), WptType.Extensions.XML...)}
+				}
+				seg.TrkPt[wptTypeNo] = &wpt
+			}
+			trk.TrkSeg[trkSegTypeNo] = &seg
+		}
+		dst.Trk[trkTypeNo] = &trk
+	}
+	return dst
+}
+
+// ClassificationTrack classifies the activity of a track, the GPX is not modified.
+func ClassificationTrack(original gpx.GPX) string {
 	var speedUp, speedDown, speedFlat, speedTotal, elevation, distance float64
 	var total int
 
-	f, err := os.Open(filename)
-	if err != nil {
-		return ClassificationNone
-	}
-	defer f.Close()
-
-	g, err := gpx.Read(f)
-	if err != nil {
-		return ClassificationNone
-	}
+	g := Clone(original)
 
 	// first the points without time are corrected, because it is needed for the rest of the functions
-	_ = FixTimesTrack(*g, true)
+	_ = FixTimesTrack(g, true)
 
 	// Removes points that have been recorded excessively far away, at more than 200 m/s
-	_ = MaxSpeed(*g, 200, true)
+	_ = MaxSpeed(g, 200, true)
 
 	// Simplifies the track and removes points that are not necessary
-	_ = RemoveStops(*g, 0.0, 1.2, math.MaxFloat64, 0, true)
+	_ = RemoveStops(g, 0.0, 1.2, math.MaxFloat64, 0, true)
 
 	// We remove the stops of more than 90 seconds in less than 5 meters
-	_ = RemoveStops(*g, 30.0, 9.0, 8, 12, true)
+	_ = RemoveStops(g, 30.0, 9.0, 8, 12, true)
 
-	RemoveIntersections(*g, 7, true)
-	RemoveIntersections(*g, 7, true)
-	RemoveIntersections(*g, 7, true)
-	RemoveIntersections(*g, 7, true)
+	RemoveIntersections(g, 7, true)
+	RemoveIntersections(g, 7, true)
+	RemoveIntersections(g, 7, true)
+	RemoveIntersections(g, 7, true)
 
-	num, err := ElevationSRTMAccuracy(*g)
+	num, err := ElevationSRTMAccuracy(g)
 	if err != nil {
 		if num < 60 {
-			_ = ElevationSRTM(*g)
+			_ = ElevationSRTM(g)
 		}
 	}
 
@@ -244,15 +262,27 @@ func ClassificationTrack(filename string) string {
 	return c
 }
 
-func GetLocationStart(g gpx.GPX) (geo.Address, error) {
+// MissingAddress is the address of the tracks whose location can't be found.
+var MissingAddress = geo.Address{Country: "Missing", CountryCode: "XX", City: "Missing", State: "Missing"}
+
+// Geocoder returns the address of a position.
+type Geocoder interface {
+	ReverseGeocode(lat, lng float64) (*geo.Address, error)
+}
+
+// OnlineGeocoder returns the OpenStreetMap Nominatim geocoder.
+func OnlineGeocoder() Geocoder {
+	return openstreetmap.Geocoder()
+}
+
+// GetLocationStart returns the address of the first point with position using the geocoder.
+func GetLocationStart(g gpx.GPX, geocoder Geocoder) (geo.Address, error) {
 	for _, TrkType := range g.Trk {
 		for _, TrkSegType := range TrkType.TrkSeg {
 			for _, WptType := range TrkSegType.TrkPt {
 				if WptType.Lat != 0 && WptType.Lon != 0 {
-					service := openstreetmap.Geocoder()
-
-					address, err := service.ReverseGeocode(WptType.Lat, WptType.Lon)
-					if err != nil {
+					address, err := geocoder.ReverseGeocode(WptType.Lat, WptType.Lon)
+					if err != nil || address == nil {
 						goto next
 					}
 					// cleanup the address
@@ -266,7 +296,37 @@ func GetLocationStart(g gpx.GPX) (geo.Address, error) {
 		}
 	}
 next:
-	return geo.Address{Country: "Missing", CountryCode: "XX", City: "Missing", State: "Missing"}, ErrNoLocation
+	return MissingAddress, ErrNoLocation
+}
+
+// GetLocationEnd returns the address of the last position of the track.
+func GetLocationEnd(g gpx.GPX, geocoder Geocoder) (geo.Address, error) {
+	WptType := GetPositionEnd(g)
+	if WptType.Lat == 0 && WptType.Lon == 0 {
+		return MissingAddress, ErrNoLocation
+	}
+	address, err := geocoder.ReverseGeocode(WptType.Lat, WptType.Lon)
+	if err != nil || address == nil {
+		return MissingAddress, ErrNoLocation
+	}
+	address.Country = geoNameCleanup(address.Country)
+	address.City = geoNameCleanup(address.City)
+	address.State = geoNameCleanup(address.State)
+
+	return *address, nil
+}
+
+// GetName returns the name of the track from the metadata or from the first track.
+func GetName(g gpx.GPX) string {
+	if g.Metadata != nil && strings.TrimSpace(g.Metadata.Name) != "" {
+		return strings.TrimSpace(g.Metadata.Name)
+	}
+	for _, TrkType := range g.Trk {
+		if strings.TrimSpace(TrkType.Name) != "" {
+			return strings.TrimSpace(TrkType.Name)
+		}
+	}
+	return ""
 }
 
 func geoNameCleanup(input string) string {
@@ -360,24 +420,3 @@ func GetCreator(g gpx.GPX) string {
 
 	return creator
 }
-
-func QualityTrack(g gpx.GPX) float64 {
-	t := TimeQuality(g)
-	e, _ := ElevationSRTMAccuracy(g)
-	d := DistanceQuality(g)
-
-	Log.WithFields(logrus.Fields{
-		"Time":      t,
-		"Elevation": e,
-		"Distance":  d,
-	}).Debug("Quality result")
-
-	if e < 0 {
-		e = 0
-	}
-
-	// time 10%
-	// elevation 30%
-	// distance 60%
-	return math.Round((float64(t)/10+(d*6/10)+(float64(e)*3/10))*100) / 100
-}
@@ -0,0 +1,133 @@
+package trackmaster
+
+import (
+	"sort"
+	"time"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// overlapMaxGap is the maximum time in seconds between two points of a track to interpolate its position
+const overlapMaxGap = 60
+
+// OverlapResult is the time overlap of two tracks. Seconds is the duration of the overlap and Fraction
+// the part of the time of each track that overlaps. Distance is the median distance in meters between
+// the positions of both tracks at the same time during the overlap, calculated from Samples points, and
+// Coincident is true when it is within the tolerance.
+type OverlapResult struct {
+	Start      time.Time  `json:"start"`
+	End        time.Time  `json:"end"`
+	Seconds    float64    `json:"seconds"`
+	Fraction   [2]float64 `json:"fraction"`
+	Samples    int        `json:"samples"`
+	Distance   float64    `json:"distance"`
+	Coincident bool       `json:"coincident"`
+}
+
+// TimeOverlap returns the common time of two time ranges, false when they don't overlap.
+func TimeOverlap(startA, endA, startB, endB time.Time) (time.Time, time.Time, bool) {
+	start, end := startA, endA
+	if startB.After(start) {
+		start = startB
+	}
+	if endB.Before(end) {
+		end = endB
+	}
+	return start, end, start.Before(end)
+}
+
+// Overlap returns the overlap of the times of two tracks and compares their positions during the overlap,
+// the positions of b are interpolated at the times of the points of a.
+func Overlap(a, b gpx.GPX, tolerance float64) OverlapResult {
+	var result OverlapResult
+	pa, pb := timedPoints(a), timedPoints(b)
+	if len(pa) < 2 || len(pb) < 2 {
+		return result
+	}
+	startA, endA := pa[0].Time, pa[len(pa)-1].Time
+	startB, endB := pb[0].Time, pb[len(pb)-1].Time
+	start, end, ok := TimeOverlap(startA, endA, startB, endB)
+	if !ok {
+		return result
+	}
+	result.Start, result.End = start, end
+	result.Seconds = end.Sub(start).Seconds()
+	result.Fraction = [2]float64{result.Seconds / endA.Sub(startA).Seconds(), result.Seconds / endB.Sub(startB).Seconds()}
+
+	var distances []float64
+	for _, w := range pa {
+		if w.Time.Before(start) || w.Time.After(end) {
+			continue
+		}
+		if p, q, f, ok := pointsAround(pb, w.Time, overlapMaxGap); ok {
+			distances = append(distances, HaversineDistance(w.Lat, w.Lon, p.Lat+(q.Lat-p.Lat)*f, p.Lon+(q.Lon-p.Lon)*f))
+		}
+	}
+	result.Samples = len(distances)
+	if len(distances) > 0 {
+		sort.Float64s(distances)
+		result.Distance = distances[len(distances)/2]
+		result.Coincident = result.Distance <= tolerance
+	}
+	return result
+}
+
+// RemoveTimeRange removes the points between start and end, both included, to trim the overlap of two
+// tracks. The segments are split where the points are removed and the empty segments are removed.
+func RemoveTimeRange(g gpx.GPX, start, end time.Time, fix bool) []GPXElementInfo {
+	var result []GPXElementInfo
+	for TrkTypeNo, TrkType := range g.Trk {
+		var segments []*gpx.TrkSegType
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			current := &gpx.TrkSegType{}
+			for WptTypeNo, WptType := range TrkSegType.TrkPt {
+				if !timeValid(WptType.Time) || WptType.Time.Before(start) || WptType.Time.After(end) {
+					current.TrkPt = append(current.TrkPt, WptType)
+					continue
+				}
+				result = append(result, GPXElementInfo{
+					WptType:      *WptType,
+					WptTypeNo:    WptTypeNo,
+					TrkSegTypeNo: TrkSegTypeNo,
+					TrkTypeNo:    TrkTypeNo,
+				})
+				if len(current.TrkPt) > 0 {
+					segments = append(segments, current)
+					current = &gpx.TrkSegType{}
+				}
+			}
+			if len(current.TrkPt) > 0 {
+				segments = append(segments, current)
+			}
+		}
+		if fix {
+			TrkType.TrkSeg = segments
+		}
+	}
+	return result
+}
+
+// Splice adds to a the points of b outside the time of a, the points before a in a new segment at the
+// beginning of its first track and the points after a in a new segment at the end of its last track.
+func Splice(a, b gpx.GPX) gpx.GPX {
+	pa := timedPoints(a)
+	if len(pa) == 0 || len(a.Trk) == 0 {
+		return a
+	}
+	before, after := &gpx.TrkSegType{}, &gpx.TrkSegType{}
+	for _, w := range timedPoints(b) {
+		if w.Time.Before(pa[0].Time) {
+			before.TrkPt = append(before.TrkPt, w)
+		} else if w.Time.After(pa[len(pa)-1].Time) {
+			after.TrkPt = append(after.TrkPt, w)
+		}
+	}
+	if len(before.TrkPt) > 0 {
+		a.Trk[0].TrkSeg = append([]*gpx.TrkSegType{before}, a.Trk[0].TrkSeg...)
+	}
+	if len(after.TrkPt) > 0 {
+		last := a.Trk[len(a.Trk)-1]
+		last.TrkSeg = append(last.TrkSeg, after)
+	}
+	return a
+}
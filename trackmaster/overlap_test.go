@@ -0,0 +1,85 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// timedGPX returns a track going north with n points, one every second from start.
+func timedGPX(lat, lon float64, start time.Time, n int) gpx.GPX {
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < n; i++ {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: lat + float64(i)*0.00005, Lon: lon, Time: start.Add(time.Duration(i) * time.Second)})
+	}
+	return gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+func TestTimeOverlap(t *testing.T) {
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	start, end, ok := trackmaster.TimeOverlap(t0, t0.Add(time.Hour), t0.Add(30*time.Minute), t0.Add(2*time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, t0.Add(30*time.Minute), start)
+	assert.Equal(t, t0.Add(time.Hour), end)
+
+	_, _, ok = trackmaster.TimeOverlap(t0, t0.Add(time.Hour), t0.Add(time.Hour), t0.Add(2*time.Hour))
+	assert.False(t, ok)
+}
+
+func TestOverlap(t *testing.T) {
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	a := timedGPX(42, 2, t0, 301)
+	// the same path recorded by other device started 100 seconds later
+	b := timedGPX(42.005, 2, t0.Add(100*time.Second), 301)
+	o := trackmaster.Overlap(a, b, 50)
+	assert.Equal(t, 200.0, o.Seconds)
+	assert.InDelta(t, 2.0/3, o.Fraction[0], 0.001)
+	assert.Equal(t, 201, o.Samples)
+	assert.True(t, o.Coincident)
+	assert.InDelta(t, 0, o.Distance, 0.1)
+
+	// the same time in other place
+	far := timedGPX(43, 2, t0.Add(100*time.Second), 301)
+	o = trackmaster.Overlap(a, far, 50)
+	assert.Equal(t, 200.0, o.Seconds)
+	assert.False(t, o.Coincident)
+
+	o = trackmaster.Overlap(a, timedGPX(42, 2, t0.Add(time.Hour), 301), 50)
+	assert.Zero(t, o.Seconds)
+}
+
+func TestRemoveTimeRange(t *testing.T) {
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	g := timedGPX(42, 2, t0, 100)
+	result := trackmaster.RemoveTimeRange(g, t0.Add(10*time.Second), t0.Add(19*time.Second), false)
+	assert.Len(t, result, 10)
+	assert.Len(t, g.Trk[0].TrkSeg, 1)
+
+	trackmaster.RemoveTimeRange(g, t0.Add(10*time.Second), t0.Add(19*time.Second), true)
+	assert.Len(t, g.Trk[0].TrkSeg, 2)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 10)
+	assert.Len(t, g.Trk[0].TrkSeg[1].TrkPt, 80)
+
+	trackmaster.RemoveTimeRange(g, t0, t0.Add(9*time.Second), true)
+	assert.Len(t, g.Trk[0].TrkSeg, 1)
+
+	// a track inside the overlap has no points left
+	contained := timedGPX(42, 2, t0.Add(10*time.Second), 20)
+	assert.Len(t, trackmaster.RemoveTimeRange(contained, t0, t0.Add(time.Minute), true), 20)
+	assert.Empty(t, contained.Trk[0].TrkSeg)
+	assert.True(t, trackmaster.TimeEmpty(contained))
+}
+
+func TestSplice(t *testing.T) {
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	a := timedGPX(42, 2, t0.Add(100*time.Second), 101)
+	b := timedGPX(42, 2, t0, 301)
+	g := trackmaster.Splice(a, b)
+	assert.Len(t, g.Trk[0].TrkSeg, 3)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 100)
+	assert.Len(t, g.Trk[0].TrkSeg[1].TrkPt, 101)
+	assert.Len(t, g.Trk[0].TrkSeg[2].TrkPt, 100)
+}
@@ -0,0 +1,312 @@
+package trackmaster
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// Step is a filter of a pipeline with its parameters, the parameters not set use the default values.
+type Step struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// StepResult contains the points changed by a step, Count is the number of points changed when the
+// filter does not return them.
+type StepResult struct {
+	Step   Step             `json:"step"`
+	Result []GPXElementInfo `json:"points,omitempty"`
+	Count  int              `json:"count"`
+}
+
+type stepParams map[string]string
+
+func (p stepParams) float(name string) float64 {
+	v, _ := strconv.ParseFloat(p[name], 64)
+	return v
+}
+
+func (p stepParams) int(name string) int {
+	return int(p.float(name))
+}
+
+type pipelineStep struct {
+	defaults stepParams
+	run      func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error)
+}
+
+// pipelineSteps contains the filters that can be used in a pipeline.
+var pipelineSteps = newPipelineSteps()
+
+// param formats the default value of a parameter.
+func param(value interface{}) string {
+	return fmt.Sprint(value)
+}
+
+// newPipelineSteps returns the filters of a pipeline, the defaults are the same configurations used by the commands.
+func newPipelineSteps() map[string]pipelineStep {
+	stops, noise, simplify := DefaultStopsConfig(), DefaultNoiseConfig(), DefaultSimplifyConfig()
+	gaussian, kalman, gaps := DefaultGaussianConfig(), DefaultKalmanConfig(), DefaultFillGapsConfig()
+
+	return map[string]pipelineStep{
+		"timestamp": {
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return nil, FixTimesTrack(g, true), nil
+			},
+		},
+		"maxspeed": {
+			defaults: stepParams{"maxspeed": param(DefaultMaxSpeed)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return MaxSpeed(g, p.float("maxspeed"), true), 0, nil
+			},
+		},
+		"removelastmaxspeed": {
+			defaults: stepParams{"maxspeed": param(DefaultLastMaxSpeed)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return RemoveLastMaxSpeed(g, p.float("maxspeed"), true), 0, nil
+			},
+		},
+		"removestops": {
+			defaults: stepParams{
+				"minseconds":   param(stops.MinSeconds),
+				"maxdistance":  param(stops.MaxDistance),
+				"maxelevation": param(stops.MaxElevation),
+				"minpoints":    param(stops.MinPoints),
+			},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return RemoveStops(g, p.float("minseconds"), p.float("maxdistance"), p.float("maxelevation"), p.int("minpoints"), true), 0, nil
+			},
+		},
+		"removeintersections": {
+			defaults: stepParams{"maxpoints": param(DefaultIntersectionPoints)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return RemoveIntersections(g, p.int("maxpoints"), true), 0, nil
+			},
+		},
+		"removenoise": {
+			defaults: stepParams{
+				"maxdistance":  param(noise.MaxDistance),
+				"maxelevation": param(noise.MaxElevation),
+				"maxpoints":    param(noise.MaxPoints),
+			},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return RemoveNoise(g, p.float("maxdistance"), p.float("maxelevation"), p.int("maxpoints"), true), 0, nil
+			},
+		},
+		"removefirstnoise": {
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return RemoveFirstNoise(g, true), 0, nil
+			},
+		},
+		"lostelevation": {
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return LostElevation(g, true), 0, nil
+			},
+		},
+		"joinsegments": {
+			defaults: stepParams{"minpoints": param(DefaultSegmentPoints)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return MoveSegment(g, p.int("minpoints"), true), 0, nil
+			},
+		},
+		"simplifypoints": {
+			defaults: stepParams{
+				"algorithm": simplify.Algorithm,
+				"distance":  param(simplify.Distance),
+				"tolerance": param(simplify.Tolerance),
+				"points":    param(simplify.Points),
+				"area":      param(simplify.Area),
+				"3d":        param(simplify.ThreeD),
+			},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				threeD := p["3d"] == "true"
+				switch p["algorithm"] {
+				case "distance":
+					return RemoveStops(g, 0.0, p.float("distance"), math.MaxFloat64, 0, true), 0, nil
+				case "douglas-peucker":
+					return SimplifyDouglasPeucker(g, p.float("tolerance"), threeD, true), 0, nil
+				case "visvalingam":
+					return SimplifyVisvalingam(g, p.int("points"), p.float("area"), threeD, true), 0, nil
+				}
+				return nil, 0, fmt.Errorf("unknown algorithm %q", p["algorithm"])
+			},
+		},
+		"smoothgaussianelevation": {
+			defaults: stepParams{"maxelevation": param(DefaultMaxSpeedVertical)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				return MaxSpeedVertical(g, p.float("maxelevation"), true), 0, nil
+			},
+		},
+		"smoothgaussiandistance": {
+			defaults: stepParams{"windowsize": param(gaussian.WindowSize), "sigma": param(gaussian.Sigma)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				SmoothGaussian(g, p.int("windowsize"), p.float("sigma"))
+				return nil, PointCount(g), nil
+			},
+		},
+		"smoothkalman": {
+			defaults: stepParams{
+				"accuracy":              param(kalman.Accuracy),
+				"elevationaccuracy":     param(kalman.ElevationAccuracy),
+				"dopfactor":             param(kalman.DOPFactor),
+				"acceleration":          param(kalman.Acceleration),
+				"elevationacceleration": param(kalman.ElevationAcceleration),
+			},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				SmoothKalman(g, KalmanConfig{
+					Accuracy:              p.float("accuracy"),
+					ElevationAccuracy:     p.float("elevationaccuracy"),
+					DOPFactor:             p.float("dopfactor"),
+					Acceleration:          p.float("acceleration"),
+					ElevationAcceleration: p.float("elevationacceleration"),
+				})
+				return nil, PointCount(g), nil
+			},
+		},
+		"resample": {
+			defaults: stepParams{"mode": ResampleTime, "interval": param(DefaultResampleInterval)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				if p["mode"] != ResampleTime && p["mode"] != ResampleDistance {
+					return nil, 0, fmt.Errorf("unknown mode %q", p["mode"])
+				}
+				if !Resample(g, p["mode"], p.float("interval")) {
+					return nil, 0, nil
+				}
+				return nil, PointCount(g), nil
+			},
+		},
+		"fillgaps": {
+			defaults: stepParams{
+				"maxseconds":  param(gaps.MaxSeconds),
+				"maxdistance": param(gaps.MaxDistance),
+				"maxpoints":   param(gaps.MaxPoints),
+				"dem":         param(gaps.DEM),
+			},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				var elevation ElevationFunc
+				if p["dem"] == "true" {
+					var err error
+					if elevation, err = ElevationDEM(); err != nil {
+						return nil, 0, err
+					}
+				}
+				result, _, err := FillGaps(g, p.float("maxseconds"), p.float("maxdistance"), p.int("maxpoints"), elevation, true)
+				return result, 0, err
+			},
+		},
+		"elevation": {
+			defaults: stepParams{"accuracy": param(DefaultElevationAccuracy)},
+			run: func(g gpx.GPX, p stepParams) ([]GPXElementInfo, int, error) {
+				num, err := ElevationSRTMAccuracy(g)
+				if err != nil || num > p.int("accuracy") {
+					return nil, 0, err
+				}
+				return nil, PointCount(g), ElevationSRTM(g)
+			},
+		},
+	}
+}
+
+// PipelineSteps returns the names of the filters that can be used in a pipeline.
+func PipelineSteps() []string {
+	var names []string
+	for name := range pipelineSteps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StepParams returns the parameters of a filter with their default values, nil when the filter doesn't exist.
+func StepParams(name string) map[string]string {
+	s, ok := pipelineSteps[name]
+	if !ok {
+		return nil
+	}
+	params := make(map[string]string)
+	for key, value := range s.defaults {
+		params[key] = value
+	}
+	return params
+}
+
+// ParseStep parses a step in the format name:param=value,param=value.
+func ParseStep(s string) (Step, error) {
+	name, params, _ := strings.Cut(strings.TrimSpace(s), ":")
+	step := Step{Name: name, Params: make(map[string]string)}
+	if params != "" {
+		for _, param := range strings.Split(params, ",") {
+			key, value, ok := strings.Cut(param, "=")
+			if !ok {
+				return step, fmt.Errorf("step %s: parameter %q without value", name, param)
+			}
+			step.Params[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return step, ValidateStep(step)
+}
+
+// ValidateStep checks that the filter and its parameters exist and the numeric parameters are valid.
+func ValidateStep(step Step) error {
+	s, ok := pipelineSteps[step.Name]
+	if !ok {
+		return fmt.Errorf("unknown step %q, valid steps are %s", step.Name, strings.Join(PipelineSteps(), ", "))
+	}
+	for key, value := range step.Params {
+		def, ok := s.defaults[key]
+		if !ok {
+			return fmt.Errorf("step %s: unknown parameter %q", step.Name, key)
+		}
+		if _, err := strconv.ParseFloat(def, 64); err == nil {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return fmt.Errorf("step %s: parameter %s must be a number", step.Name, key)
+			}
+		}
+	}
+	return nil
+}
+
+// RunPipeline applies the steps in order to the GPX and returns the changes of each step,
+// it stops at the first step that fails.
+func RunPipeline(g gpx.GPX, steps []Step) ([]StepResult, error) {
+	var results []StepResult
+	for _, step := range steps {
+		if err := ValidateStep(step); err != nil {
+			return results, err
+		}
+		s := pipelineSteps[step.Name]
+		params := make(stepParams)
+		for key, value := range s.defaults {
+			params[key] = value
+		}
+		for key, value := range step.Params {
+			params[key] = value
+		}
+
+		result, count, err := s.run(g, params)
+		if err != nil {
+			return results, fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if count == 0 {
+			count = len(result)
+		}
+		results = append(results, StepResult{Step: step, Result: result, Count: count})
+	}
+	return results, nil
+}
+
+// PointCount returns the number of points of all the segments.
+func PointCount(g gpx.GPX) int {
+	count := 0
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			count += len(TrkSegType.TrkPt)
+		}
+	}
+	return count
+}
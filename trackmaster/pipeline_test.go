@@ -0,0 +1,44 @@
+package trackmaster_test
+
+import (
+	"testing"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestParseStep tests the format of the steps and the validation of the parameters.
+func TestParseStep(t *testing.T) {
+	step, err := trackmaster.ParseStep("removestops:minseconds=30, maxdistance=2")
+	assert.NoError(t, err)
+	assert.Equal(t, trackmaster.Step{Name: "removestops", Params: map[string]string{"minseconds": "30", "maxdistance": "2"}}, step)
+
+	_, err = trackmaster.ParseStep("unknown")
+	assert.Error(t, err)
+	_, err = trackmaster.ParseStep("removestops:foo=1")
+	assert.Error(t, err)
+	_, err = trackmaster.ParseStep("removestops:minseconds=a")
+	assert.Error(t, err)
+	_, err = trackmaster.ParseStep("simplifypoints:algorithm=visvalingam,points=3")
+	assert.NoError(t, err)
+}
+
+// TestRunPipeline tests that the steps are applied in order and each one reports its changes.
+func TestRunPipeline(t *testing.T) {
+	seg := &gpx.TrkSegType{}
+	for i := 0; i <= 10; i++ {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: 40 + float64(i)*0.001, Lon: 0.1, Ele: 100})
+	}
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	results, err := trackmaster.RunPipeline(g, []trackmaster.Step{
+		{Name: "simplifypoints", Params: map[string]string{"algorithm": "visvalingam", "points": "5"}},
+		{Name: "simplifypoints", Params: map[string]string{"algorithm": "douglas-peucker"}},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 6, results[0].Count)
+	assert.Equal(t, 3, results[1].Count)
+	assert.Equal(t, 2, trackmaster.PointCount(g))
+}
@@ -0,0 +1,200 @@
+package trackmaster
+
+import (
+	"math"
+
+	"github.com/sirupsen/logrus"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// QualityConfig defines the weights of the time, the elevation and the distance in the quality of a track
+// and the penalties of the issues of the positions.
+type QualityConfig struct {
+	// the weights are relative to their sum
+	TimeWeight      float64
+	ElevationWeight float64
+	DistanceWeight  float64
+	// SparsePenalty is subtracted when the mean distance between points is greater than 8 m and
+	// VerySparsePenalty too when it is greater than 30 m
+	SparsePenalty     float64
+	VerySparsePenalty float64
+	// penalties of each point found by RemoveIntersections, RemoveFirstNoise, RemoveStops and RemoveNoise
+	IntersectionPenalty float64
+	FirstNoisePenalty   float64
+	ClosePointPenalty   float64
+	NoisePenalty        float64
+	// ReferencePoints normalizes the penalties of the points to a track with this number of points, they
+	// are multiplied by ReferencePoints divided by the points of the track, 0 to not normalize them
+	ReferencePoints int
+}
+
+// DefaultQualityConfig returns the configuration used by QualityTrack.
+func DefaultQualityConfig() QualityConfig {
+	return QualityConfig{
+		TimeWeight:          10,
+		ElevationWeight:     30,
+		DistanceWeight:      60,
+		SparsePenalty:       6,
+		VerySparsePenalty:   12,
+		IntersectionPenalty: 0.6,
+		FirstNoisePenalty:   0.3,
+		ClosePointPenalty:   0.2,
+		NoisePenalty:        0.4,
+		ReferencePoints:     1000,
+	}
+}
+
+const (
+	QualityTime      = "time"
+	QualityElevation = "elevation"
+	QualityDistance  = "distance"
+)
+
+// QualityCriterion is a check of the quality of a track. Measurement is the raw value of the check, the
+// number of points found or the mean distance between points, and Penalty is subtracted from the score
+// of the Group (time, elevation or distance). Points are the points found.
+type QualityCriterion struct {
+	Name        string           `json:"name"`
+	Group       string           `json:"group"`
+	Measurement float64          `json:"measurement"`
+	Penalty     float64          `json:"penalty"`
+	Points      []GPXElementInfo `json:"points,omitempty"`
+}
+
+// QualityReport is the quality of a track with the scores from 0 to 100 of the time, the elevation and
+// the distance and the criteria that reduce them.
+type QualityReport struct {
+	Quality   float64            `json:"quality"`
+	Time      float64            `json:"time"`
+	Elevation float64            `json:"elevation"`
+	Distance  float64            `json:"distance"`
+	Criteria  []QualityCriterion `json:"criteria"`
+}
+
+// timeQuality returns the score and the criteria of the time, like TimeQuality.
+func timeQuality(g gpx.GPX) (float64, []QualityCriterion) {
+	invalid, backwards, total := timeIssues(g)
+	if total == 0 {
+		return 0, nil
+	}
+	score := 0
+	if num := len(invalid) + 4*len(backwards); num <= total {
+		score = 100 - (num * 100 / total)
+	}
+	return float64(score), []QualityCriterion{
+		{Name: "invalid time", Group: QualityTime, Measurement: float64(len(invalid)), Penalty: float64(len(invalid)) * 100 / float64(total), Points: invalid},
+		{Name: "time backwards", Group: QualityTime, Measurement: float64(len(backwards)), Penalty: float64(4*len(backwards)) * 100 / float64(total), Points: backwards},
+	}
+}
+
+// elevationQuality returns the score and the criteria of the elevation, like ElevationSRTMAccuracy. The
+// score is 0 when the SRTM elevation is not available.
+func elevationQuality(g gpx.GPX) (float64, []QualityCriterion) {
+	deviated, far, total, err := elevationIssues(g)
+	if err != nil {
+		Log.WithError(err).Debug("SRTM elevation not available")
+		return 0, []QualityCriterion{{Name: "SRTM elevation not available", Group: QualityElevation, Penalty: 100}}
+	}
+	if total == 0 {
+		return 0, nil
+	}
+	score := 0
+	if num := len(deviated) + 4*len(far); num <= total {
+		score = 100 - (num * 100 / total)
+	}
+	return float64(score), []QualityCriterion{
+		{Name: "elevation deviation", Group: QualityElevation, Measurement: float64(len(deviated)), Penalty: float64(len(deviated)) * 100 / float64(total), Points: deviated},
+		{Name: "elevation large deviation", Group: QualityElevation, Measurement: float64(len(far)), Penalty: float64(4*len(far)) * 100 / float64(total), Points: far},
+	}
+}
+
+// distanceQuality returns the score and the criteria of the positions.
+func distanceQuality(g gpx.GPX, config QualityConfig) (float64, []QualityCriterion) {
+	var distance float64
+	var num int
+
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for i := 0; i < len(TrkSegType.TrkPt)-1; i++ {
+				distance += Distance2D(*TrkSegType.TrkPt[i], *TrkSegType.TrkPt[i+1])
+			}
+			num += len(TrkSegType.TrkPt)
+		}
+	}
+	if num == 0 {
+		return 100, nil
+	}
+
+	// check if points are very far away from each other
+	step := distance / float64(num)
+	spacing := QualityCriterion{Name: "point spacing", Group: QualityDistance, Measurement: step}
+	if step > 30 {
+		spacing.Penalty += config.VerySparsePenalty
+	}
+	if step > 8 {
+		spacing.Penalty += config.SparsePenalty
+	}
+	criteria := []QualityCriterion{spacing}
+
+	// the long tracks have more points with issues, so the penalty depends on the fraction of the points
+	scale := 1.0
+	if config.ReferencePoints > 0 {
+		scale = float64(config.ReferencePoints) / float64(num)
+	}
+	add := func(name string, points []GPXElementInfo, penalty float64) {
+		criteria = append(criteria, QualityCriterion{
+			Name:        name,
+			Group:       QualityDistance,
+			Measurement: float64(len(points)),
+			Penalty:     float64(len(points)) * penalty * scale,
+			Points:      points,
+		})
+	}
+	// the checks fill the missing elevations of the points, so they use a copy of the GPX
+	g = Clone(g)
+	add("intersections", RemoveIntersections(g, 5, false), config.IntersectionPenalty)
+	add("first noise", RemoveFirstNoise(g, false), config.FirstNoisePenalty)
+	add("close points", RemoveStops(g, 0.0, .5, math.MaxFloat64, 0, false), config.ClosePointPenalty)
+	add("high noise", RemoveNoise(g, 6, 1.1, 4, false), config.NoisePenalty)
+
+	quality := 100.0
+	for _, c := range criteria {
+		quality -= c.Penalty
+	}
+	return math.Max(quality, 0), criteria
+}
+
+// DistanceQuality returns the quality of the positions from 0 to 100 with the default configuration.
+func DistanceQuality(g gpx.GPX) float64 {
+	quality, _ := distanceQuality(g, DefaultQualityConfig())
+	return quality
+}
+
+// Quality returns the quality of a track with the scores of the time, the elevation and the distance and
+// the criteria that explain them.
+func Quality(g gpx.GPX, config QualityConfig) QualityReport {
+	var r QualityReport
+	var criteria []QualityCriterion
+	r.Time, r.Criteria = timeQuality(g)
+	r.Elevation, criteria = elevationQuality(g)
+	r.Criteria = append(r.Criteria, criteria...)
+	r.Distance, criteria = distanceQuality(g, config)
+	r.Criteria = append(r.Criteria, criteria...)
+
+	Log.WithFields(logrus.Fields{
+		"Time":      r.Time,
+		"Elevation": r.Elevation,
+		"Distance":  r.Distance,
+	}).Debug("Quality result")
+
+	if weights := config.TimeWeight + config.ElevationWeight + config.DistanceWeight; weights > 0 {
+		quality := (r.Time*config.TimeWeight + r.Elevation*config.ElevationWeight + r.Distance*config.DistanceWeight) / weights
+		r.Quality = math.Round(quality*100) / 100
+	}
+	return r
+}
+
+// QualityTrack returns the quality of a track from 0 to 100 with the default configuration.
+func QualityTrack(g gpx.GPX) float64 {
+	return Quality(g, DefaultQualityConfig()).Quality
+}
@@ -0,0 +1,80 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+)
+
+// qualityCriterion returns the criterion of a report with the name.
+func qualityCriterion(r trackmaster.QualityReport, name string) trackmaster.QualityCriterion {
+	for _, c := range r.Criteria {
+		if c.Name == name {
+			return c
+		}
+	}
+	return trackmaster.QualityCriterion{}
+}
+
+func TestQuality(t *testing.T) {
+	config := trackmaster.DefaultQualityConfig()
+	config.ElevationWeight = 0
+
+	t0 := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	g := timedGPX(42, 2, t0, 100)
+	points := g.Trk[0].TrkSeg[0].TrkPt
+	points[10].Time = t0
+	r := trackmaster.Quality(g, config)
+	backwards := qualityCriterion(r, "time backwards")
+	assert.Equal(t, 1.0, backwards.Measurement)
+	assert.InDelta(t, 4, backwards.Penalty, 0.001)
+	assert.Len(t, backwards.Points, 1)
+	assert.Equal(t, 10, backwards.Points[0].WptTypeNo)
+	assert.Equal(t, 96.0, r.Time)
+	assert.Equal(t, 100.0, r.Distance)
+	assert.InDelta(t, (96*10+100*60)/70.0, r.Quality, 0.01)
+
+	// the weights are relative
+	config.TimeWeight, config.DistanceWeight = 1, 0
+	assert.Equal(t, 96.0, trackmaster.Quality(g, config).Quality)
+}
+
+func TestQualityNormalized(t *testing.T) {
+	config := trackmaster.DefaultQualityConfig()
+	config.ReferencePoints = 100
+
+	// the points are 10 cm apart, so all of them are close points
+	g := timedGPX(42, 2, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), 200)
+	for i, WptType := range g.Trk[0].TrkSeg[0].TrkPt {
+		WptType.Lat = 42 + float64(i)*0.000001
+	}
+	r := trackmaster.Quality(g, config)
+	close := qualityCriterion(r, "close points")
+	assert.Greater(t, close.Measurement, 0.0)
+	assert.InDelta(t, close.Measurement*config.ClosePointPenalty/2, close.Penalty, 0.001)
+
+	// the shorter tracks have more penalty
+	config.ReferencePoints = 400
+	close = qualityCriterion(trackmaster.Quality(g, config), "close points")
+	assert.InDelta(t, close.Measurement*config.ClosePointPenalty*2, close.Penalty, 0.001)
+
+	config.ReferencePoints = 0
+	close = qualityCriterion(trackmaster.Quality(g, config), "close points")
+	assert.InDelta(t, close.Measurement*config.ClosePointPenalty, close.Penalty, 0.001)
+}
+
+// TestQualityUnchanged tests that the quality doesn't change the GPX.
+func TestQualityUnchanged(t *testing.T) {
+	g := timedGPX(42, 2, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), 100)
+	for i, WptType := range g.Trk[0].TrkSeg[0].TrkPt {
+		WptType.Lat = 42 + float64(i)*0.000001
+		if i%2 == 0 {
+			WptType.Ele = 100
+		}
+	}
+	before := trackmaster.Clone(g)
+	trackmaster.Quality(g, trackmaster.DefaultQualityConfig())
+	assert.Equal(t, before.Trk[0].TrkSeg[0].TrkPt, g.Trk[0].TrkSeg[0].TrkPt)
+}
@@ -0,0 +1,119 @@
+package trackmaster
+
+import (
+	"time"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+const (
+	ResampleTime     = "time"
+	ResampleDistance = "distance"
+	// DefaultResampleInterval is the seconds or meters between points used by the resample command
+	DefaultResampleInterval = 1.0
+)
+
+// resamplePositions returns the position of each point of a segment in seconds from the first point or
+// in meters along the segment, false when the segment can't be resampled by time.
+func resamplePositions(ts gpx.TrkSegType, mode string) ([]float64, bool) {
+	positions := make([]float64, len(ts.TrkPt))
+	for i, WptType := range ts.TrkPt {
+		if mode == ResampleTime {
+			if !timeValid(WptType.Time) || (i > 0 && WptType.Time.Before(ts.TrkPt[i-1].Time)) {
+				return nil, false
+			}
+			positions[i] = WptType.Time.Sub(ts.TrkPt[0].Time).Seconds()
+			continue
+		}
+		if i > 0 {
+			positions[i] = positions[i-1] + HaversineDistanceTrkPt(*ts.TrkPt[i-1], *WptType)
+		}
+	}
+	return positions, true
+}
+
+// interpolatePoint returns the point at the fraction f between a and b.
+func interpolatePoint(a, b gpx.WptType, f float64) *gpx.WptType {
+	if f == 0 {
+		return &a
+	}
+	w := greatCircle(a, b, f)
+	if timeValid(a.Time) && timeValid(b.Time) {
+		w.Time = a.Time.Add(time.Duration(float64(b.Time.Sub(a.Time)) * f))
+	}
+	s := InterpolateSensor(GetSensor(a), GetSensor(b), f)
+	if !s.IsEmpty() {
+		SetSensor(&w, s)
+	}
+	return &w
+}
+
+// Resample interpolates the segments to a point every interval seconds or meters depending on the mode,
+// the last point of each segment is kept. The segments without valid times are not resampled by time.
+// It returns true when any segment is resampled.
+func Resample(g gpx.GPX, mode string, interval float64) bool {
+	if interval <= 0 {
+		return false
+	}
+	changed := false
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) < 2 {
+				continue
+			}
+			positions, ok := resamplePositions(*TrkSegType, mode)
+			if !ok {
+				continue
+			}
+
+			var dst []*gpx.WptType
+			last := len(positions) - 1
+			i := 0
+			for k := 0; float64(k)*interval < positions[last]; k++ {
+				target := float64(k) * interval
+				for positions[i+1] < target {
+					i++
+				}
+				f := 0.0
+				if positions[i+1] > positions[i] {
+					f = (target - positions[i]) / (positions[i+1] - positions[i])
+				}
+				dst = append(dst, interpolatePoint(*TrkSegType.TrkPt[i], *TrkSegType.TrkPt[i+1], f))
+			}
+			TrkSegType.TrkPt = append(dst, TrkSegType.TrkPt[last])
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Decimate removes the points that are closer than interval seconds or meters to the previous point
+// that is kept, the first and last points of each segment are kept. The sensor values of the removed points
+// are not merged into the kept points, they are a sample at a fixed rate.
+func Decimate(g gpx.GPX, mode string, interval float64, fix bool) []GPXElementInfo {
+	var result []GPXElementInfo
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) < 3 {
+				continue
+			}
+			positions, ok := resamplePositions(*TrkSegType, mode)
+			if !ok {
+				continue
+			}
+
+			keep := make([]bool, len(positions))
+			keep[0], keep[len(positions)-1] = true, true
+			reference := positions[0]
+			for i := 1; i < len(positions)-1; i++ {
+				if positions[i]-reference >= interval {
+					keep[i] = true
+					reference = positions[i]
+				}
+			}
+
+			result = append(result, simplifySegment(g, TrkTypeNo, TrkSegTypeNo, keep, fix)...)
+		}
+	}
+	return result
+}
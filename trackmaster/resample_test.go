@@ -0,0 +1,70 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+func resampleGPX() gpx.GPX {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i, seconds := range []int{0, 3, 4, 10} {
+		w := &gpx.WptType{
+			Lat:  40 + float64(i)*0.001,
+			Lon:  0.1,
+			Ele:  100 + float64(seconds),
+			Time: start.Add(time.Duration(seconds) * time.Second),
+		}
+		trackmaster.SetSensor(w, trackmaster.Sensor{HeartRate: 100 + float64(seconds)})
+		seg.TrkPt = append(seg.TrkPt, w)
+	}
+	return gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+// TestResample tests the interpolation of the position, elevation, time and sensors.
+func TestResample(t *testing.T) {
+	g := resampleGPX()
+	trackmaster.Resample(g, trackmaster.ResampleTime, 2)
+	points := g.Trk[0].TrkSeg[0].TrkPt
+	assert.Len(t, points, 6)
+	for i, w := range points[:5] {
+		assert.Equal(t, 2*i, int(w.Time.Sub(points[0].Time).Seconds()))
+		assert.InDelta(t, 100+float64(2*i), w.Ele, 1e-9)
+		assert.InDelta(t, 100+float64(2*i), trackmaster.GetSensor(*w).HeartRate, 1e-9)
+	}
+	assert.InDelta(t, 40.0+0.002/3, points[1].Lat, 1e-7)
+	assert.InDelta(t, 0.1, points[1].Lon, 1e-9)
+
+	g = resampleGPX()
+	trackmaster.Resample(g, trackmaster.ResampleDistance, 50)
+	points = g.Trk[0].TrkSeg[0].TrkPt
+	assert.Len(t, points, 8)
+	assert.InDelta(t, 50, trackmaster.HaversineDistanceTrkPt(*points[0], *points[1]), 0.1)
+}
+
+// TestDecimate tests that the points closer than the interval are removed.
+func TestDecimate(t *testing.T) {
+	g := resampleGPX()
+	result := trackmaster.Decimate(g, trackmaster.ResampleTime, 4, true)
+	assert.Len(t, result, 1)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 3)
+	assert.Equal(t, 104.0, g.Trk[0].TrkSeg[0].TrkPt[1].Ele)
+	// the sensors of the kept points are not merged with the removed points
+	assert.Equal(t, 100.0, trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[0]).HeartRate)
+	assert.Equal(t, 104.0, trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[1]).HeartRate)
+}
+
+// TestResampleUnchanged tests that the segments without valid times are not reported as resampled by time.
+func TestResampleUnchanged(t *testing.T) {
+	g := resampleGPX()
+	for _, w := range g.Trk[0].TrkSeg[0].TrkPt {
+		w.Time = time.Time{}
+	}
+	assert.False(t, trackmaster.Resample(g, trackmaster.ResampleTime, 2))
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 4)
+	assert.True(t, trackmaster.Resample(g, trackmaster.ResampleDistance, 50))
+}
@@ -0,0 +1,272 @@
+package trackmaster
+
+import (
+	"math"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+const (
+	// ShapeInterval is the default distance in meters between the points of a shape
+	ShapeInterval = 10
+	// ShapeMaxPoints limits the points of a shape, the interval is increased for the long tracks
+	ShapeMaxPoints = 1000
+)
+
+// Shape is the geometry of a track resampled at a constant distance, the segments are joined and the
+// points without position are skipped.
+type Shape struct {
+	Points   []gpx.WptType
+	Interval float64
+	Bounds   gpx.BoundsType
+}
+
+// TrackShape returns the shape of a track with a point every interval meters and at most maxPoints points.
+func TrackShape(g gpx.GPX, interval float64, maxPoints int) Shape {
+	var points []gpx.WptType
+	for _, TrkType := range g.Trk {
+		for _, TrkSegType := range TrkType.TrkSeg {
+			for _, WptType := range TrkSegType.TrkPt {
+				if WptType.Lat != 0 || WptType.Lon != 0 {
+					points = append(points, gpx.WptType{Lat: WptType.Lat, Lon: WptType.Lon})
+				}
+			}
+		}
+	}
+	shape := Shape{Interval: interval, Bounds: GetBounds(g)}
+	if len(points) < 2 {
+		shape.Points = points
+		return shape
+	}
+
+	positions := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		positions[i] = positions[i-1] + HaversineDistanceTrkPt(points[i-1], points[i])
+	}
+	last := len(points) - 1
+	if maxPoints > 1 && positions[last]/interval > float64(maxPoints-1) {
+		shape.Interval = positions[last] / float64(maxPoints-1)
+	}
+
+	i := 0
+	for k := 0; float64(k)*shape.Interval < positions[last]; k++ {
+		target := float64(k) * shape.Interval
+		for positions[i+1] < target {
+			i++
+		}
+		f := 0.0
+		if positions[i+1] > positions[i] {
+			f = (target - positions[i]) / (positions[i+1] - positions[i])
+		}
+		shape.Points = append(shape.Points, gpx.WptType{
+			Lat: points[i].Lat + (points[i+1].Lat-points[i].Lat)*f,
+			Lon: points[i].Lon + (points[i+1].Lon-points[i].Lon)*f,
+		})
+	}
+	shape.Points = append(shape.Points, points[last])
+	return shape
+}
+
+// BoundsOverlap returns true when the bounds intersect after expanding them margin meters.
+func BoundsOverlap(a, b gpx.BoundsType, margin float64) bool {
+	dLat := toDegrees(margin / earthRadius)
+	dLon := dLat / math.Max(math.Cos(toRadians((a.MinLat+a.MaxLat)/2)), 0.01)
+	return a.MinLat-dLat <= b.MaxLat && b.MinLat-dLat <= a.MaxLat && a.MinLon-dLon <= b.MaxLon && b.MinLon-dLon <= a.MaxLon
+}
+
+// projectShape projects the points to meters around lat0 like projectSegment, so both shapes use the
+// same projection.
+func projectShape(points []gpx.WptType, lat0 float64) []vector {
+	coefficient := math.Cos(toRadians(lat0))
+	result := make([]vector, len(points))
+	for i, WptType := range points {
+		result[i] = vector{x: WptType.Lon * coefficient * oneDegree, y: WptType.Lat * oneDegree}
+	}
+	return result
+}
+
+// frechetDistance returns the discrete Fréchet distance in meters between two lines, the minimum leash
+// needed to walk both lines forward at the same time. The calculation stops returning infinity when the
+// distance is greater than limit.
+func frechetDistance(a, b []vector, limit float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.Inf(1)
+	}
+	// the squared distances keep the order and are faster
+	limit *= limit
+	previous := make([]float64, len(b))
+	current := make([]float64, len(b))
+	for i := range a {
+		reachable := false
+		for j := range b {
+			v := a[i].sub(b[j])
+			d := v.dot(v)
+			switch {
+			case i == 0 && j == 0:
+				current[j] = d
+			case i == 0:
+				current[j] = math.Max(current[j-1], d)
+			case j == 0:
+				current[j] = math.Max(previous[j], d)
+			default:
+				current[j] = math.Max(math.Min(previous[j], math.Min(previous[j-1], current[j-1])), d)
+			}
+			reachable = reachable || current[j] <= limit
+		}
+		if !reachable {
+			return math.Inf(1)
+		}
+		previous, current = current, previous
+	}
+	return math.Sqrt(previous[len(b)-1])
+}
+
+// directedHausdorff returns the largest distance from a point of a to the nearest point of b, the search
+// of a point stops when it can't be the largest.
+func directedHausdorff(a, b []vector) float64 {
+	result := 0.0
+	for _, p := range a {
+		nearest := math.MaxFloat64
+		for _, q := range b {
+			d := p.sub(q).length()
+			if d < nearest {
+				nearest = d
+			}
+			if nearest <= result {
+				break
+			}
+		}
+		result = math.Max(result, nearest)
+	}
+	return result
+}
+
+// hausdorffDistance returns the symmetric discrete Hausdorff distance in meters between two lines, the
+// largest distance from a point of a line to the nearest point of the other line.
+func hausdorffDistance(a, b []vector) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.Inf(1)
+	}
+	return math.Max(directedHausdorff(a, b), directedHausdorff(b, a))
+}
+
+// nearestPoints returns the nearest point of the line to p of each pass at most tolerance meters
+// from p, a line can pass several times near the same position.
+func nearestPoints(p vector, line []vector, tolerance float64) []int {
+	var result []int
+	best := math.MaxFloat64
+	for i, q := range line {
+		d := p.sub(q).length()
+		switch {
+		case d > tolerance:
+			best = math.MaxFloat64
+		case best == math.MaxFloat64:
+			result = append(result, i)
+			best = d
+		case d < best:
+			result[len(result)-1] = i
+			best = d
+		}
+	}
+	return result
+}
+
+// alignment is the common part of two lines, from a[firstA] and b[firstB] to a[lastA] and b[lastB].
+type alignment struct {
+	firstA, firstB, lastA, lastB int
+}
+
+// alignments returns the possible common parts of two lines: the line that starts later starts the
+// common part at its first point and the other line at its nearest point, and the same for the end.
+// The lines can pass several times near the beginning or the end, like the loops, so all the
+// combinations are returned.
+func alignments(a, b []vector, tolerance float64) []alignment {
+	type pair struct{ a, b int }
+	var starts, ends []pair
+	for _, j := range nearestPoints(a[0], b, tolerance) {
+		starts = append(starts, pair{0, j})
+	}
+	for _, i := range nearestPoints(b[0], a, tolerance) {
+		starts = append(starts, pair{i, 0})
+	}
+	for _, j := range nearestPoints(a[len(a)-1], b, tolerance) {
+		ends = append(ends, pair{len(a) - 1, j})
+	}
+	for _, i := range nearestPoints(b[len(b)-1], a, tolerance) {
+		ends = append(ends, pair{i, len(b) - 1})
+	}
+
+	var result []alignment
+	for _, start := range starts {
+		for _, end := range ends {
+			if start.a < end.a && start.b < end.b {
+				result = append(result, alignment{firstA: start.a, firstB: start.b, lastA: end.a, lastB: end.b})
+			}
+		}
+	}
+	return result
+}
+
+// FrechetDistance returns the discrete Fréchet distance in meters between two shapes.
+func FrechetDistance(a, b Shape) float64 {
+	lat0 := shapesLatitude(a, b)
+	return frechetDistance(projectShape(a.Points, lat0), projectShape(b.Points, lat0), math.Inf(1))
+}
+
+// HausdorffDistance returns the symmetric Hausdorff distance in meters between two shapes.
+func HausdorffDistance(a, b Shape) float64 {
+	lat0 := shapesLatitude(a, b)
+	return hausdorffDistance(projectShape(a.Points, lat0), projectShape(b.Points, lat0))
+}
+
+func shapesLatitude(a, b Shape) float64 {
+	return (a.Bounds.MinLat + a.Bounds.MaxLat + b.Bounds.MinLat + b.Bounds.MaxLat) / 4
+}
+
+// SimilarityResult is the comparison of the geometry of two tracks. Overlap is the fraction of both
+// tracks that is common, Frechet and Hausdorff are the distances in meters of the common part, infinite
+// when there isn't a common part closer than the tolerance, and Score goes from 0 (different tracks) to
+// 1 (the same track).
+type SimilarityResult struct {
+	Overlap   float64 `json:"overlap"`
+	Frechet   float64 `json:"frechet"`
+	Hausdorff float64 `json:"hausdorff"`
+	Score     float64 `json:"score"`
+}
+
+// Similarity compares the geometry of two shapes. The track that starts later and the track that ends
+// earlier set the common part, so the same track recorded by two devices that started and stopped at
+// different moments is similar, while two tracks that only share the start have a small overlap. The
+// Fréchet distance of the common part, less the error of the resampling, reduces the score linearly
+// until it reaches the tolerance.
+func Similarity(a, b Shape, tolerance float64) SimilarityResult {
+	result := SimilarityResult{Frechet: math.Inf(1), Hausdorff: math.Inf(1)}
+	if len(a.Points) < 2 || len(b.Points) < 2 || !BoundsOverlap(a.Bounds, b.Bounds, tolerance) {
+		return result
+	}
+
+	lat0 := shapesLatitude(a, b)
+	pa, pb := projectShape(a.Points, lat0), projectShape(b.Points, lat0)
+	// the alignments with a distance greater than the tolerance have a score of 0
+	resampling := math.Max(a.Interval, b.Interval) / 2
+	var best alignment
+	for _, c := range alignments(pa, pb, tolerance) {
+		ca, cb := pa[c.firstA:c.lastA+1], pb[c.firstB:c.lastB+1]
+		if d := frechetDistance(ca, cb, math.Min(result.Frechet, tolerance+resampling)); d < result.Frechet {
+			result.Frechet = d
+			best = c
+		}
+	}
+	if math.IsInf(result.Frechet, 1) {
+		return result
+	}
+	ca, cb := pa[best.firstA:best.lastA+1], pb[best.firstB:best.lastB+1]
+	result.Hausdorff = hausdorffDistance(ca, cb)
+	// the distance along each shape, the shapes can have different intervals
+	common := float64(best.lastA-best.firstA)*a.Interval + float64(best.lastB-best.firstB)*b.Interval
+	result.Overlap = math.Min(common/(float64(len(pa)-1)*a.Interval+float64(len(pb)-1)*b.Interval), 1)
+
+	closeness := 1 - math.Max(0, result.Frechet-resampling)/tolerance
+	result.Score = result.Overlap * math.Max(0, closeness)
+	return result
+}
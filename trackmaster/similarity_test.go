@@ -0,0 +1,63 @@
+package trackmaster_test
+
+import (
+	"testing"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// lineGPX returns a track from the position going north n points every step degrees of latitude and
+// then east m points.
+func lineGPX(lat, lon, step float64, n, m int) gpx.GPX {
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < n; i++ {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: lat + float64(i)*step, Lon: lon})
+	}
+	for i := 1; i <= m; i++ {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: lat + float64(n-1)*step, Lon: lon + float64(i)*step})
+	}
+	return gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+func TestShapeDistances(t *testing.T) {
+	// about 1 km north and a parallel line 100 m east
+	a := trackmaster.TrackShape(lineGPX(42, 2, 0.0001, 91, 0), 10, 1000)
+	b := trackmaster.TrackShape(lineGPX(42, 2.0012, 0.00015, 61, 0), 10, 1000)
+	assert.InDelta(t, 100, trackmaster.HausdorffDistance(a, b), 2)
+	assert.InDelta(t, 100, trackmaster.FrechetDistance(a, b), 2)
+	assert.InDelta(t, 10, a.Interval, 0.01)
+
+	// the interval grows when there are too many points
+	c := trackmaster.TrackShape(lineGPX(42, 2, 0.0001, 91, 0), 10, 11)
+	assert.Len(t, c.Points, 11)
+	assert.InDelta(t, 100, c.Interval, 0.1)
+}
+
+func TestSimilarity(t *testing.T) {
+	a := trackmaster.TrackShape(lineGPX(42, 2, 0.0001, 400, 0), trackmaster.ShapeInterval, trackmaster.ShapeMaxPoints)
+
+	// the same path 5 m east recorded with other points, started 300 m later and stopped 200 m later
+	trimmed := trackmaster.TrackShape(lineGPX(42.0027, 2.00006, 0.00017, 230, 0), trackmaster.ShapeInterval, trackmaster.ShapeMaxPoints)
+	s := trackmaster.Similarity(a, trimmed, 50)
+	assert.Greater(t, s.Score, 0.8)
+	assert.Less(t, s.Frechet, 20.0)
+	assert.Less(t, s.Hausdorff, 20.0)
+
+	// other track that shares the first 500 m
+	other := trackmaster.TrackShape(lineGPX(42, 2, 0.0001, 45, 400), trackmaster.ShapeInterval, trackmaster.ShapeMaxPoints)
+	s = trackmaster.Similarity(a, other, 50)
+	assert.Less(t, s.Overlap, 0.3)
+	assert.Less(t, s.Score, 0.3)
+
+	// the first half of the track with a bigger interval, the overlap is the fraction of the distance
+	half := trackmaster.TrackShape(lineGPX(42, 2, 0.0001, 200, 0), trackmaster.ShapeInterval, 20)
+	assert.Greater(t, half.Interval, 100.0)
+	assert.InDelta(t, 2.0/3, trackmaster.Similarity(a, half, 50).Overlap, 0.05)
+
+	// tracks far away
+	far := trackmaster.TrackShape(lineGPX(43, 2, 0.0001, 400, 0), trackmaster.ShapeInterval, trackmaster.ShapeMaxPoints)
+	assert.Zero(t, trackmaster.Similarity(a, far, 50).Score)
+	assert.Equal(t, 1.0, trackmaster.Similarity(a, a, 50).Score)
+}
@@ -0,0 +1,245 @@
+package trackmaster
+
+import (
+	"container/heap"
+	"math"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// SimplifyConfig defines the simplification of the segments, distances are in meters and areas in square meters.
+type SimplifyConfig struct {
+	// Algorithm is distance, douglas-peucker or visvalingam
+	Algorithm string
+	// Distance is the minimum distance between points of the distance algorithm
+	Distance float64
+	// Tolerance is the maximum distance of the removed points to the line of douglas-peucker
+	Tolerance float64
+	// Points and Area are the points to keep by segment and the minimum area of visvalingam
+	Points int
+	Area   float64
+	// ThreeD uses the elevation in the simplification
+	ThreeD bool
+}
+
+// DefaultSimplifyConfig returns the configuration used by the simplifypoints command.
+func DefaultSimplifyConfig() SimplifyConfig {
+	return SimplifyConfig{
+		Algorithm: "distance",
+		Distance:  0.5,
+		Tolerance: 2,
+		Area:      10,
+	}
+}
+
+// vector is a point projected to meters around the first point of a segment.
+type vector struct {
+	x, y, z float64
+}
+
+// projectSegment projects the points of a segment to meters, the elevation is only used in 3D.
+func projectSegment(ts gpx.TrkSegType, threeD bool) []vector {
+	result := make([]vector, len(ts.TrkPt))
+	if len(ts.TrkPt) == 0 {
+		return result
+	}
+	coefficient := math.Cos(toRadians(ts.TrkPt[0].Lat))
+	for i, WptType := range ts.TrkPt {
+		result[i] = vector{
+			x: WptType.Lon * coefficient * oneDegree,
+			y: WptType.Lat * oneDegree,
+		}
+		if threeD {
+			result[i].z = WptType.Ele
+		}
+	}
+	return result
+}
+
+func (v vector) sub(o vector) vector {
+	return vector{v.x - o.x, v.y - o.y, v.z - o.z}
+}
+
+func (v vector) dot(o vector) float64 {
+	return v.x*o.x + v.y*o.y + v.z*o.z
+}
+
+func (v vector) cross(o vector) vector {
+	return vector{v.y*o.z - v.z*o.y, v.z*o.x - v.x*o.z, v.x*o.y - v.y*o.x}
+}
+
+func (v vector) length() float64 {
+	return math.Sqrt(v.dot(v))
+}
+
+// segmentDistance returns the distance from p to the line segment ab.
+func segmentDistance(p, a, b vector) float64 {
+	ab := b.sub(a)
+	ap := p.sub(a)
+	l := ab.dot(ab)
+	if l == 0 {
+		return ap.length()
+	}
+	t := math.Max(0, math.Min(1, ap.dot(ab)/l))
+	return ap.sub(vector{ab.x * t, ab.y * t, ab.z * t}).length()
+}
+
+// triangleArea returns the area of the triangle abc.
+func triangleArea(a, b, c vector) float64 {
+	return b.sub(a).cross(c.sub(a)).length() / 2
+}
+
+// SimplifyDouglasPeucker simplifies the segments with the Ramer–Douglas–Peucker algorithm,
+// the points closer than tolerance meters to the simplified line are removed.
+func SimplifyDouglasPeucker(g gpx.GPX, tolerance float64, threeD, fix bool) []GPXElementInfo {
+	var result []GPXElementInfo
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) < 3 {
+				continue
+			}
+			points := projectSegment(*TrkSegType, threeD)
+			keep := make([]bool, len(points))
+			keep[0], keep[len(points)-1] = true, true
+
+			// iterative version to support segments with many points
+			stack := [][2]int{{0, len(points) - 1}}
+			for len(stack) > 0 {
+				first, last := stack[len(stack)-1][0], stack[len(stack)-1][1]
+				stack = stack[:len(stack)-1]
+				index := -1
+				maxDistance := tolerance
+				for i := first + 1; i < last; i++ {
+					d := segmentDistance(points[i], points[first], points[last])
+					if d > maxDistance {
+						index = i
+						maxDistance = d
+					}
+				}
+				if index != -1 {
+					keep[index] = true
+					stack = append(stack, [2]int{first, index}, [2]int{index, last})
+				}
+			}
+
+			result = append(result, simplifySegment(g, TrkTypeNo, TrkSegTypeNo, keep, fix)...)
+		}
+	}
+	return result
+}
+
+type visvalingamPoint struct {
+	index      int
+	area       float64
+	prev, next int
+	heapIndex  int
+}
+
+type visvalingamHeap []*visvalingamPoint
+
+func (h visvalingamHeap) Len() int           { return len(h) }
+func (h visvalingamHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h visvalingamHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *visvalingamHeap) Push(x interface{}) {
+	p := x.(*visvalingamPoint) //nolint:forcetypeassert
+	p.heapIndex = len(*h)
+	*h = append(*h, p)
+}
+
+func (h *visvalingamHeap) Pop() interface{} {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// SimplifyVisvalingam simplifies the segments with the Visvalingam–Whyatt algorithm, the points with
+// the smallest effective area are removed until a segment has maxPoints points or all the areas are bigger
+// than minArea square meters, set 0 to not use a rule.
+func SimplifyVisvalingam(g gpx.GPX, maxPoints int, minArea float64, threeD, fix bool) []GPXElementInfo {
+	var result []GPXElementInfo
+	if maxPoints <= 0 && minArea <= 0 {
+		return result
+	}
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			if len(TrkSegType.TrkPt) < 3 {
+				continue
+			}
+			points := projectSegment(*TrkSegType, threeD)
+			nodes := make([]*visvalingamPoint, len(points))
+			h := make(visvalingamHeap, 0, len(points))
+			for i := range points {
+				nodes[i] = &visvalingamPoint{index: i, prev: i - 1, next: i + 1, heapIndex: -1}
+				if i == 0 || i == len(points)-1 {
+					continue
+				}
+				nodes[i].area = triangleArea(points[i-1], points[i], points[i+1])
+				heap.Push(&h, nodes[i])
+			}
+
+			keep := make([]bool, len(points))
+			for i := range keep {
+				keep[i] = true
+			}
+			remaining := len(points)
+			var lastArea float64
+			for h.Len() > 0 {
+				p := h[0]
+				// the first rule that is reached stops the simplification
+				if maxPoints > 0 && remaining <= maxPoints {
+					break
+				}
+				if minArea > 0 && p.area >= minArea {
+					break
+				}
+				heap.Pop(&h)
+				keep[p.index] = false
+				remaining--
+				// the effective area never decreases, so the removed points are not shown before the current one
+				lastArea = math.Max(lastArea, p.area)
+
+				prev, next := nodes[p.prev], nodes[p.next]
+				prev.next, next.prev = next.index, prev.index
+				for _, n := range []*visvalingamPoint{prev, next} {
+					if n.heapIndex == -1 || n.prev < 0 || n.next >= len(points) {
+						continue
+					}
+					n.area = math.Max(triangleArea(points[n.prev], points[n.index], points[n.next]), lastArea)
+					heap.Fix(&h, n.heapIndex)
+				}
+			}
+
+			result = append(result, simplifySegment(g, TrkTypeNo, TrkSegTypeNo, keep, fix)...)
+		}
+	}
+	return result
+}
+
+// simplifySegment returns the points that are not kept and removes them when fix is true, the sensor values
+// of the kept points are not changed.
+func simplifySegment(g gpx.GPX, trkTypeNo, trkSegTypeNo int, keep []bool, fix bool) []GPXElementInfo {
+	var result []GPXElementInfo
+	var dst []*gpx.WptType
+	for wptTypeNo, WptType := range g.Trk[trkTypeNo].TrkSeg[trkSegTypeNo].TrkPt {
+		if keep[wptTypeNo] {
+			dst = append(dst, WptType)
+			continue
+		}
+		result = append(result, GPXElementInfo{
+			WptType:      *WptType,
+			WptTypeNo:    wptTypeNo,
+			TrkSegTypeNo: trkSegTypeNo,
+			TrkTypeNo:    trkTypeNo,
+		})
+	}
+	if fix {
+		g.Trk[trkTypeNo].TrkSeg[trkSegTypeNo].TrkPt = dst
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+package trackmaster_test
+
+import (
+	"testing"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// simplifyGPX returns a segment with a straight line of 11 points and a corner at the end.
+func simplifyGPX() gpx.GPX {
+	seg := &gpx.TrkSegType{}
+	for i := 0; i <= 10; i++ {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: 40 + float64(i)*0.001, Lon: 0.1, Ele: 100})
+	}
+	seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: 40.01, Lon: 0.11, Ele: 100})
+	return gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+}
+
+// TestSimplifyDouglasPeucker tests that the straight line is reduced to the corners.
+func TestSimplifyDouglasPeucker(t *testing.T) {
+	g := simplifyGPX()
+	result := trackmaster.SimplifyDouglasPeucker(g, 1, false, true)
+	assert.Len(t, result, 9)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 3)
+	assert.Equal(t, 40.01, g.Trk[0].TrkSeg[0].TrkPt[1].Lat)
+
+	// a peak in the elevation is kept in 3D
+	g = simplifyGPX()
+	g.Trk[0].TrkSeg[0].TrkPt[5].Ele = 150
+	trackmaster.SimplifyDouglasPeucker(g, 1, true, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 6)
+	assert.Equal(t, 150.0, g.Trk[0].TrkSeg[0].TrkPt[2].Ele)
+
+	// the sensor values of the kept points are not changed
+	g = simplifyGPX()
+	for i, WptType := range g.Trk[0].TrkSeg[0].TrkPt {
+		trackmaster.SetSensor(WptType, trackmaster.Sensor{HeartRate: float64(100 + i)})
+	}
+	trackmaster.SimplifyDouglasPeucker(g, 1, false, true)
+	assert.Equal(t, 100.0, trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[0]).HeartRate)
+	assert.Equal(t, 110.0, trackmaster.GetSensor(*g.Trk[0].TrkSeg[0].TrkPt[1]).HeartRate)
+}
+
+// TestSimplifyVisvalingam tests the target number of points and the area threshold.
+func TestSimplifyVisvalingam(t *testing.T) {
+	g := simplifyGPX()
+	trackmaster.SimplifyVisvalingam(g, 0, 1, false, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 3)
+
+	g = simplifyGPX()
+	trackmaster.SimplifyVisvalingam(g, 5, 0, false, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 5)
+	assert.Equal(t, 40.01, g.Trk[0].TrkSeg[0].TrkPt[3].Lat)
+	assert.Equal(t, 0.11, g.Trk[0].TrkSeg[0].TrkPt[4].Lon)
+
+	// the first rule that is reached stops the simplification
+	g = simplifyGPX()
+	trackmaster.SimplifyVisvalingam(g, 2, 1, false, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 3)
+	g = simplifyGPX()
+	trackmaster.SimplifyVisvalingam(g, 5, 1, false, true)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 5)
+}
@@ -6,6 +6,13 @@ import (
 	gpx "github.com/twpayne/go-gpx"
 )
 
+const (
+	// DefaultMaxSpeed is the maximum speed used by the maxspeed command
+	DefaultMaxSpeed = 200.0
+	// DefaultLastMaxSpeed is the maximum speed at the end of the track used by the removelastmaxspeed command
+	DefaultLastMaxSpeed = 14.0
+)
+
 // MaxSpeed finds the max speed in a GPX file.
 func MaxSpeed(g gpx.GPX, max float64, fix bool) []GPXElementInfo {
 	var result []GPXElementInfo
@@ -118,6 +125,15 @@ func maxSpeedFix(ts gpx.TrkSegType, wptTypeNo int, fix bool) {
 		ts.TrkPt[wptTypeNo+1].Lat = mid.Lat
 		ts.TrkPt[wptTypeNo+1].Lon = mid.Lon
 		ts.TrkPt[wptTypeNo+1].Ele = mid.Ele
+
+		// speed and course are calculated from the wrong position, the other sensors are still valid
+		s := GetSensor(*ts.TrkPt[wptTypeNo+1])
+		if s.Speed != 0 || s.Course != 0 {
+			i := InterpolateSensor(GetSensor(*ts.TrkPt[wptTypeNo]), GetSensor(*ts.TrkPt[closest]), 0.5)
+			s.Speed = i.Speed
+			s.Course = i.Course
+			SetSensor(ts.TrkPt[wptTypeNo+1], s)
+		}
 	}
 }
 
@@ -0,0 +1,166 @@
+package trackmaster
+
+import (
+	"math"
+	"time"
+
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// SummaryInfo contains the statistics of the whole GPX, a track or a segment, distances are in meters,
+// times in seconds and speeds in meters per second.
+type SummaryInfo struct {
+	TrkTypeNo    int       `json:"track"`
+	TrkSegTypeNo int       `json:"segment"`
+	Points       int       `json:"points"`
+	Distance2D   float64   `json:"distance2d"`
+	Distance3D   float64   `json:"distance3d"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Elapsed      float64   `json:"elapsed"`
+	Moving       float64   `json:"moving"`
+	Gain         float64   `json:"gain"`
+	Loss         float64   `json:"loss"`
+	MinElevation float64   `json:"minElevation"`
+	MaxElevation float64   `json:"maxElevation"`
+	MaxSpeed     float64   `json:"maxSpeed"`
+	AvgSpeed     float64   `json:"avgSpeed"`
+	MovingSpeed  float64   `json:"movingSpeed"`
+}
+
+// SummaryResult contains the statistics of the GPX and the breakdown by tracks and segments.
+type SummaryResult struct {
+	Total    SummaryInfo   `json:"total"`
+	Tracks   []SummaryInfo `json:"tracks"`
+	Segments []SummaryInfo `json:"segments"`
+}
+
+// SummaryConfig defines how the stops and the elevation are calculated.
+type SummaryConfig struct {
+	// Hysteresis is the minimum elevation change to be counted as gain or loss
+	Hysteresis float64
+	// the stops are calculated like RemoveStops
+	StopSeconds   float64
+	StopDistance  float64
+	StopElevation float64
+	StopPoints    int
+}
+
+// DefaultSummaryConfig returns the configuration used by the stats command.
+func DefaultSummaryConfig() SummaryConfig {
+	return SummaryConfig{
+		Hysteresis:    5,
+		StopSeconds:   30,
+		StopDistance:  5,
+		StopElevation: 2,
+		StopPoints:    3,
+	}
+}
+
+// Summary returns the statistics of a GPX, the GPX is not modified.
+func Summary(g gpx.GPX, config SummaryConfig) SummaryResult {
+	var result SummaryResult
+
+	// time stopped by segment
+	stopped := make(map[[2]int]float64)
+	for _, stop := range RemoveStops(Clone(g), config.StopSeconds, config.StopDistance, config.StopElevation, config.StopPoints, false) {
+		stopped[[2]int{stop.TrkTypeNo, stop.TrkSegTypeNo}] += stop.Duration
+	}
+
+	result.Total = newSummaryInfo(-1, -1)
+	for trkTypeNo, TrkType := range g.Trk {
+		trk := newSummaryInfo(trkTypeNo, -1)
+		for trkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
+			seg := newSummaryInfo(trkTypeNo, trkSegTypeNo)
+			var last *gpx.WptType
+			var reference float64
+			for _, WptType := range TrkSegType.TrkPt {
+				seg.Points++
+				if timeValid(WptType.Time) {
+					if seg.Start.IsZero() {
+						seg.Start = WptType.Time
+					}
+					seg.End = WptType.Time
+				}
+				if WptType.Ele != 0 {
+					seg.MinElevation = math.Min(seg.MinElevation, WptType.Ele)
+					seg.MaxElevation = math.Max(seg.MaxElevation, WptType.Ele)
+					// the elevation only changes when the difference is bigger than the hysteresis
+					if reference == 0 {
+						reference = WptType.Ele
+					} else if WptType.Ele-reference >= config.Hysteresis {
+						seg.Gain += WptType.Ele - reference
+						reference = WptType.Ele
+					} else if reference-WptType.Ele >= config.Hysteresis {
+						seg.Loss += reference - WptType.Ele
+						reference = WptType.Ele
+					}
+				}
+				if last != nil {
+					point := SpeedBetween(*last, *WptType, false)
+					seg.Distance2D += point.Length
+					seg.Distance3D += Distance3D(*last, *WptType)
+					seg.MaxSpeed = math.Max(seg.MaxSpeed, point.Speed)
+				}
+				last = WptType
+			}
+			if !seg.Start.IsZero() {
+				seg.Elapsed = seg.End.Sub(seg.Start).Seconds()
+				seg.Moving = math.Max(seg.Elapsed-stopped[[2]int{trkTypeNo, trkSegTypeNo}], 0)
+			}
+			seg.finish()
+			result.Segments = append(result.Segments, seg)
+			trk.add(seg)
+		}
+		trk.finish()
+		result.Tracks = append(result.Tracks, trk)
+		result.Total.add(trk)
+	}
+	result.Total.finish()
+
+	return result
+}
+
+func newSummaryInfo(trkTypeNo, trkSegTypeNo int) SummaryInfo {
+	return SummaryInfo{
+		TrkTypeNo:    trkTypeNo,
+		TrkSegTypeNo: trkSegTypeNo,
+		MinElevation: math.MaxFloat64,
+		MaxElevation: -math.MaxFloat64,
+	}
+}
+
+// add accumulates the statistics of a track or segment.
+func (s *SummaryInfo) add(o SummaryInfo) {
+	s.Points += o.Points
+	s.Distance2D += o.Distance2D
+	s.Distance3D += o.Distance3D
+	s.Moving += o.Moving
+	s.Gain += o.Gain
+	s.Loss += o.Loss
+	s.MinElevation = math.Min(s.MinElevation, o.MinElevation)
+	s.MaxElevation = math.Max(s.MaxElevation, o.MaxElevation)
+	s.MaxSpeed = math.Max(s.MaxSpeed, o.MaxSpeed)
+	if !o.Start.IsZero() && (s.Start.IsZero() || o.Start.Before(s.Start)) {
+		s.Start = o.Start
+	}
+	if o.End.After(s.End) {
+		s.End = o.End
+	}
+}
+
+// finish calculates the values that depend on the accumulated values.
+func (s *SummaryInfo) finish() {
+	if s.MinElevation == math.MaxFloat64 {
+		s.MinElevation, s.MaxElevation = 0, 0
+	}
+	if !s.Start.IsZero() {
+		s.Elapsed = s.End.Sub(s.Start).Seconds()
+	}
+	if s.Elapsed > 0 {
+		s.AvgSpeed = s.Distance2D / s.Elapsed
+	}
+	if s.Moving > 0 {
+		s.MovingSpeed = s.Distance2D / s.Moving
+	}
+}
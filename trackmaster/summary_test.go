@@ -0,0 +1,60 @@
+package trackmaster_test
+
+import (
+	"testing"
+	"time"
+
+	trackmaster "github.com/inode64/gotrackmaster/trackmaster"
+	"github.com/stretchr/testify/assert"
+	gpx "github.com/twpayne/go-gpx"
+)
+
+// TestSummary tests the distance, time and elevation gain with hysteresis.
+func TestSummary(t *testing.T) {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	elevations := []float64{100, 102, 101, 110, 108, 120, 100}
+	seg := &gpx.TrkSegType{}
+	for i, ele := range elevations {
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{
+			Lat:  40 + float64(i)*0.001,
+			Lon:  0.1,
+			Ele:  ele,
+			Time: start.Add(time.Duration(i) * 10 * time.Second),
+		})
+	}
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	config := trackmaster.DefaultSummaryConfig()
+	config.Hysteresis = 5
+	s := trackmaster.Summary(g, config)
+	assert.Equal(t, 7, s.Total.Points)
+	assert.Equal(t, 60.0, s.Total.Elapsed)
+	assert.Equal(t, 60.0, s.Total.Moving)
+	assert.Equal(t, 20.0, s.Total.Gain)
+	assert.Equal(t, 20.0, s.Total.Loss)
+	assert.Equal(t, 100.0, s.Total.MinElevation)
+	assert.Equal(t, 120.0, s.Total.MaxElevation)
+	assert.InDelta(t, 667, s.Total.Distance2D, 1)
+	assert.Len(t, s.Tracks, 1)
+	assert.Len(t, s.Segments, 1)
+	assert.Equal(t, s.Total.Distance2D, s.Segments[0].Distance2D)
+}
+
+// TestSummaryTrailingStop tests that a stop at the end of a segment is not moving time.
+func TestSummaryTrailingStop(t *testing.T) {
+	start := time.Date(2022, time.May, 1, 7, 0, 0, 0, time.UTC)
+	seg := &gpx.TrkSegType{}
+	for i := 0; i < 12; i++ {
+		lat := 40 + float64(i)*0.001
+		if i > 5 {
+			lat = 40.005
+		}
+		seg.TrkPt = append(seg.TrkPt, &gpx.WptType{Lat: lat, Lon: 0.1, Ele: 100, Time: start.Add(time.Duration(i) * 10 * time.Second)})
+	}
+	g := gpx.GPX{Trk: []*gpx.TrkType{{TrkSeg: []*gpx.TrkSegType{seg}}}}
+
+	s := trackmaster.Summary(g, trackmaster.DefaultSummaryConfig())
+	assert.Equal(t, 110.0, s.Total.Elapsed)
+	assert.Equal(t, 50.0, s.Total.Moving)
+	assert.Len(t, g.Trk[0].TrkSeg[0].TrkPt, 12)
+}
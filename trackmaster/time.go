@@ -104,24 +104,34 @@ func TimeEmpty(g gpx.GPX) bool {
 	return true
 }
 
-// TimeQuality returns the quality of the time information in the GPX file.
-func TimeQuality(g gpx.GPX) int {
-	var num, total int
-	for _, TrkType := range g.Trk {
-		for _, TrkSegType := range TrkType.TrkSeg {
+// timeIssues returns the points without a valid time, the points whose time is before the time of the
+// previous point and the number of points.
+func timeIssues(g gpx.GPX) ([]GPXElementInfo, []GPXElementInfo, int) {
+	var invalid, backwards []GPXElementInfo
+	var total int
+	for TrkTypeNo, TrkType := range g.Trk {
+		for TrkSegTypeNo, TrkSegType := range TrkType.TrkSeg {
 			var lastValidTime time.Time
-			for _, WptType := range TrkSegType.TrkPt {
+			for WptTypeNo, WptType := range TrkSegType.TrkPt {
+				info := GPXElementInfo{WptType: *WptType, WptTypeNo: WptTypeNo, TrkSegTypeNo: TrkSegTypeNo, TrkTypeNo: TrkTypeNo}
 				if !timeValid(WptType.Time) {
-					num++
+					invalid = append(invalid, info)
 				}
 				if !lastValidTime.IsZero() && WptType.Time.Before(lastValidTime) {
-					num += 4
+					backwards = append(backwards, info)
 				}
 				lastValidTime = WptType.Time
 				total++
 			}
 		}
 	}
+	return invalid, backwards, total
+}
+
+// TimeQuality returns the quality of the time information in the GPX file.
+func TimeQuality(g gpx.GPX) int {
+	invalid, backwards, total := timeIssues(g)
+	num := len(invalid) + 4*len(backwards)
 	if num > total {
 		return 0
 	}